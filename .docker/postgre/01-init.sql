@@ -18,7 +18,14 @@ CREATE TABLE public.oncall_users
     username     character varying(32)                             NOT NULL,
     email        character varying(120),
     phone_number character varying(20),
-    active       boolean          DEFAULT false,
+    telegram_chat_id character varying(32),
+    sms_translit boolean,
+    phone_verified_at timestamp without time zone,
+    phone_verified character varying(20),
+    synced_at    timestamp without time zone,
+    grafana_role public.role_type,
+    grafana_active boolean,
+    active       boolean          DEFAULT true,
     role         public.role_type DEFAULT 'user'::public.role_type NOT NULL
 );
 ALTER TABLE public.oncall_users
@@ -47,7 +54,8 @@ ALTER TABLE ONLY public.oncall_users
 
 CREATE INDEX email_index ON public.oncall_users USING btree (email);
 CREATE INDEX index_role ON public.oncall_users USING btree (role);
-CREATE INDEX index_user_id ON public.oncall_users USING btree (user_id);
+CREATE UNIQUE INDEX index_user_id ON public.oncall_users USING btree (user_id);
+CREATE UNIQUE INDEX index_email_unique ON public.oncall_users USING btree (lower(email));
 
 create sequence public.events_id_seq;
 
@@ -59,15 +67,146 @@ create table public.events
     channel   character varying(20) not null,
     recipient character varying(50) not null,
     success   boolean               not null default false,
-    msg       character varying(500)
+    msg       character varying(500),
+    external_id character varying(100),
+    status    character varying(20),
+    plugin    character varying(50),
+    alert_id  character varying(50),
+    incident_id integer,
+    segments  smallint,
+    notification_id bigint
 );
 
 create index index_date_add on public.events using btree (date_add);
 create index index_success on public.events using btree (success);
 create index index_recipient on public.events using btree (recipient);
+create index index_external_id on public.events using btree (external_id);
 
 alter sequence public.events_id_seq owner to "user";
 alter sequence public.events_id_seq owned by public.events.id;
 
+create sequence public.redials_id_seq;
+
+create table public.redials
+(
+    id          bigint primary key     not null default nextval('redials_id_seq'::regclass),
+    date_add    timestamp without time zone not null,
+    next_at     timestamp without time zone not null,
+    email       character varying(120) not null,
+    alert_id    character varying(50),
+    incident_id integer,
+    request_id  character varying(50),
+    text        text                   not null,
+    attempt     integer                not null default 1,
+    attempts    integer                not null,
+    status      character varying(20)  not null default 'pending'
+);
+
+create index index_redials_next_at on public.redials using btree (status, next_at);
+
+alter sequence public.redials_id_seq owner to "user";
+alter sequence public.redials_id_seq owned by public.redials.id;
+
+create sequence public.notifications_id_seq;
+
+create table public.notifications
+(
+    id           bigint primary key     not null default nextval('notifications_id_seq'::regclass),
+    date_add     timestamp without time zone not null,
+    updated_at   timestamp without time zone not null,
+    next_at      timestamp without time zone not null,
+    request_id   character varying(50),
+    type         character varying(20)  not null,
+    user_id      character varying(50)  not null,
+    email        character varying(120) not null,
+    alert_id     character varying(50),
+    incident_id  integer,
+    payload      text                   not null,
+    attempt      integer                not null default 0,
+    max_attempts integer                not null,
+    status       character varying(20)  not null default 'queued',
+    channel      character varying(20),
+    step         character varying(50),
+    error        character varying(500)
+);
+
+create index index_notifications_next_at on public.notifications using btree (status, next_at);
+create index index_notifications_user_id on public.notifications using btree (user_id, date_add);
+create index index_notifications_incident_id on public.notifications using btree (incident_id);
+
+alter sequence public.notifications_id_seq owner to "user";
+alter sequence public.notifications_id_seq owned by public.notifications.id;
+
+create table public.quiet_policies
+(
+    user_id       character varying(15)  primary key not null,
+    timezone      character varying(64)  not null default 'UTC',
+    critical      character varying(20),
+    informational character varying(20),
+    delegate      character varying(120),
+    updated_at    timestamp without time zone not null
+);
+
+create sequence public.quiet_windows_id_seq;
+
+create table public.quiet_windows
+(
+    id         bigint primary key    not null default nextval('quiet_windows_id_seq'::regclass),
+    date_add   timestamp without time zone not null,
+    user_id    character varying(15) not null,
+    weekdays   character varying(30),
+    start_time character varying(5),
+    end_time   character varying(5),
+    starts_at  timestamp without time zone,
+    ends_at    timestamp without time zone,
+    reason     character varying(200)
+);
+
+create index index_quiet_windows_user_id on public.quiet_windows using btree (user_id);
+
+alter sequence public.quiet_windows_id_seq owner to "user";
+alter sequence public.quiet_windows_id_seq owned by public.quiet_windows.id;
+
+create sequence public.user_contacts_id_seq;
+
+create table public.user_contacts
+(
+    id           bigint primary key     not null default nextval('user_contacts_id_seq'::regclass),
+    date_add     timestamp without time zone not null,
+    user_id      character varying(15)  not null,
+    type         character varying(20)  not null,
+    value        character varying(120) not null,
+    priority     smallint               not null default 0,
+    verified     boolean                not null default false,
+    notify_types character varying(50)
+);
+
+create index index_user_contacts_user_id on public.user_contacts using btree (user_id);
+create index index_user_contacts_value on public.user_contacts using btree (type, value);
+
+alter sequence public.user_contacts_id_seq owner to "user";
+alter sequence public.user_contacts_id_seq owned by public.user_contacts.id;
+
+create sequence public.phone_verifications_id_seq;
+
+create table public.phone_verifications
+(
+    id           bigint primary key     not null default nextval('phone_verifications_id_seq'::regclass),
+    date_add     timestamp without time zone not null,
+    user_id      character varying(15)  not null,
+    contact_id   bigint,
+    phone_number character varying(255) not null,
+    channel      character varying(20)  not null,
+    code         character varying(64)  not null,
+    expires_at   timestamp without time zone not null,
+    attempts     smallint               not null default 0,
+    confirmed_at timestamp without time zone
+);
+
+create index index_phone_verifications_user_id on public.phone_verifications using btree (user_id);
+
+alter sequence public.phone_verifications_id_seq owner to "user";
+alter sequence public.phone_verifications_id_seq owned by public.phone_verifications.id;
+
 REVOKE USAGE ON SCHEMA public FROM PUBLIC;
 GRANT ALL ON SCHEMA public TO PUBLIC;
@@ -0,0 +1,6 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+ALTER TABLE public.events
+    ADD COLUMN IF NOT EXISTS external_id character varying(100),
+    ADD COLUMN IF NOT EXISTS status character varying(20);
+
+CREATE INDEX IF NOT EXISTS index_external_id ON public.events USING btree (external_id);
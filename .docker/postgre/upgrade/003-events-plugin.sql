@@ -0,0 +1,3 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+ALTER TABLE public.events
+    ADD COLUMN IF NOT EXISTS plugin character varying(50);
@@ -0,0 +1,4 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+ALTER TABLE public.events
+    ADD COLUMN IF NOT EXISTS alert_id character varying(50),
+    ADD COLUMN IF NOT EXISTS incident_id integer;
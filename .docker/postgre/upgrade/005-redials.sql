@@ -0,0 +1,22 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+create sequence if not exists public.redials_id_seq;
+
+create table if not exists public.redials
+(
+    id          bigint primary key     not null default nextval('redials_id_seq'::regclass),
+    date_add    timestamp without time zone not null,
+    next_at     timestamp without time zone not null,
+    email       character varying(120) not null,
+    alert_id    character varying(50),
+    incident_id integer,
+    request_id  character varying(50),
+    text        text                   not null,
+    attempt     integer                not null default 1,
+    attempts    integer                not null,
+    status      character varying(20)  not null default 'pending'
+);
+
+create index if not exists index_redials_next_at on public.redials using btree (status, next_at);
+
+alter sequence public.redials_id_seq owner to "user";
+alter sequence public.redials_id_seq owned by public.redials.id;
@@ -0,0 +1,6 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+ALTER TABLE public.oncall_users
+    ADD COLUMN IF NOT EXISTS sms_translit boolean;
+
+ALTER TABLE public.events
+    ADD COLUMN IF NOT EXISTS segments smallint;
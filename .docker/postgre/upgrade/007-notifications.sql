@@ -0,0 +1,27 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+create sequence if not exists public.notifications_id_seq;
+
+create table if not exists public.notifications
+(
+    id           bigint primary key     not null default nextval('notifications_id_seq'::regclass),
+    date_add     timestamp without time zone not null,
+    updated_at   timestamp without time zone not null,
+    next_at      timestamp without time zone not null,
+    request_id   character varying(50),
+    type         character varying(20)  not null,
+    user_id      character varying(50)  not null,
+    email        character varying(120) not null,
+    alert_id     character varying(50),
+    incident_id  integer,
+    payload      text                   not null,
+    attempt      integer                not null default 0,
+    max_attempts integer                not null,
+    status       character varying(20)  not null default 'pending',
+    step         character varying(50),
+    error        character varying(500)
+);
+
+create index if not exists index_notifications_next_at on public.notifications using btree (status, next_at);
+
+alter sequence public.notifications_id_seq owner to "user";
+alter sequence public.notifications_id_seq owned by public.notifications.id;
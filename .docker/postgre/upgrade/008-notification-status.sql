@@ -0,0 +1,13 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+ALTER TABLE public.notifications
+    ADD COLUMN IF NOT EXISTS channel character varying(20),
+    ALTER COLUMN status SET DEFAULT 'queued';
+
+UPDATE public.notifications SET status = 'queued' WHERE status = 'pending';
+UPDATE public.notifications SET status = 'failed' WHERE status = 'dead';
+
+create index if not exists index_notifications_user_id on public.notifications using btree (user_id, date_add);
+create index if not exists index_notifications_incident_id on public.notifications using btree (incident_id);
+
+ALTER TABLE public.events
+    ADD COLUMN IF NOT EXISTS notification_id bigint;
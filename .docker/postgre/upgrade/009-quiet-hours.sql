@@ -0,0 +1,30 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+create table if not exists public.quiet_policies
+(
+    user_id       character varying(15)  primary key not null,
+    timezone      character varying(64)  not null default 'UTC',
+    critical      character varying(20),
+    informational character varying(20),
+    delegate      character varying(120),
+    updated_at    timestamp without time zone not null
+);
+
+create sequence if not exists public.quiet_windows_id_seq;
+
+create table if not exists public.quiet_windows
+(
+    id         bigint primary key    not null default nextval('quiet_windows_id_seq'::regclass),
+    date_add   timestamp without time zone not null,
+    user_id    character varying(15) not null,
+    weekdays   character varying(30),
+    start_time character varying(5),
+    end_time   character varying(5),
+    starts_at  timestamp without time zone,
+    ends_at    timestamp without time zone,
+    reason     character varying(200)
+);
+
+create index if not exists index_quiet_windows_user_id on public.quiet_windows using btree (user_id);
+
+alter sequence public.quiet_windows_id_seq owner to "user";
+alter sequence public.quiet_windows_id_seq owned by public.quiet_windows.id;
@@ -0,0 +1,20 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+create sequence if not exists public.user_contacts_id_seq;
+
+create table if not exists public.user_contacts
+(
+    id           bigint primary key     not null default nextval('user_contacts_id_seq'::regclass),
+    date_add     timestamp without time zone not null,
+    user_id      character varying(15)  not null,
+    type         character varying(20)  not null,
+    value        character varying(120) not null,
+    priority     smallint               not null default 0,
+    verified     boolean                not null default false,
+    notify_types character varying(50)
+);
+
+create index if not exists index_user_contacts_user_id on public.user_contacts using btree (user_id);
+create index if not exists index_user_contacts_value on public.user_contacts using btree (type, value);
+
+alter sequence public.user_contacts_id_seq owner to "user";
+alter sequence public.user_contacts_id_seq owned by public.user_contacts.id;
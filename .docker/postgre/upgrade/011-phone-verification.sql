@@ -0,0 +1,28 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+ALTER TABLE public.oncall_users
+    ADD COLUMN IF NOT EXISTS phone_verified_at timestamp without time zone,
+    ADD COLUMN IF NOT EXISTS phone_verified character varying(20);
+
+-- Numbers are not verified after upgrade, so OnCall doesn't route phone notifications to them until users confirm them.
+-- Uncomment to trust numbers which were already in use:
+-- update public.oncall_users set phone_verified_at = now(), phone_verified = phone_number where phone_number <> '';
+
+create sequence if not exists public.phone_verifications_id_seq;
+
+create table if not exists public.phone_verifications
+(
+    id           bigint primary key     not null default nextval('phone_verifications_id_seq'::regclass),
+    date_add     timestamp without time zone not null,
+    user_id      character varying(15)  not null,
+    phone_number character varying(20)  not null,
+    channel      character varying(20)  not null,
+    code         character varying(64)  not null,
+    expires_at   timestamp without time zone not null,
+    attempts     smallint               not null default 0,
+    confirmed_at timestamp without time zone
+);
+
+create index if not exists index_phone_verifications_user_id on public.phone_verifications using btree (user_id);
+
+alter sequence public.phone_verifications_id_seq owner to "user";
+alter sequence public.phone_verifications_id_seq owned by public.phone_verifications.id;
@@ -0,0 +1,6 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+ALTER TABLE public.oncall_users
+    ALTER COLUMN active SET DEFAULT true;
+
+-- active was not used before, users are deactivated by admin API only
+update public.oncall_users set active = true where active is not true;
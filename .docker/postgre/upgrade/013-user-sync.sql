@@ -0,0 +1,3 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+ALTER TABLE public.oncall_users
+    ADD COLUMN IF NOT EXISTS synced_at timestamp without time zone;
@@ -0,0 +1,5 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+-- Codes can be sent to contact methods, phone_number keeps value of contact method then (e.g. email)
+ALTER TABLE public.phone_verifications
+    ADD COLUMN IF NOT EXISTS contact_id bigint,
+    ALTER COLUMN phone_number TYPE character varying(255);
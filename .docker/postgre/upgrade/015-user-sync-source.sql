@@ -0,0 +1,8 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+-- Role and state reported by Grafana on the last sync, so that changes made by admin API are not reverted
+ALTER TABLE public.oncall_users
+    ADD COLUMN IF NOT EXISTS grafana_role public.role_type,
+    ADD COLUMN IF NOT EXISTS grafana_active boolean;
+
+-- Synced users are taken as they were reported by Grafana
+UPDATE public.oncall_users SET grafana_role = role, grafana_active = active WHERE synced_at IS NOT NULL;
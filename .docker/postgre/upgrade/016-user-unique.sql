@@ -0,0 +1,12 @@
+-- Upgrade of existing database, fresh installations get it from 01-init.sql
+-- user_id and email are unique, so that users created concurrently by admin API and Grafana sync can't collide.
+-- Script fails when there are duplicates already, they are listed by:
+-- select user_id from public.oncall_users group by user_id having count(*) > 1;
+-- select lower(email) from public.oncall_users where email is not null group by lower(email) having count(*) > 1;
+BEGIN;
+
+DROP INDEX IF EXISTS public.index_user_id;
+CREATE UNIQUE INDEX index_user_id ON public.oncall_users USING btree (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS index_email_unique ON public.oncall_users USING btree (lower(email));
+
+COMMIT;
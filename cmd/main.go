@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/ebogdanov/emu-oncall/internal/ui"
@@ -12,12 +14,17 @@ import (
 	"github.com/ebogdanov/emu-oncall/internal/api"
 
 	"github.com/ebogdanov/emu-oncall/internal/db"
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
 	"github.com/ebogdanov/emu-oncall/internal/events"
 	"github.com/ebogdanov/emu-oncall/internal/grafana"
 	"github.com/ebogdanov/emu-oncall/internal/logger"
 	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/outbox"
+	"github.com/ebogdanov/emu-oncall/internal/quiet"
+	"github.com/ebogdanov/emu-oncall/internal/redial"
 	"github.com/ebogdanov/emu-oncall/internal/token"
 	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/internal/verification"
 
 	v1 "github.com/ebogdanov/emu-oncall/internal/api/v1"
 	"github.com/ebogdanov/emu-oncall/internal/config"
@@ -58,17 +65,38 @@ func main() {
 			Msg("unable connect to database")
 	}
 
-	// Now you can use for testing:
-	notifier := plugin.NewTextOutput(log)
+	plugins, err := plugin.NewSet(appConfig.Plugin, log)
+	if err != nil {
+		log.Fatal().Err(err).
+			Strs("drivers", plugin.Drivers()).
+			Msg("unable to initialize notification plugin")
+	}
+	notifier := plugins[plugin.DefaultInstance]
 
 	userStorage := user.NewStorage(sqlShard, log)
 
 	// Services
 	actions := events.New(sqlShard, log)
-	grafanaConnect := grafana.New(grafanaCfg, notifier, userStorage, log, promMetrics)
+
+	notifyCfg := config.ParseNotify()
+
+	dispatcher, err := delivery.New(notifyCfg, plugins, actions, log, promMetrics)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid notification fallback configuration")
+	}
+	pluginHealth := delivery.NewHealth(plugins, notifyCfg.HealthInterval, log, promMetrics)
+
+	templates, err := grafana.NewTemplates(grafanaCfg.Templates, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid message templates configuration")
+	}
+
+	grafanaConnect := grafana.New(grafanaCfg, notifier, templates, userStorage, log, promMetrics)
+	userSync := grafana.NewUserSync(grafanaCfg, userStorage, log, promMetrics)
 
 	healthCheck := func(result *api.HealthResponse) {
 		result.Ping = sqlShard.Ping() == nil
+		result.Plugins = pluginHealth.Status()
 
 		if result.Ping {
 			result.HTTPCode = http.StatusOK
@@ -76,13 +104,48 @@ func main() {
 	}
 
 	info := v1.NewInfo(appConfig)
-	usersV1 := v1.NewUsers(userStorage)
+	usersV1 := v1.NewUsers(userStorage, pluginHealth)
 	tokenSrv := token.NewFromConfig(appConfig)
-	notifyV1 := v1.NewNotify(userStorage, notifier, log, actions, grafanaConnect, promMetrics)
+	adminTokenSrv := token.NewAdminFromConfig(appConfig)
+	dedup := delivery.NewDedup(notifyCfg.Dedup, actions, log, promMetrics)
+	redialSvc := redial.New(notifyCfg.Redial, sqlShard, dispatcher, userStorage, grafanaConnect, actions, log, promMetrics)
+	outboxSvc := outbox.New(notifyCfg.Outbox, sqlShard, dispatcher, redialSvc, userStorage, log, promMetrics)
+
+	quietSvc, err := quiet.New(notifyCfg.Quiet, sqlShard, userStorage, actions, log, promMetrics)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid quiet hours configuration")
+	}
+
+	verificationSvc, err := verification.New(notifyCfg.Verification, sqlShard, userStorage, plugins, log, promMetrics)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid phone verification configuration")
+	}
+
+	receipts := delivery.NewReceipts(0, log,
+		func(ctx context.Context, r plugin.Receipt) error {
+			return actions.Receipt(ctx, r.ExternalID, r.Status, r.Success)
+		},
+		outboxSvc.Receipt,
+	)
+
+	for _, p := range plugins {
+		if reporter, ok := p.(plugin.ReceiptReporter); ok {
+			reporter.OnReceipt(receipts.Add)
+		}
+	}
+
+	notifyV1 := v1.NewNotify(userStorage, dispatcher, redialSvc, dedup, outboxSvc, quietSvc, log, grafanaConnect, promMetrics)
+	inboundV1 := v1.NewInbound(userStorage, dispatcher, log, grafanaConnect, promMetrics)
+	dtmfV1 := v1.NewDTMF(actions, outboxSvc, log, grafanaConnect, promMetrics)
+	notificationsV1 := v1.NewNotifications(outboxSvc)
+	quietV1 := v1.NewQuiet(quietSvc, userStorage)
+	contactsV1 := v1.NewContacts(userStorage)
+	verificationV1 := v1.NewVerification(verificationSvc)
+	usersAdminV1 := v1.NewUsersAdmin(userStorage)
 	integrationV1 := v1.NewIntegration(appConfig.Hostname, promMetrics)
 	onCallUI := ui.New(appConfig, log)
 
-	handlers := api.NewHandlers(usersV1, info, integrationV1, notifyV1, tokenSrv, onCallUI)
+	handlers := api.NewHandlers(usersV1, info, integrationV1, notifyV1, inboundV1, dtmfV1, notificationsV1, quietV1, contactsV1, verificationV1, usersAdminV1, tokenSrv, adminTokenSrv, onCallUI)
 	health := api.NewHealthChecker(appConfig.Version, healthCheck)
 
 	routes := api.NewRoutes(handlers, promMetrics)
@@ -98,15 +161,31 @@ func main() {
 		WriteTimeout: appConfig.WriteTimeout + 100*time.Microsecond,
 	}
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		receipts.Listen(ctx)
+	}()
+
+	// Events are written until workers are finished, so that events log is stopped separately
 	go func() {
-		actions.Listen(ctx)
+		actions.Listen(context.Background())
 	}()
 
+	var workers sync.WaitGroup
+
 	graceful.AddCallback(func() error {
-		ctx.Done()
+		// Outbox and redial finish notifications which are being delivered, so that they are not repeated after restart
+		cancel()
+		workers.Wait()
+
 		actions.Stop()
 
+		for _, p := range plugins {
+			if closer, ok := p.(io.Closer); ok {
+				_ = closer.Close()
+			}
+		}
+
 		log.Info().Msg("server was gracefully stopped")
 
 		return nil
@@ -116,6 +195,26 @@ func main() {
 		grafanaConnect.Start(ctx)
 	}()
 
+	go func() {
+		userSync.Start(ctx)
+	}()
+
+	go func() {
+		pluginHealth.Start(ctx)
+	}()
+
+	workers.Add(2)
+
+	go func() {
+		defer workers.Done()
+		redialSvc.Start(ctx)
+	}()
+
+	go func() {
+		defer workers.Done()
+		outboxSvc.Start(ctx)
+	}()
+
 	go func() {
 		log.Info().Msgf("HTTP Server: listening on %s", appConfig.Port)
 
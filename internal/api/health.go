@@ -3,12 +3,15 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
 )
 
 type HealthResponse struct {
-	HTTPCode int    `json:"http_code"`
-	Version  string `json:"version"`
-	Ping     bool   `json:"ping_db"`
+	HTTPCode int                              `json:"http_code"`
+	Version  string                           `json:"version"`
+	Ping     bool                             `json:"ping_db"`
+	Plugins  map[string]delivery.PluginStatus `json:"plugins,omitempty"`
 }
 
 type callback func(*HealthResponse)
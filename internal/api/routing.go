@@ -18,12 +18,20 @@ import (
 )
 
 type Handlers struct {
-	user        *v1.Users
-	info        *v1.Info
-	integration *v1.Integration
-	notify      *v1.Notify
-	token       token.Service
-	oncall      *ui.App
+	user          *v1.Users
+	info          *v1.Info
+	integration   *v1.Integration
+	notify        *v1.Notify
+	inbound       *v1.Inbound
+	dtmf          *v1.DTMF
+	notifications *v1.Notifications
+	quiet         *v1.Quiet
+	contacts      *v1.Contacts
+	verification  *v1.Verification
+	usersAdmin    *v1.UsersAdmin
+	token         token.Service
+	adminToken    token.Service
+	oncall        *ui.App
 }
 
 type Routes struct {
@@ -32,14 +40,22 @@ type Routes struct {
 	promMetrics *metrics.Storage
 }
 
-func NewHandlers(u *v1.Users, i *v1.Info, in *v1.Integration, n *v1.Notify, t token.Service, a *ui.App) *Handlers {
+func NewHandlers(u *v1.Users, i *v1.Info, in *v1.Integration, n *v1.Notify, ib *v1.Inbound, dt *v1.DTMF, nt *v1.Notifications, q *v1.Quiet, c *v1.Contacts, vr *v1.Verification, ua *v1.UsersAdmin, t, at token.Service, a *ui.App) *Handlers {
 	return &Handlers{
-		user:        u,
-		info:        i,
-		integration: in,
-		notify:      n,
-		token:       t,
-		oncall:      a,
+		user:          u,
+		info:          i,
+		integration:   in,
+		notify:        n,
+		inbound:       ib,
+		dtmf:          dt,
+		notifications: nt,
+		quiet:         q,
+		contacts:      c,
+		verification:  vr,
+		usersAdmin:    ua,
+		token:         t,
+		adminToken:    at,
+		oncall:        a,
 	}
 }
 
@@ -67,6 +83,21 @@ func (d *Routes) addAPIv1() *Routes {
 		return metricsMiddleware(d.promMetrics, next)
 	})
 
+	// Admin API has own token, it has to be matched before the rest of /api/v1
+	admin := d.r.PathPrefix("/api/v1/admin").Subrouter()
+	admin.Use(jsonContentTypeHandler)
+
+	admin.Use(func(next http.Handler) http.Handler {
+		return verificationHandler(d.handlers.adminToken, next)
+	})
+
+	/*
+	   api/v1/admin/users -> GET+POST, api/v1/admin/users/USERID -> GET+PUT+PATCH+DELETE
+	   api/v1/admin/users/USERID/deactivate -> POST
+	*/
+	admin.PathPrefix("/users").Handler(d.handlers.usersAdmin).
+		Methods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete)
+
 	router := d.r.PathPrefix("/api").PathPrefix("/v1").Subrouter()
 	router.Use(jsonContentTypeHandler)
 
@@ -80,6 +111,12 @@ func (d *Routes) addAPIv1() *Routes {
 	   api/v1/make_call -> POST
 	   api/v1/send_sms -> POST
 	   api/v1/integrations/ -> GET+POST
+	   api/v1/inbound/sms -> POST
+	   api/v1/callback/dtmf -> POST
+	   api/v1/notifications/ -> GET
+	   api/v1/quiet/USERID -> GET+PUT, api/v1/quiet/USERID/windows -> POST+DELETE
+	   api/v1/contacts/USERID -> GET+POST, api/v1/contacts/USERID/ID -> PUT+DELETE
+	   api/v1/verification/USERID -> POST, api/v1/verification/USERID/confirm -> POST
 	*/
 	router.PathPrefix("/users").Handler(d.handlers.user).Methods(http.MethodGet)
 	router.PathPrefix("/info").Handler(d.handlers.info).Methods(http.MethodGet)
@@ -88,7 +125,13 @@ func (d *Routes) addAPIv1() *Routes {
 	router.PathPrefix("/make_call").Handler(d.handlers.notify).Methods(http.MethodPost)
 	router.PathPrefix("/send_sms").Handler(d.handlers.notify).Methods(http.MethodPost)
 
-	// todo /ack (can be usefult for acknowledging alerts)
+	router.PathPrefix("/inbound/sms").Handler(d.handlers.inbound).Methods(http.MethodPost)
+	router.PathPrefix("/callback/dtmf").Handler(d.handlers.dtmf).Methods(http.MethodPost)
+
+	router.PathPrefix("/notifications").Handler(d.handlers.notifications).Methods(http.MethodGet)
+	router.PathPrefix("/quiet").Handler(d.handlers.quiet).Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete)
+	router.PathPrefix("/contacts").Handler(d.handlers.contacts).Methods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
+	router.PathPrefix("/verification").Handler(d.handlers.verification).Methods(http.MethodPost)
 
 	return d
 }
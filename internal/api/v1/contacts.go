@@ -0,0 +1,132 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+var (
+	errInvalidContactsPath = errors.New("invalid-contacts-path")
+	errInvalidContactID    = errors.New("invalid-contact-id")
+)
+
+// Contacts manages contact methods of user:
+// GET, POST /api/v1/contacts/USERID - list and add, PUT, DELETE /api/v1/contacts/USERID/ID - change and remove
+type Contacts struct {
+	users *user.Storage
+}
+
+func NewContacts(users *user.Storage) *Contacts {
+	return &Contacts{users: users}
+}
+
+func (c *Contacts) ServeHTTP(response http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(req.URL.Path, "/")
+	parts := strings.Split(path[strings.Index(path, "contacts"):], "/")[1:]
+
+	if len(parts) == 0 || parts[0] == "" || len(parts) > 2 {
+		c.write(response, http.StatusNotFound, &ErrMessage{Msg: errInvalidContactsPath.Error()})
+		return
+	}
+
+	userID := parts[0]
+
+	users, err := c.users.DBQuery(req.Context(), user.Options{UserID: userID, Limit: 1, Short: true, All: true})
+	switch {
+	case err != nil:
+		c.write(response, http.StatusInternalServerError, &ErrMessage{Msg: err.Error()})
+		return
+	case len(users.Result) == 0:
+		c.write(response, http.StatusNotFound, &ErrMessage{Msg: errUserNotFound.Error()})
+		return
+	}
+
+	if len(parts) == 1 {
+		switch req.Method {
+		case http.MethodGet:
+			c.list(response, req, userID)
+		case http.MethodPost:
+			c.add(response, req, userID)
+		default:
+			c.write(response, http.StatusMethodNotAllowed, &ErrMessage{Msg: errInvalidContactsPath.Error()})
+		}
+
+		return
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || id <= 0 {
+		c.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidContactID.Error()})
+		return
+	}
+
+	switch req.Method {
+	case http.MethodPut:
+		c.update(response, req, userID, id)
+	case http.MethodDelete:
+		c.result(response, c.users.DeleteContact(req.Context(), userID, id), http.StatusNoContent, nil)
+	default:
+		c.write(response, http.StatusMethodNotAllowed, &ErrMessage{Msg: errInvalidContactsPath.Error()})
+	}
+}
+
+func (c *Contacts) list(response http.ResponseWriter, req *http.Request, userID string) {
+	result, err := c.users.Contacts(req.Context(), userID)
+	if err != nil {
+		c.write(response, http.StatusInternalServerError, &ErrMessage{Msg: err.Error()})
+		return
+	}
+
+	c.write(response, http.StatusOK, result)
+}
+
+func (c *Contacts) add(response http.ResponseWriter, req *http.Request, userID string) {
+	contact := &user.Contact{}
+	if err := json.NewDecoder(req.Body).Decode(contact); err != nil {
+		c.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidBody.Error()})
+		return
+	}
+
+	if err := c.users.AddContact(req.Context(), userID, contact); err != nil {
+		c.write(response, http.StatusBadRequest, &ErrMessage{Msg: err.Error()})
+		return
+	}
+
+	c.write(response, http.StatusCreated, contact)
+}
+
+func (c *Contacts) update(response http.ResponseWriter, req *http.Request, userID string, id int64) {
+	contact := &user.Contact{}
+	if err := json.NewDecoder(req.Body).Decode(contact); err != nil {
+		c.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidBody.Error()})
+		return
+	}
+
+	contact.ID = id
+	c.result(response, c.users.UpdateContact(req.Context(), userID, contact), http.StatusOK, contact)
+}
+
+func (c *Contacts) result(response http.ResponseWriter, err error, code int, result interface{}) {
+	switch {
+	case user.IsContactNotFound(err):
+		c.write(response, http.StatusNotFound, &ErrMessage{Msg: err.Error()})
+	case err != nil:
+		c.write(response, http.StatusBadRequest, &ErrMessage{Msg: err.Error()})
+	case result == nil:
+		response.WriteHeader(code)
+	default:
+		c.write(response, code, result)
+	}
+}
+
+func (c *Contacts) write(response http.ResponseWriter, code int, result interface{}) {
+	resp, _ := json.Marshal(result)
+
+	response.WriteHeader(code)
+	_, _ = response.Write(resp)
+}
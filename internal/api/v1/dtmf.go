@@ -0,0 +1,196 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/events"
+	"github.com/ebogdanov/emu-oncall/internal/grafana"
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/outbox"
+)
+
+const (
+	dtmfChannel = "dtmf"
+
+	// dtmfEscalate leaves alert group untouched, so OnCall escalation chain goes to the next step
+	dtmfEscalate = "escalate"
+)
+
+var (
+	errEmptyCallID      = errors.New("empty-call-id")
+	errEmptyDigits      = errors.New("empty-digits")
+	errUnknownDigits    = errors.New("unknown-digits")
+	errIncidentNotFound = errors.New("incident-not-found")
+)
+
+var dtmfActions = map[string]string{
+	"1": grafana.ActionAcknowledge,
+	"2": dtmfEscalate,
+	"3": grafana.ActionSilence,
+}
+
+type dtmfResponse struct {
+	Action     string `json:"action,omitempty"`
+	IncidentID int    `json:"incident_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type DTMFRequest struct {
+	CallID string `json:"call_id"`
+	Digits string `json:"digits"`
+}
+
+// DTMF handles keys pressed during phone call, call is matched with notification by plugin call id
+type DTMF struct {
+	actionsLog    events.Service
+	notifications *outbox.Service
+	grafanaSvc    grafana.Service
+	logger        zerolog.Logger
+	pm            *metrics.Storage
+}
+
+func NewDTMF(actionsLog events.Service, notifications *outbox.Service, logger zerolog.Logger, gfSvc grafana.Service, promMetrics *metrics.Storage) *DTMF {
+	return &DTMF{
+		actionsLog:    actionsLog,
+		notifications: notifications,
+		grafanaSvc:    gfSvc,
+		logger:        logger.With().Str("component", "dtmf").Logger(),
+		pm:            promMetrics,
+	}
+}
+
+func (d *DTMF) ServeHTTP(response http.ResponseWriter, req *http.Request) {
+	d.pm.Notifications.WithLabelValues(dtmfChannel).Inc()
+
+	request, err := d.validate(req)
+	if err != nil {
+		d.write(response, http.StatusBadRequest, &dtmfResponse{Error: err.Error()})
+		return
+	}
+
+	result, code := d.process(req.Context(), request)
+	d.write(response, code, result)
+}
+
+func (d *DTMF) process(ctx context.Context, request *DTMFRequest) (*dtmfResponse, int) {
+	call, err := d.actionsLog.ByExternalID(ctx, request.CallID)
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("call_id", request.CallID).
+			Msg("Unable to find call for DTMF callback")
+
+		return &dtmfResponse{Error: err.Error()}, http.StatusNotFound
+	}
+
+	if call.IncidentID == 0 {
+		return &dtmfResponse{Error: errIncidentNotFound.Error()}, http.StatusNotFound
+	}
+
+	result := &dtmfResponse{IncidentID: call.IncidentID}
+
+	action, ok := dtmfActions[request.Digits]
+	if !ok {
+		result.Error = errUnknownDigits.Error()
+		d.logAction(call, request, "", false, result.Error)
+
+		return result, http.StatusBadRequest
+	}
+
+	result.Action = action
+
+	if action != dtmfEscalate {
+		_, err = d.grafanaSvc.AlertGroupAction(ctx, call.IncidentID, action, defaultSilence)
+		if err != nil {
+			d.logger.Error().
+				Err(err).
+				Str("call_id", request.CallID).
+				Str("action", action).
+				Int("incident_id", call.IncidentID).
+				Msg("Unable to perform alert group action")
+
+			result.Error = err.Error()
+			d.logAction(call, request, action, false, result.Error)
+
+			return result, http.StatusInternalServerError
+		}
+	}
+
+	d.logger.Info().
+		Str("call_id", request.CallID).
+		Str("user_id", call.UserID).
+		Str("action", action).
+		Int("incident_id", call.IncidentID).
+		Msg("Alert group action was requested by DTMF")
+
+	d.logAction(call, request, action, true, "DTMF "+request.Digits+": "+action)
+
+	if action != dtmfEscalate {
+		_ = d.notifications.Acknowledge(ctx, request.CallID)
+	}
+
+	return result, http.StatusOK
+}
+
+func (d *DTMF) logAction(call *events.Record, request *DTMFRequest, action string, success bool, msg string) {
+	_ = d.actionsLog.Add(&events.Record{
+		Timestamp:  time.Now(),
+		UserID:     call.UserID,
+		Recipient:  call.Recipient,
+		Channel:    dtmfChannel,
+		Plugin:     call.Plugin,
+		Success:    success,
+		Msg:        msg,
+		ExternalID: request.CallID,
+		Status:     action,
+		AlertID:    call.AlertID,
+		IncidentID: call.IncidentID,
+	})
+}
+
+func (d *DTMF) validate(req *http.Request) (*DTMFRequest, error) {
+	request := &DTMFRequest{}
+
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := req.ParseForm(); err != nil {
+			return nil, err
+		}
+
+		request.CallID = req.PostForm.Get("call_id")
+		request.Digits = req.PostForm.Get("digits")
+	}
+
+	request.Digits = strings.TrimSpace(request.Digits)
+
+	d.logger.Info().
+		Interface("request", request).
+		Msg("Incoming DTMF callback")
+
+	if request.CallID == "" {
+		return nil, errEmptyCallID
+	}
+
+	if request.Digits == "" {
+		return nil, errEmptyDigits
+	}
+
+	return request, nil
+}
+
+func (d *DTMF) write(response http.ResponseWriter, code int, result *dtmfResponse) {
+	resp, _ := json.Marshal(result)
+
+	response.WriteHeader(code)
+	_, _ = response.Write(resp)
+}
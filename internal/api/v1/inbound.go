@@ -0,0 +1,253 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
+	"github.com/ebogdanov/emu-oncall/internal/grafana"
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+const (
+	defaultSilence = time.Hour
+	silenceForever = "forever"
+	inboundUsage   = "Unknown command. Use: ACK <id>, RES <id> or SILENCE <id> [1h|forever]"
+)
+
+// Lookup for "ACK 13", "res #13", "SILENCE 13 1h"
+var (
+	regexpInboundCommand = regexp.MustCompile(`(?i)^\s*(ACK|RES|SILENCE)\s+#?(\d+)(?:\s+(\S+))?\s*$`)
+)
+
+var (
+	errEmptySender    = errors.New("empty-sender")
+	errUnknownCommand = errors.New("unknown-command")
+	errInvalidSilence = errors.New("invalid-silence-duration")
+)
+
+var inboundActions = map[string]string{
+	"ACK":     grafana.ActionAcknowledge,
+	"RES":     grafana.ActionResolve,
+	"SILENCE": grafana.ActionSilence,
+}
+
+var inboundConfirmations = map[string]string{
+	grafana.ActionAcknowledge: "acknowledged",
+	grafana.ActionResolve:     "resolved",
+	grafana.ActionSilence:     "silenced",
+}
+
+type inboundResponse struct {
+	Action     string `json:"action,omitempty"`
+	IncidentID int    `json:"incident_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type InboundRequest struct {
+	From string `json:"from"`
+	Text string `json:"text"`
+}
+
+type inboundCommand struct {
+	action     string
+	incidentID int
+	silence    time.Duration
+}
+
+// Inbound handles SMS replies forwarded by providers, commands are applied to OnCall alert groups
+type Inbound struct {
+	users      *user.Storage
+	dispatcher *delivery.Dispatcher
+	grafanaSvc grafana.Service
+	logger     zerolog.Logger
+	pm         *metrics.Storage
+}
+
+func NewInbound(dbData *user.Storage, dispatcher *delivery.Dispatcher, logger zerolog.Logger, gfSvc grafana.Service, promMetrics *metrics.Storage) *Inbound {
+	return &Inbound{
+		users:      dbData,
+		dispatcher: dispatcher,
+		grafanaSvc: gfSvc,
+		logger:     logger.With().Str("component", "inbound").Logger(),
+		pm:         promMetrics,
+	}
+}
+
+func (i *Inbound) ServeHTTP(response http.ResponseWriter, req *http.Request) {
+	i.pm.Notifications.WithLabelValues("inbound").Inc()
+
+	request, err := i.validate(req)
+	if err != nil {
+		i.logger.Error().Err(err).Msg("Unable to validate inbound sms")
+
+		resp, _ := json.Marshal(&inboundResponse{Error: err.Error()})
+		response.WriteHeader(http.StatusBadRequest)
+		_, _ = response.Write(resp)
+
+		return
+	}
+
+	result := i.process(req.Context(), req, request)
+	resp, _ := json.Marshal(result)
+
+	// Provider can't fix wrong command, so it's not asked to retry
+	response.WriteHeader(http.StatusOK)
+	_, _ = response.Write(resp)
+}
+
+func (i *Inbound) process(ctx context.Context, req *http.Request, request *InboundRequest) *inboundResponse {
+	// Only verified numbers can act on alert groups, number of several users is not trusted
+	recipient, err := i.users.WithPhone(ctx, request.From)
+	if err != nil || recipient.ID == "" {
+		i.logger.Warn().
+			Err(err).
+			Str("from", request.From).
+			Msg("Inbound sms from unknown sender")
+
+		if user.IsAmbiguous(err) {
+			return &inboundResponse{Error: err.Error()}
+		}
+
+		return &inboundResponse{Error: errUserNotFound.Error()}
+	}
+
+	// Reply goes to number which is preferred for sms, it may differ from sender
+	recipient.Prefer(plugin.ChannelSMS)
+
+	cmd, err := parseInboundCommand(request.Text)
+	if err != nil {
+		i.logger.Warn().
+			Err(err).
+			Str("from", request.From).
+			Str("text", request.Text).
+			Msg("Unable to parse inbound sms")
+
+		i.reply(ctx, req, recipient, "", inboundUsage)
+
+		return &inboundResponse{Error: err.Error()}
+	}
+
+	result := &inboundResponse{Action: cmd.action, IncidentID: cmd.incidentID}
+
+	alertGroup, err := i.grafanaSvc.AlertGroupAction(ctx, cmd.incidentID, cmd.action, cmd.silence)
+	if err != nil {
+		i.logger.Error().
+			Err(err).
+			Str("user_id", recipient.ID).
+			Str("action", cmd.action).
+			Int("incident_id", cmd.incidentID).
+			Msg("Unable to perform alert group action")
+
+		i.reply(ctx, req, recipient, "", fmt.Sprintf("Unable to %s #%d: %s", cmd.action, cmd.incidentID, err))
+		result.Error = err.Error()
+
+		return result
+	}
+
+	i.logger.Info().
+		Str("user_id", recipient.ID).
+		Str("action", cmd.action).
+		Int("incident_id", cmd.incidentID).
+		Msg("Alert group action was requested by sms")
+
+	i.reply(ctx, req, recipient, alertGroup.AlertID(), fmt.Sprintf("Alert group #%d %s", cmd.incidentID, inboundConfirmations[cmd.action]))
+
+	return result
+}
+
+// reply confirms command result by sms, with the same fallback chain as OnCall sms
+func (i *Inbound) reply(ctx context.Context, req *http.Request, recipient *user.Item, alertID, text string) {
+	_, err := i.dispatcher.Deliver(ctx, &delivery.Request{
+		Notification: plugin.Notification{
+			RequestID: requestID(req),
+			Type:      smsTextNotify,
+			User:      *recipient,
+			AlertID:   alertID,
+			Text:      text,
+		},
+	})
+
+	if err != nil {
+		i.logger.Error().
+			Err(err).
+			Str("user_id", recipient.ID).
+			Msg("Unable to send reply for inbound sms")
+	}
+}
+
+func (i *Inbound) validate(req *http.Request) (*InboundRequest, error) {
+	request := &InboundRequest{}
+
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := req.ParseForm(); err != nil {
+			return nil, err
+		}
+
+		request.From = req.PostForm.Get("from")
+		request.Text = req.PostForm.Get("text")
+	}
+
+	i.logger.Info().
+		Interface("request", request).
+		Msg("Incoming sms")
+
+	if request.From == "" {
+		return nil, errEmptySender
+	}
+
+	if request.Text == "" {
+		return nil, errEmptyMessage
+	}
+
+	return request, nil
+}
+
+func parseInboundCommand(text string) (*inboundCommand, error) {
+	matches := regexpInboundCommand.FindStringSubmatch(text)
+	if matches == nil {
+		return nil, errUnknownCommand
+	}
+
+	cmd := &inboundCommand{action: inboundActions[strings.ToUpper(matches[1])]}
+	cmd.incidentID, _ = strconv.Atoi(matches[2])
+
+	if cmd.action != grafana.ActionSilence {
+		if matches[3] != "" {
+			return nil, errUnknownCommand
+		}
+
+		return cmd, nil
+	}
+
+	switch duration := strings.ToLower(matches[3]); duration {
+	case "":
+		cmd.silence = defaultSilence
+	case silenceForever:
+		cmd.silence = 0
+	default:
+		silence, err := time.ParseDuration(duration)
+		if err != nil || silence <= 0 {
+			return nil, errInvalidSilence
+		}
+
+		cmd.silence = silence
+	}
+
+	return cmd, nil
+}
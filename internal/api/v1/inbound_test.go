@@ -0,0 +1,48 @@
+package v1
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ebogdanov/emu-oncall/internal/grafana"
+)
+
+func TestParseInboundCommand(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    inboundCommand
+		wantErr error
+	}{
+		{text: "ACK 13", want: inboundCommand{action: grafana.ActionAcknowledge, incidentID: 13}},
+		{text: "ack #13", want: inboundCommand{action: grafana.ActionAcknowledge, incidentID: 13}},
+		{text: "  Res 7 ", want: inboundCommand{action: grafana.ActionResolve, incidentID: 7}},
+		{text: "SILENCE 13", want: inboundCommand{action: grafana.ActionSilence, incidentID: 13, silence: defaultSilence}},
+		{text: "silence #13 30m", want: inboundCommand{action: grafana.ActionSilence, incidentID: 13, silence: 30 * time.Minute}},
+		{text: "SILENCE 13 forever", want: inboundCommand{action: grafana.ActionSilence, incidentID: 13}},
+		{text: "SILENCE 13 FOREVER", want: inboundCommand{action: grafana.ActionSilence, incidentID: 13}},
+		{text: "SILENCE 13 soon", wantErr: errInvalidSilence},
+		{text: "SILENCE 13 -1h", wantErr: errInvalidSilence},
+		{text: "SILENCE 13 0s", wantErr: errInvalidSilence},
+		{text: "ACK 13 now", wantErr: errUnknownCommand},
+		{text: "RES 13 1h", wantErr: errUnknownCommand},
+		{text: "SILENCE 13 1h more", wantErr: errUnknownCommand},
+		{text: "ACK", wantErr: errUnknownCommand},
+		{text: "ACK #", wantErr: errUnknownCommand},
+		{text: "ACK thirteen", wantErr: errUnknownCommand},
+		{text: "thanks", wantErr: errUnknownCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			cmd, err := parseInboundCommand(tt.text)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && *cmd != tt.want {
+				t.Errorf("command %+v, want %+v", *cmd, tt.want)
+			}
+		})
+	}
+}
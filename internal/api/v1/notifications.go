@@ -0,0 +1,125 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ebogdanov/emu-oncall/internal/outbox"
+)
+
+var (
+	errInvalidNotificationID = errors.New("invalid-notification-id")
+	errInvalidIncidentID     = errors.New("invalid-incident-id")
+	errInvalidTimeRange      = errors.New("invalid-time-range")
+)
+
+type notificationsResponse struct {
+	Count   int               `json:"count"`
+	Results []*outbox.Message `json:"results"`
+}
+
+// Notifications shows notifications with their delivery status:
+// /api/v1/notifications/?user_id=&incident_id=&channel=&status=&from=&to=&limit= and /api/v1/notifications/ID
+type Notifications struct {
+	notifications *outbox.Service
+}
+
+func NewNotifications(outboxSvc *outbox.Service) *Notifications {
+	return &Notifications{notifications: outboxSvc}
+}
+
+func (n *Notifications) ServeHTTP(response http.ResponseWriter, req *http.Request) {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	parts := strings.Split(path, "/")
+
+	if last := parts[len(parts)-1]; last != "notifications" {
+		n.one(response, req, last)
+		return
+	}
+
+	filter, err := n.filter(req)
+	if err != nil {
+		n.write(response, http.StatusBadRequest, &ErrMessage{Msg: err.Error()})
+		return
+	}
+
+	result, err := n.notifications.List(req.Context(), *filter)
+	switch {
+	case outbox.IsInvalidFilter(err):
+		n.write(response, http.StatusBadRequest, &ErrMessage{Msg: err.Error()})
+		return
+	case err != nil:
+		n.write(response, http.StatusInternalServerError, &ErrMessage{Msg: err.Error()})
+		return
+	}
+
+	n.write(response, http.StatusOK, &notificationsResponse{Count: len(result), Results: result})
+}
+
+func (n *Notifications) one(response http.ResponseWriter, req *http.Request, rawID string) {
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil || id <= 0 {
+		n.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidNotificationID.Error()})
+		return
+	}
+
+	msg, err := n.notifications.Get(req.Context(), id)
+	switch {
+	case outbox.IsNotFound(err):
+		n.write(response, http.StatusNotFound, &ErrMessage{Msg: err.Error()})
+	case err != nil:
+		n.write(response, http.StatusInternalServerError, &ErrMessage{Msg: err.Error()})
+	default:
+		n.write(response, http.StatusOK, msg)
+	}
+}
+
+func (n *Notifications) filter(req *http.Request) (*outbox.Filter, error) {
+	var (
+		query  = req.URL.Query()
+		filter = &outbox.Filter{
+			UserID:  query.Get("user_id"),
+			Channel: query.Get("channel"),
+		}
+		err error
+	)
+
+	for _, status := range query["status"] {
+		filter.Statuses = append(filter.Statuses, strings.Split(status, ",")...)
+	}
+
+	if value := query.Get("incident_id"); value != "" {
+		if filter.IncidentID, err = strconv.Atoi(strings.TrimPrefix(value, "#")); err != nil {
+			return nil, errInvalidIncidentID
+		}
+	}
+
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, errInvalidTimeRange
+		}
+	}
+
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, errInvalidTimeRange
+		}
+	}
+
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil {
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func (n *Notifications) write(response http.ResponseWriter, code int, result interface{}) {
+	resp, _ := json.Marshal(result)
+
+	response.WriteHeader(code)
+	_, _ = response.Write(resp)
+}
@@ -2,7 +2,8 @@ package v1
 
 import (
 	"context"
-	"database/sql"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 
@@ -10,13 +11,15 @@ import (
 
 	"github.com/ebogdanov/emu-oncall/internal/metrics"
 
-	"github.com/ebogdanov/emu-oncall/internal/events"
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
 	"github.com/ebogdanov/emu-oncall/internal/grafana"
+	"github.com/ebogdanov/emu-oncall/internal/outbox"
+	"github.com/ebogdanov/emu-oncall/internal/quiet"
+	"github.com/ebogdanov/emu-oncall/internal/redial"
 	"github.com/ebogdanov/emu-oncall/internal/user"
 
 	"strings"
 	"sync"
-	"time"
 
 	"errors"
 
@@ -28,12 +31,6 @@ var (
 	errUserPhoneNotVerified = errors.New("phonenumber-not-verified")
 	errInvalidEmail         = errors.New("invalid-email")
 	errEmptyMessage         = errors.New("empty-message-text")
-	errInvalidPushToken     = errors.New("push-token-not-found")
-)
-
-const (
-	sentSuccess = "Sent"
-	callSuccess = "Was called"
 )
 
 const (
@@ -42,14 +39,18 @@ const (
 )
 
 type notifyResponse struct {
+	ID    int64  `json:"id,omitempty"`
 	Error string `json:"error,omitempty"`
 }
 
 type Notify struct {
-	plugin     plugin.Plugin
+	dispatcher *delivery.Dispatcher
+	redial     *redial.Service
+	dedup      *delivery.Dedup
+	outbox     *outbox.Service
+	quiet      *quiet.Service
 	logger     zerolog.Logger
 	users      user.Storage
-	actionsLog events.Service
 	grafanaSvc grafana.Service
 	cache      sync.Map
 	pm         *metrics.Storage
@@ -60,13 +61,16 @@ type NotifyRequest struct {
 	Message string
 }
 
-func NewNotify(dbData *user.Storage, pl plugin.Plugin, logger zerolog.Logger, actionLogger events.Service, gfSvc grafana.Service, promMetrics *metrics.Storage) *Notify {
+func NewNotify(dbData *user.Storage, dispatcher *delivery.Dispatcher, redialSvc *redial.Service, dedup *delivery.Dedup, outboxSvc *outbox.Service, quietSvc *quiet.Service, logger zerolog.Logger, gfSvc grafana.Service, promMetrics *metrics.Storage) *Notify {
 	return &Notify{
 		users:      *dbData,
-		plugin:     pl,
+		dispatcher: dispatcher,
+		redial:     redialSvc,
+		dedup:      dedup,
+		outbox:     outboxSvc,
+		quiet:      quietSvc,
 		cache:      sync.Map{},
 		logger:     logger.With().Str("component", "notify").Logger(),
-		actionsLog: actionLogger,
 		grafanaSvc: gfSvc,
 		pm:         promMetrics,
 	}
@@ -124,6 +128,12 @@ func (n *Notify) notification(ctx context.Context, req *http.Request, notificati
 		return nil, err
 	}
 
+	// Best verified contact for this type replaces phone number of oncall_users. Copy is changed,
+	// since user may be shared with cache
+	recipient := *userResult
+	recipient.Prefer(notificationType)
+	userResult = &recipient
+
 	if !userResult.IsPhoneNumberVerified || userResult.PhoneNumber == "" {
 		return &notifyResponse{Error: errUserPhoneNotVerified.Error()}, nil
 	}
@@ -135,9 +145,24 @@ func (n *Notify) notification(ctx context.Context, req *http.Request, notificati
 		Msg("Sending message to user")
 
 	msg := request.Message
-	alertID := ""
 	incidentID := grafana.IncidentID(msg)
 
+	deliveryReq := &delivery.Request{
+		Notification: plugin.Notification{
+			RequestID:  requestID(req),
+			Type:       notificationType,
+			User:       *userResult,
+			Text:       msg,
+			IncidentID: incidentID,
+		},
+		Texts: map[string]string{},
+	}
+
+	// OnCall gets success, so that escalation chain goes on as if notification was delivered
+	if n.dedup.Suppress(deliveryReq) {
+		return &notifyResponse{}, nil
+	}
+
 	// Get details
 	alertGroup, err := n.grafanaSvc.IncidentDetails(ctx, incidentID)
 
@@ -149,63 +174,104 @@ func (n *Notify) notification(ctx context.Context, req *http.Request, notificati
 	}
 
 	if alertGroup != nil {
-		alertID = alertGroup.AlertID()
+		alertGroup.Fill(&deliveryReq.Notification)
 
 		n.logger.Info().
 			Int("incident_id", incidentID).
-			Str("alert_id", alertID).
+			Str("alert_id", deliveryReq.AlertID).
 			Msg("Loaded incident details from Grafana OnCall API")
+	}
+
+	n.render(deliveryReq, alertGroup)
+
+	// Dedup entry is released by notification as it was requested, quiet hours may change type and recipient
+	requested := *deliveryReq
 
-		if notificationType == phoneCallNotify {
-			// Render message
-			msg = alertGroup.PhoneCall(msg)
+	switch decision := n.quiet.Decide(ctx, deliveryReq); decision.Action {
+	case quiet.ActionDowngrade:
+		deliveryReq.Type = plugin.ChannelSMS
+	case quiet.ActionDelegate:
+		deliveryReq.User = *decision.Delegate
+	case quiet.ActionDefer:
+		id, err := n.outbox.EnqueueAt(ctx, deliveryReq, decision.Until)
+		if err == nil {
+			return &notifyResponse{ID: id}, nil
 		}
 
-		if notificationType == smsTextNotify {
-			// Render message
-			msg = alertGroup.SMSText(msg)
+		n.logger.Warn().
+			Err(err).
+			Str("request_id", deliveryReq.RequestID).
+			Msg("Unable to defer notification until quiet hours end, deliver it now")
+	}
+
+	// OnCall is not blocked by slow provider, worker delivers notification later
+	if n.outbox.Enabled() {
+		id, err := n.outbox.Enqueue(ctx, deliveryReq)
+		if err == nil {
+			n.logger.Info().
+				Int64("id", id).
+				Str("request_id", deliveryReq.RequestID).
+				Msg("Notification is stored in outbox")
+
+			return &notifyResponse{ID: id}, nil
 		}
+
+		n.logger.Warn().
+			Err(err).
+			Str("request_id", deliveryReq.RequestID).
+			Msg("Unable to store notification in outbox, deliver it now")
 	}
 
-	if notificationType == phoneCallNotify {
-		err = n.plugin.CallPhone(ctx, *userResult, alertID, msg)
-	} else {
-		err = n.plugin.SendSms(ctx, *userResult, alertID, msg)
+	// Notification is delivered even if it can't be stored, page is more important than its status
+	deliveryReq.NotificationID, _ = n.outbox.Track(ctx, deliveryReq)
+
+	step, err := n.dispatcher.Deliver(ctx, deliveryReq)
+	n.outbox.Finish(ctx, deliveryReq.NotificationID, step, err)
+
+	// Call is repeated when it was not answered, even if fallback delivered something else
+	if deliveryReq.Type == phoneCallNotify && !redial.Answered(deliveryReq, step, err) {
+		_ = n.redial.Schedule(ctx, deliveryReq)
 	}
 
 	if err != nil {
-		n.logger.Error().
-			Err(err).
-			Interface("email", request.Email).
-			Interface("phone", userResult.PhoneNumber).
-			Str("notification_type", notificationType).
-			Int("incident_id", incidentID).
-			Str("alert_id", alertID).
-			Msg("Unable to send notification")
+		n.dedup.Release(&requested)
+		return nil, err
+	}
 
-		if err == sql.ErrNoRows {
-			err = errInvalidPushToken
-		}
+	return &notifyResponse{ID: deliveryReq.NotificationID}, nil
+}
 
-		n.logAction(userResult.ID,
-			userResult.PhoneNumber, notificationType, false, err.Error())
+// render makes message for every channel, since fallback chain can use any of them
+func (n *Notify) render(req *delivery.Request, alertGroup grafana.Render) {
+	msg := req.Text
+	data := grafana.NewTemplateData(&req.Notification)
 
-		return nil, err
+	fallbacks := map[string]string{
+		plugin.ChannelPhone: msg,
+		plugin.ChannelSMS:   msg,
+		plugin.ChannelSlack: msg,
 	}
 
-	successStr := sentSuccess
-	if notificationType == phoneCallNotify {
-		successStr = callSuccess
+	if alertGroup != nil {
+		fallbacks[plugin.ChannelPhone] = alertGroup.PhoneCall(msg)
+		fallbacks[plugin.ChannelSMS] = alertGroup.SMSText(msg)
 	}
 
-	n.logger.Info().
-		Interface("notification_type", notificationType).
-		Interface("phone", userResult.PhoneNumber).
-		Msg(successStr)
+	for channel, fallback := range fallbacks {
+		req.Texts[channel] = n.grafanaSvc.Message(channel, data, fallback)
+	}
+}
+
+// requestID is taken from proxy header when present, so that plugin logs can be matched with access log
+func requestID(req *http.Request) string {
+	if id := req.Header.Get("X-Request-ID"); id != "" {
+		return id
+	}
 
-	n.logAction(userResult.ID, userResult.PhoneNumber, notificationType, true, successStr)
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
 
-	return &notifyResponse{}, nil
+	return hex.EncodeToString(b)
 }
 
 func (n *Notify) validate(_ context.Context, req *http.Request, _ string) (*NotifyRequest, error) {
@@ -250,20 +316,3 @@ func (n *Notify) user(ctx context.Context, email string) (*user.Item, error) {
 
 	return nil, errUserNotFound
 }
-
-func (n *Notify) logAction(userID, phoneNumber, route string, success bool, msg string) {
-	if n.actionsLog == nil {
-		return
-	}
-
-	record := &events.Record{
-		Timestamp: time.Now(),
-		UserID:    userID,
-		Recipient: phoneNumber,
-		Channel:   route,
-		Success:   success,
-		Msg:       msg,
-	}
-
-	_ = n.actionsLog.Add(record)
-}
@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ebogdanov/emu-oncall/internal/quiet"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+var (
+	errInvalidQuietPath = errors.New("invalid-quiet-path")
+	errInvalidWindowID  = errors.New("invalid-window-id")
+	errInvalidBody      = errors.New("invalid-request-body")
+)
+
+// Quiet manages quiet hours of user:
+// GET, PUT /api/v1/quiet/USERID - policy with windows, POST /api/v1/quiet/USERID/windows - add window,
+// DELETE /api/v1/quiet/USERID/windows/ID - remove window
+type Quiet struct {
+	quiet *quiet.Service
+	users *user.Storage
+}
+
+func NewQuiet(quietSvc *quiet.Service, users *user.Storage) *Quiet {
+	return &Quiet{quiet: quietSvc, users: users}
+}
+
+func (q *Quiet) ServeHTTP(response http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(req.URL.Path, "/")
+	parts := strings.Split(path[strings.Index(path, "quiet"):], "/")[1:]
+
+	if len(parts) == 0 || parts[0] == "" || (len(parts) > 1 && parts[1] != "windows") || len(parts) > 3 {
+		q.write(response, http.StatusNotFound, &ErrMessage{Msg: errInvalidQuietPath.Error()})
+		return
+	}
+
+	userID := parts[0]
+
+	users, err := q.users.DBQuery(req.Context(), user.Options{UserID: userID, Limit: 1, All: true})
+	switch {
+	case err != nil:
+		q.write(response, http.StatusInternalServerError, &ErrMessage{Msg: err.Error()})
+		return
+	case len(users.Result) == 0:
+		q.write(response, http.StatusNotFound, &ErrMessage{Msg: errUserNotFound.Error()})
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && req.Method == http.MethodGet:
+		q.policy(response, req, userID)
+	case len(parts) == 1 && req.Method == http.MethodPut:
+		q.save(response, req, userID)
+	case len(parts) == 2 && req.Method == http.MethodPost:
+		q.add(response, req, userID)
+	case len(parts) == 3 && req.Method == http.MethodDelete:
+		q.delete(response, req, userID, parts[2])
+	default:
+		q.write(response, http.StatusMethodNotAllowed, &ErrMessage{Msg: errInvalidQuietPath.Error()})
+	}
+}
+
+func (q *Quiet) policy(response http.ResponseWriter, req *http.Request, userID string) {
+	p, err := q.quiet.Policy(req.Context(), userID)
+	if err != nil {
+		q.write(response, http.StatusInternalServerError, &ErrMessage{Msg: err.Error()})
+		return
+	}
+
+	q.write(response, http.StatusOK, p)
+}
+
+func (q *Quiet) save(response http.ResponseWriter, req *http.Request, userID string) {
+	p := &quiet.Policy{}
+	if err := json.NewDecoder(req.Body).Decode(p); err != nil {
+		q.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidBody.Error()})
+		return
+	}
+
+	p.UserID = userID
+	if p.Timezone == "" {
+		p.Timezone = "UTC"
+	}
+
+	if err := q.quiet.SavePolicy(req.Context(), p); err != nil {
+		q.write(response, http.StatusBadRequest, &ErrMessage{Msg: err.Error()})
+		return
+	}
+
+	q.policy(response, req, userID)
+}
+
+func (q *Quiet) add(response http.ResponseWriter, req *http.Request, userID string) {
+	w := &quiet.Window{}
+	if err := json.NewDecoder(req.Body).Decode(w); err != nil {
+		q.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidBody.Error()})
+		return
+	}
+
+	if err := q.quiet.AddWindow(req.Context(), userID, w); err != nil {
+		q.write(response, http.StatusBadRequest, &ErrMessage{Msg: err.Error()})
+		return
+	}
+
+	q.write(response, http.StatusCreated, w)
+}
+
+func (q *Quiet) delete(response http.ResponseWriter, req *http.Request, userID, rawID string) {
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil || id <= 0 {
+		q.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidWindowID.Error()})
+		return
+	}
+
+	err = q.quiet.DeleteWindow(req.Context(), userID, id)
+	switch {
+	case quiet.IsNotFound(err):
+		q.write(response, http.StatusNotFound, &ErrMessage{Msg: err.Error()})
+	case err != nil:
+		q.write(response, http.StatusInternalServerError, &ErrMessage{Msg: err.Error()})
+	default:
+		response.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (q *Quiet) write(response http.ResponseWriter, code int, result interface{}) {
+	resp, _ := json.Marshal(result)
+
+	response.WriteHeader(code)
+	_, _ = response.Write(resp)
+}
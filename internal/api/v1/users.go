@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
 	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
 )
 
 // ErrMessage is error message object
@@ -13,16 +15,24 @@ type ErrMessage struct {
 }
 
 type Users struct {
-	db *user.Storage
+	db     *user.Storage
+	health *delivery.Health
 }
 
-func NewUsers(db *user.Storage) *Users {
-	return &Users{db: db}
+func NewUsers(db *user.Storage, health *delivery.Health) *Users {
+	return &Users{db: db, health: health}
 }
 
 func (u *Users) ServeHTTP(response http.ResponseWriter, req *http.Request) {
 	result, err := u.db.Filter(req.Context(), *req)
 
+	// OnCall should not route phone calls here while no plugin which makes them is healthy
+	if err == nil && !u.health.Healthy(plugin.ChannelPhone) {
+		for i := range result.Result {
+			result.Result[i].IsPhoneNumberVerified = false
+		}
+	}
+
 	if err == nil {
 		resp, err1 := json.Marshal(result)
 
@@ -0,0 +1,118 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+var errInvalidAdminPath = errors.New("invalid-admin-users-path")
+
+type usersAdminList struct {
+	Page    int           `json:"page"`
+	Results []user.Record `json:"results"`
+}
+
+// UsersAdmin manages oncall_users, it's served on admin token scope:
+// GET /api/v1/admin/users/?search=&role=&active=&page=, POST /api/v1/admin/users/,
+// GET, PATCH, DELETE /api/v1/admin/users/USERID, POST /api/v1/admin/users/USERID/deactivate
+type UsersAdmin struct {
+	db *user.Storage
+}
+
+func NewUsersAdmin(db *user.Storage) *UsersAdmin {
+	return &UsersAdmin{db: db}
+}
+
+func (u *UsersAdmin) ServeHTTP(response http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(req.URL.Path, "/")
+	parts := strings.Split(path[strings.Index(path, "users"):], "/")[1:]
+
+	switch {
+	case len(parts) == 0 && req.Method == http.MethodGet:
+		u.list(response, req)
+	case len(parts) == 0 && req.Method == http.MethodPost:
+		u.create(response, req)
+	case len(parts) == 1 && req.Method == http.MethodGet:
+		r, err := u.db.Record(req.Context(), parts[0])
+		u.result(response, err, http.StatusOK, r)
+	case len(parts) == 1 && (req.Method == http.MethodPatch || req.Method == http.MethodPut):
+		u.update(response, req, parts[0])
+	case len(parts) == 1 && req.Method == http.MethodDelete:
+		u.result(response, u.db.Delete(req.Context(), parts[0]), http.StatusNoContent, nil)
+	case len(parts) == 2 && parts[1] == "deactivate" && req.Method == http.MethodPost:
+		active := false
+		r, err := u.db.Update(req.Context(), parts[0], &user.Change{Active: &active})
+		u.result(response, err, http.StatusOK, r)
+	default:
+		u.write(response, http.StatusNotFound, &ErrMessage{Msg: errInvalidAdminPath.Error()})
+	}
+}
+
+func (u *UsersAdmin) list(response http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	search := user.Search{
+		Query: strings.TrimSpace(query.Get("search")),
+		Role:  query.Get("role"),
+		Page:  1,
+	}
+
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 0 {
+		search.Page = page
+	}
+
+	if active, err := strconv.ParseBool(query.Get("active")); err == nil {
+		search.Active = &active
+	}
+
+	result, err := u.db.SearchUsers(req.Context(), search)
+	u.result(response, err, http.StatusOK, &usersAdminList{Page: search.Page, Results: result})
+}
+
+func (u *UsersAdmin) create(response http.ResponseWriter, req *http.Request) {
+	// New user is active unless it's set explicitly
+	r := &user.Record{Active: true}
+	if err := json.NewDecoder(req.Body).Decode(r); err != nil {
+		u.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidBody.Error()})
+		return
+	}
+
+	u.result(response, u.db.Create(req.Context(), r), http.StatusCreated, r)
+}
+
+func (u *UsersAdmin) update(response http.ResponseWriter, req *http.Request, userID string) {
+	change := &user.Change{}
+	if err := json.NewDecoder(req.Body).Decode(change); err != nil {
+		u.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidBody.Error()})
+		return
+	}
+
+	r, err := u.db.Update(req.Context(), userID, change)
+	u.result(response, err, http.StatusOK, r)
+}
+
+func (u *UsersAdmin) result(response http.ResponseWriter, err error, code int, result interface{}) {
+	switch {
+	case user.IsNotFound(err):
+		u.write(response, http.StatusNotFound, &ErrMessage{Msg: err.Error()})
+	case user.IsInvalid(err):
+		u.write(response, http.StatusBadRequest, &ErrMessage{Msg: err.Error()})
+	case err != nil:
+		u.write(response, http.StatusInternalServerError, &ErrMessage{Msg: err.Error()})
+	case result == nil:
+		response.WriteHeader(code)
+	default:
+		u.write(response, code, result)
+	}
+}
+
+func (u *UsersAdmin) write(response http.ResponseWriter, code int, result interface{}) {
+	resp, _ := json.Marshal(result)
+
+	response.WriteHeader(code)
+	_, _ = response.Write(resp)
+}
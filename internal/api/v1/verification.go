@@ -0,0 +1,86 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ebogdanov/emu-oncall/internal/verification"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+var errInvalidVerificationPath = errors.New("invalid-verification-path")
+
+type verificationRequest struct {
+	Channel   string `json:"channel"`
+	ContactID int64  `json:"contact_id"`
+	Code      string `json:"code"`
+}
+
+type verificationResponse struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Verified  bool       `json:"verified"`
+}
+
+// Verification confirms phone number or contact method of user: POST /api/v1/verification/USERID sends code
+// by sms (default) or phone, POST /api/v1/verification/USERID/confirm checks it
+type Verification struct {
+	verification *verification.Service
+}
+
+func NewVerification(verificationSvc *verification.Service) *Verification {
+	return &Verification{verification: verificationSvc}
+}
+
+func (v *Verification) ServeHTTP(response http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(req.URL.Path, "/")
+	parts := strings.Split(path[strings.Index(path, "verification"):], "/")[1:]
+
+	if len(parts) == 0 || parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "confirm") {
+		v.write(response, http.StatusNotFound, &ErrMessage{Msg: errInvalidVerificationPath.Error()})
+		return
+	}
+
+	// Empty body means defaults: code for phone number of user by sms
+	body := &verificationRequest{Channel: plugin.ChannelSMS}
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil && !errors.Is(err, io.EOF) {
+		v.write(response, http.StatusBadRequest, &ErrMessage{Msg: errInvalidBody.Error()})
+		return
+	}
+
+	var (
+		result = &verificationResponse{}
+		err    error
+	)
+
+	if len(parts) == 1 {
+		var expires time.Time
+		if expires, err = v.verification.Send(req.Context(), parts[0], body.Channel, body.ContactID); err == nil {
+			result.ExpiresAt = &expires
+		}
+	} else {
+		err = v.verification.Confirm(req.Context(), parts[0], body.Code)
+		result.Verified = err == nil
+	}
+
+	switch {
+	case verification.IsNotFound(err):
+		v.write(response, http.StatusNotFound, &ErrMessage{Msg: err.Error()})
+	case verification.IsRejected(err):
+		v.write(response, http.StatusBadRequest, &ErrMessage{Msg: err.Error()})
+	case err != nil:
+		v.write(response, http.StatusInternalServerError, &ErrMessage{Msg: err.Error()})
+	default:
+		v.write(response, http.StatusOK, result)
+	}
+}
+
+func (v *Verification) write(response http.ResponseWriter, code int, result interface{}) {
+	resp, _ := json.Marshal(result)
+
+	response.WriteHeader(code)
+	_, _ = response.Write(resp)
+}
@@ -20,6 +20,7 @@ type App struct {
 	LogLevel     string
 	Version      string
 	AuthToken    string
+	AdminToken   string
 	LogPath      string
 	WriteTimeout time.Duration
 	Plugin       interface{}
@@ -30,6 +31,7 @@ func Parse() (*App, error) {
 	flag.String("config", "config/config.yml", "Path to config file")
 
 	flag.String("app.auth_token", os.Getenv("AUTH_TOKEN"), "Auth token used for API request authorizations")
+	flag.String("app.admin_token", os.Getenv("ADMIN_TOKEN"), "Auth token of user management API, it's disabled when token is blank")
 	flag.String("app.port", ":8880", "Application port")
 	flag.String("app.hostname", "", "Application hostname")
 	flag.String("app.log_level", "debug", "The minimum logging level")
@@ -61,6 +63,7 @@ func Parse() (*App, error) {
 		LogLevel:     viper.GetString("app.log_level"),
 		WriteTimeout: viper.GetDuration("app.write_timeout"),
 		AuthToken:    viper.GetString("app.auth_token"),
+		AdminToken:   viper.GetString("app.admin_token"),
 		Plugin:       viper.Get("plugin"),
 	}
 
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -11,6 +13,19 @@ type Grafana struct {
 	OnCall          *OnCall
 
 	Schedules map[string]*ScheduleEntry
+
+	// Templates are text/template messages by name: phone, sms, slack, duty_start, duty_end
+	Templates map[string]string
+
+	UserSync *UserSync
+}
+
+// UserSync is periodic import of Grafana organization users into oncall_users
+type UserSync struct {
+	Enabled  bool
+	Interval time.Duration
+	// DryRun only reports changes, nothing is written
+	DryRun bool
 }
 
 type ScheduleEntry struct {
@@ -21,12 +36,6 @@ type ScheduleEntry struct {
 	Details     bool
 }
 
-type NotificationTemplate struct {
-	Start string
-	Title string
-	End   string
-}
-
 type OnCall struct {
 	URL   string
 	Token string
@@ -40,6 +49,11 @@ func ParseGrafana() *Grafana {
 	viper.SetDefault("grafana.oncall.header_token", "") // Grafana OnCall API Token
 	viper.SetDefault("grafana.oncall.schedules", map[string]string{})
 	viper.SetDefault("grafana.oncall.incident_details", false) // Load or not incident details from OnCall to make it detailed
+	viper.SetDefault("grafana.templates", map[string]string{}) // Message templates, original OnCall text is used when not set
+
+	viper.SetDefault("grafana.user_sync.enabled", false)  // Import users from Grafana organization
+	viper.SetDefault("grafana.user_sync.interval", "15m") // How often users are synced
+	viper.SetDefault("grafana.user_sync.dry_run", false)  // Log and count changes without writing them
 
 	cfg := &Grafana{
 		URL:   viper.GetString("grafana.url"),
@@ -50,6 +64,12 @@ func ParseGrafana() *Grafana {
 			Token: viper.GetString("grafana.oncall.header_token"),
 		},
 		IncidentDetails: viper.GetBool("grafana.oncall.incident_details"),
+		Templates:       viper.GetStringMapString("grafana.templates"),
+		UserSync: &UserSync{
+			Enabled:  viper.GetBool("grafana.user_sync.enabled"),
+			Interval: viper.GetDuration("grafana.user_sync.interval"),
+			DryRun:   viper.GetBool("grafana.user_sync.dry_run"),
+		},
 	}
 
 	cfg.Schedules = make(map[string]*ScheduleEntry)
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type Notify struct {
+	// HealthInterval is how often plugins health is checked
+	HealthInterval time.Duration
+	Redial         Redial
+	Outbox         Outbox
+	SMS            SMS
+	Speech         Speech
+	Quiet          Quiet
+	Verification   Verification
+	// Dedup is window per notification type, repeated notification of the same incident to the same user is suppressed
+	Dedup map[string]time.Duration
+
+	// Fallback is ordered list of delivery steps per notification type (phone, sms),
+	// step is "channel" or "channel@instance", e.g. "sms@backup_sms"
+	Fallback map[string][]string
+}
+
+// Redial is policy of repeating unanswered phone calls
+type Redial struct {
+	// Attempts is max count of calls including the first one, redial is disabled when it's less than 2
+	Attempts int
+	Delay    time.Duration
+	// Severities limits policy to alerts with these severities, empty means all alerts
+	Severities []string
+}
+
+// Outbox is asynchronous delivery: notification is stored in database and OnCall gets response immediately
+type Outbox struct {
+	Enabled bool
+	Workers int
+	// MaxAttempts is count of delivery attempts (each walks through fallback chain) before message is dead
+	MaxAttempts int
+	// Backoff is delay after the first failed attempt, it's doubled after every next one up to MaxBackoff
+	Backoff      time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+}
+
+// SMS is preparation of sms text before it's passed to plugin
+type SMS struct {
+	// Translit replaces Cyrillic with Latin, so that message is sent in GSM-7 instead of UCS-2
+	Translit bool
+	// MaxSegments limits message length, 0 is unlimited
+	MaxSegments int
+	// Instances override options for plugin instance
+	Instances map[string]SMS
+}
+
+// Speech is preparation of phone call text for text-to-speech engines
+type Speech struct {
+	Enabled bool
+	// Language of numbers and abbreviations: en, ru
+	Language  string
+	MaxLength int
+	// SSML is passed to plugins in addition to plain text
+	SSML bool
+	// Instances override options for plugin instance
+	Instances map[string]Speech
+}
+
+// Quiet is what happens with notification during user quiet hours or do-not-disturb period,
+// users can override actions by their own policy
+type Quiet struct {
+	// Critical and Informational are actions: deliver, downgrade, defer, delegate
+	Critical      string
+	Informational string
+	// CriticalSeverities are severities of critical alerts, alert without loaded severity is critical as well
+	CriticalSeverities []string
+}
+
+// Verification is phone number confirmation with one-time code
+type Verification struct {
+	// Instance is plugin which sends codes to phone numbers, Contacts is plugin per type of other contact methods
+	Instance    string
+	Contacts    map[string]string
+	CodeLength  int
+	TTL         time.Duration
+	MaxAttempts int
+	// ResendInterval is min time between codes for the same user
+	ResendInterval time.Duration
+}
+
+func ParseNotify() *Notify {
+	viper.SetDefault("notify.fallback", map[string][]string{})
+	viper.SetDefault("notify.health_interval", time.Minute)
+	viper.SetDefault("notify.redial.attempts", 0)
+	viper.SetDefault("notify.redial.delay", 2*time.Minute)
+	viper.SetDefault("notify.redial.severities", []string{})
+	viper.SetDefault("notify.outbox.enabled", false)
+	viper.SetDefault("notify.outbox.workers", 4)
+	viper.SetDefault("notify.outbox.max_attempts", 5)
+	viper.SetDefault("notify.outbox.backoff", 10*time.Second)
+	viper.SetDefault("notify.outbox.max_backoff", 10*time.Minute)
+	viper.SetDefault("notify.outbox.poll_interval", time.Second)
+	viper.SetDefault("notify.sms.translit", false)
+	viper.SetDefault("notify.sms.max_segments", 0)
+	viper.SetDefault("notify.sms.instances", map[string]interface{}{})
+	viper.SetDefault("notify.speech.enabled", false)
+	viper.SetDefault("notify.speech.language", "en")
+	viper.SetDefault("notify.speech.max_length", 0)
+	viper.SetDefault("notify.speech.ssml", false)
+	viper.SetDefault("notify.speech.instances", map[string]interface{}{})
+	viper.SetDefault("notify.dedup", map[string]string{})
+	viper.SetDefault("notify.quiet.critical", "deliver")
+	viper.SetDefault("notify.quiet.informational", "defer")
+	viper.SetDefault("notify.quiet.critical_severities", []string{"critical"})
+	viper.SetDefault("notify.verification.instance", "default")
+	viper.SetDefault("notify.verification.code_length", 6)
+	viper.SetDefault("notify.verification.ttl", 10*time.Minute)
+	viper.SetDefault("notify.verification.max_attempts", 5)
+	viper.SetDefault("notify.verification.resend_interval", time.Minute)
+
+	cfg := &Notify{
+		HealthInterval: viper.GetDuration("notify.health_interval"),
+		Redial: Redial{
+			Attempts:   viper.GetInt("notify.redial.attempts"),
+			Delay:      viper.GetDuration("notify.redial.delay"),
+			Severities: viper.GetStringSlice("notify.redial.severities"),
+		},
+		Outbox: Outbox{
+			Enabled:      viper.GetBool("notify.outbox.enabled"),
+			Workers:      viper.GetInt("notify.outbox.workers"),
+			MaxAttempts:  viper.GetInt("notify.outbox.max_attempts"),
+			Backoff:      viper.GetDuration("notify.outbox.backoff"),
+			MaxBackoff:   viper.GetDuration("notify.outbox.max_backoff"),
+			PollInterval: viper.GetDuration("notify.outbox.poll_interval"),
+		},
+		SMS:      parseSMS("notify.sms", SMS{}),
+		Speech:   parseSpeech("notify.speech", Speech{}),
+		Dedup:    make(map[string]time.Duration),
+		Fallback: make(map[string][]string),
+		Quiet: Quiet{
+			Critical:           viper.GetString("notify.quiet.critical"),
+			Informational:      viper.GetString("notify.quiet.informational"),
+			CriticalSeverities: viper.GetStringSlice("notify.quiet.critical_severities"),
+		},
+		Verification: Verification{
+			Instance:       viper.GetString("notify.verification.instance"),
+			Contacts:       viper.GetStringMapString("notify.verification.contacts"),
+			CodeLength:     viper.GetInt("notify.verification.code_length"),
+			TTL:            viper.GetDuration("notify.verification.ttl"),
+			MaxAttempts:    viper.GetInt("notify.verification.max_attempts"),
+			ResendInterval: viper.GetDuration("notify.verification.resend_interval"),
+		},
+	}
+
+	for notificationType := range viper.GetStringMap("notify.dedup") {
+		cfg.Dedup[notificationType] = viper.GetDuration("notify.dedup." + notificationType)
+	}
+
+	// Instance inherits options which are not set for it
+	cfg.SMS.Instances = make(map[string]SMS)
+	for instance := range viper.GetStringMap("notify.sms.instances") {
+		cfg.SMS.Instances[instance] = parseSMS("notify.sms.instances."+instance, cfg.SMS)
+	}
+
+	cfg.Speech.Instances = make(map[string]Speech)
+	for instance := range viper.GetStringMap("notify.speech.instances") {
+		cfg.Speech.Instances[instance] = parseSpeech("notify.speech.instances."+instance, cfg.Speech)
+	}
+
+	for notificationType := range viper.GetStringMap("notify.fallback") {
+		cfg.Fallback[notificationType] = viper.GetStringSlice("notify.fallback." + notificationType)
+	}
+
+	return cfg
+}
+
+// parseSMS reads options under key, options which are not set are taken from parent
+func parseSMS(key string, parent SMS) SMS {
+	item := SMS{Translit: parent.Translit, MaxSegments: parent.MaxSegments}
+
+	if viper.IsSet(key + ".translit") {
+		item.Translit = viper.GetBool(key + ".translit")
+	}
+
+	if viper.IsSet(key + ".max_segments") {
+		item.MaxSegments = viper.GetInt(key + ".max_segments")
+	}
+
+	return item
+}
+
+// parseSpeech reads options under key, options which are not set are taken from parent
+func parseSpeech(key string, parent Speech) Speech {
+	item := Speech{Enabled: parent.Enabled, Language: parent.Language, MaxLength: parent.MaxLength, SSML: parent.SSML}
+
+	if viper.IsSet(key + ".enabled") {
+		item.Enabled = viper.GetBool(key + ".enabled")
+	}
+
+	if viper.IsSet(key + ".language") {
+		item.Language = viper.GetString(key + ".language")
+	}
+
+	if viper.IsSet(key + ".max_length") {
+		item.MaxLength = viper.GetInt(key + ".max_length")
+	}
+
+	if viper.IsSet(key + ".ssml") {
+		item.SSML = viper.GetBool(key + ".ssml")
+	}
+
+	return item
+}
@@ -0,0 +1,119 @@
+package delivery
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/events"
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+)
+
+const (
+	statusDuplicate = "duplicate"
+	dedupPruneEvery = time.Minute
+)
+
+type dedupKey struct {
+	userID     string
+	channel    string
+	incidentID int
+}
+
+// Dedup suppresses notifications repeated by OnCall escalation chain for the same user, channel and incident
+type Dedup struct {
+	windows    map[string]time.Duration
+	actionsLog events.Service
+	logger     zerolog.Logger
+	pm         *metrics.Storage
+
+	mu     sync.Mutex
+	seen   map[dedupKey]time.Time
+	pruned time.Time
+}
+
+func NewDedup(windows map[string]time.Duration, actionsLog events.Service, l zerolog.Logger, pm *metrics.Storage) *Dedup {
+	return &Dedup{
+		windows:    windows,
+		actionsLog: actionsLog,
+		logger:     l.With().Str("component", "dedup").Logger(),
+		pm:         pm,
+		seen:       make(map[dedupKey]time.Time),
+		pruned:     time.Now(),
+	}
+}
+
+// Suppress reports whether the same notification was accepted within window, suppression is recorded in events.
+// Notification without incident number is never suppressed
+func (d *Dedup) Suppress(req *Request) bool {
+	window := d.windows[req.Type]
+	if window <= 0 || req.IncidentID == 0 {
+		return false
+	}
+
+	key := dedupKey{userID: req.User.ID, channel: req.Type, incidentID: req.IncidentID}
+	now := time.Now()
+
+	d.mu.Lock()
+	d.prune(now)
+
+	accepted, found := d.seen[key]
+	if !found || now.Sub(accepted) >= window {
+		d.seen[key] = now
+		d.mu.Unlock()
+
+		return false
+	}
+	d.mu.Unlock()
+
+	d.pm.Notifications.WithLabelValues(statusDuplicate).Inc()
+
+	d.logger.Info().
+		Str("user_id", req.User.ID).
+		Str("notification_type", req.Type).
+		Int("incident_id", req.IncidentID).
+		Str("request_id", req.RequestID).
+		Time("accepted_at", accepted).
+		Msg("Duplicate notification is suppressed")
+
+	if d.actionsLog != nil {
+		_ = d.actionsLog.Add(&events.Record{
+			Timestamp:  now,
+			UserID:     req.User.ID,
+			Recipient:  req.User.PhoneNumber,
+			Channel:    req.Type,
+			Success:    true,
+			Msg:        fmt.Sprintf("Duplicate within %s is suppressed", window),
+			Status:     statusDuplicate,
+			AlertID:    req.AlertID,
+			IncidentID: req.IncidentID,
+		})
+	}
+
+	return true
+}
+
+// Release forgets notification, so that OnCall retry after failed delivery is not suppressed
+func (d *Dedup) Release(req *Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.seen, dedupKey{userID: req.User.ID, channel: req.Type, incidentID: req.IncidentID})
+}
+
+// prune drops expired entries, it's called under lock
+func (d *Dedup) prune(now time.Time) {
+	if now.Sub(d.pruned) < dedupPruneEvery {
+		return
+	}
+
+	for key, accepted := range d.seen {
+		if now.Sub(accepted) >= d.windows[key.channel] {
+			delete(d.seen, key)
+		}
+	}
+
+	d.pruned = now
+}
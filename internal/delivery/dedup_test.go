@@ -0,0 +1,93 @@
+package delivery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+func newTestRequest(userID, notificationType string, incidentID int) *Request {
+	return &Request{Notification: plugin.Notification{Type: notificationType, User: user.Item{ID: userID}, IncidentID: incidentID}}
+}
+
+func TestDedupSuppress(t *testing.T) {
+	d := NewDedup(map[string]time.Duration{plugin.ChannelPhone: time.Minute}, nil, zerolog.Nop(), testMetrics)
+
+	req := newTestRequest("U1", plugin.ChannelPhone, 13)
+
+	if d.Suppress(req) {
+		t.Fatal("the first notification is suppressed")
+	}
+
+	if !d.Suppress(req) {
+		t.Error("repeated notification is not suppressed")
+	}
+
+	for _, other := range []*Request{
+		newTestRequest("U2", plugin.ChannelPhone, 13),
+		newTestRequest("U1", plugin.ChannelPhone, 14),
+		newTestRequest("U1", plugin.ChannelSMS, 13),
+	} {
+		if d.Suppress(other) {
+			t.Errorf("notification %s/%s/%d is suppressed", other.User.ID, other.Type, other.IncidentID)
+		}
+	}
+
+	// Notification without incident number and channel without window are never suppressed
+	for _, other := range []*Request{newTestRequest("U1", plugin.ChannelPhone, 0), newTestRequest("U1", plugin.ChannelSMS, 13)} {
+		if d.Suppress(other) {
+			t.Errorf("notification %s/%d is suppressed", other.Type, other.IncidentID)
+		}
+	}
+
+	// Window is over
+	d.seen[dedupKey{userID: "U1", channel: plugin.ChannelPhone, incidentID: 13}] = time.Now().Add(-time.Minute)
+
+	if d.Suppress(req) {
+		t.Error("notification after window is suppressed")
+	}
+}
+
+func TestDedupRelease(t *testing.T) {
+	d := NewDedup(map[string]time.Duration{plugin.ChannelSMS: time.Hour}, nil, zerolog.Nop(), testMetrics)
+	req := newTestRequest("U1", plugin.ChannelSMS, 13)
+
+	d.Suppress(req)
+	d.Release(req)
+
+	if d.Suppress(req) {
+		t.Error("released notification is suppressed")
+	}
+}
+
+func TestDedupPrune(t *testing.T) {
+	d := NewDedup(map[string]time.Duration{plugin.ChannelPhone: time.Minute, plugin.ChannelSMS: time.Hour}, nil,
+		zerolog.Nop(), testMetrics)
+
+	now := time.Now()
+	expired := dedupKey{userID: "U1", channel: plugin.ChannelPhone, incidentID: 1}
+	active := dedupKey{userID: "U1", channel: plugin.ChannelSMS, incidentID: 1}
+
+	d.seen[expired] = now.Add(-2 * time.Minute)
+	d.seen[active] = now.Add(-2 * time.Minute)
+
+	d.prune(now)
+
+	if len(d.seen) != 2 {
+		t.Fatalf("entries are pruned before %s: %v", dedupPruneEvery, d.seen)
+	}
+
+	d.prune(now.Add(dedupPruneEvery))
+
+	if _, ok := d.seen[expired]; ok {
+		t.Error("expired entry is kept")
+	}
+
+	if _, ok := d.seen[active]; !ok {
+		t.Error("entry within window is pruned")
+	}
+}
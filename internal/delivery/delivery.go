@@ -0,0 +1,329 @@
+package delivery
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/config"
+	"github.com/ebogdanov/emu-oncall/internal/events"
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/sms"
+	"github.com/ebogdanov/emu-oncall/internal/speech"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+const (
+	sentSuccess = "Sent"
+	callSuccess = "Was called"
+)
+
+var (
+	errUnknownChannel   = errors.New("unknown notification channel")
+	errUnknownInstance  = errors.New("unknown plugin instance")
+	errEmptyChain       = errors.New("fallback chain is empty")
+	errInvalidPushToken = errors.New("push-token-not-found")
+	errUnknownLanguage  = errors.New("unknown speech language")
+)
+
+// Step is one delivery attempt in fallback chain: method of plugin instance
+type Step struct {
+	Channel  string
+	Instance string
+}
+
+func (s Step) String() string {
+	if s.Instance == plugin.DefaultInstance {
+		return s.Channel
+	}
+
+	return s.Channel + "@" + s.Instance
+}
+
+// Request is notification which should be delivered to user, Channel and Step are set for every step.
+// Attempt is kept as is, it's 1 when caller does not retry
+type Request struct {
+	plugin.Notification
+	// Texts are messages rendered for every channel, Text is used when channel has no own text
+	Texts map[string]string `json:"texts,omitempty"`
+	// Result is reported by plugin for the last attempt
+	Result plugin.Result `json:"-"`
+}
+
+func (r *Request) text(channel string) string {
+	if t, ok := r.Texts[channel]; ok {
+		return t
+	}
+
+	return r.Text
+}
+
+// Dispatcher delivers notification with configured fallback chain, every attempt is recorded in events
+type Dispatcher struct {
+	plugins    map[string]plugin.Plugin
+	chains     map[string][]Step
+	sms        config.SMS
+	speech     config.Speech
+	actionsLog events.Service
+	logger     zerolog.Logger
+	pm         *metrics.Storage
+}
+
+func New(cfg *config.Notify, plugins map[string]plugin.Plugin, actionsLog events.Service, l zerolog.Logger, pm *metrics.Storage) (*Dispatcher, error) {
+	d := &Dispatcher{
+		plugins:    plugins,
+		chains:     make(map[string][]Step),
+		sms:        cfg.SMS,
+		speech:     cfg.Speech,
+		actionsLog: actionsLog,
+		logger:     l.With().Str("component", "delivery").Logger(),
+		pm:         pm,
+	}
+
+	if !speech.Supported(cfg.Speech.Language) {
+		return nil, fmt.Errorf("notify.speech.language: %w: %q", errUnknownLanguage, cfg.Speech.Language)
+	}
+
+	for instance, item := range cfg.Speech.Instances {
+		if !speech.Supported(item.Language) {
+			return nil, fmt.Errorf("notify.speech.instances.%s.language: %w: %q", instance, errUnknownLanguage, item.Language)
+		}
+	}
+
+	for notificationType, steps := range cfg.Fallback {
+		chain, err := d.parseChain(steps)
+		if err != nil {
+			return nil, fmt.Errorf("notify.fallback.%s: %w", notificationType, err)
+		}
+
+		d.chains[notificationType] = chain
+	}
+
+	return d, nil
+}
+
+func (d *Dispatcher) parseChain(steps []string) ([]Step, error) {
+	if len(steps) == 0 {
+		return nil, errEmptyChain
+	}
+
+	chain := make([]Step, 0, len(steps))
+
+	for _, item := range steps {
+		channel, instance, found := strings.Cut(strings.TrimSpace(item), "@")
+		if !found {
+			instance = plugin.DefaultInstance
+		}
+
+		switch channel {
+		case plugin.ChannelPhone, plugin.ChannelSMS, plugin.ChannelSlack:
+		default:
+			return nil, fmt.Errorf("%w: %q", errUnknownChannel, channel)
+		}
+
+		if _, ok := d.plugins[instance]; !ok {
+			return nil, fmt.Errorf("%w: %q", errUnknownInstance, instance)
+		}
+
+		chain = append(chain, Step{Channel: channel, Instance: instance})
+	}
+
+	return chain, nil
+}
+
+// Chain returns delivery steps for notification type, without configuration it's single step with default plugin
+func (d *Dispatcher) Chain(notificationType string) []Step {
+	if chain, ok := d.chains[notificationType]; ok {
+		return chain
+	}
+
+	return []Step{{Channel: notificationType, Instance: plugin.DefaultInstance}}
+}
+
+// Deliver walks through fallback chain until first successful attempt, which is returned
+func (d *Dispatcher) Deliver(ctx context.Context, req *Request) (Step, error) {
+	var errs []error
+
+	for i, step := range d.Chain(req.Type) {
+		if i > 0 {
+			d.pm.Notifications.WithLabelValues("fallback").Inc()
+		}
+
+		err := d.attempt(ctx, req, step, i+1)
+		if err == nil {
+			return step, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", step, err))
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return Step{}, errors.Join(errs...)
+}
+
+// DeliverStep makes single attempt without fallback, e.g. to redial
+func (d *Dispatcher) DeliverStep(ctx context.Context, req *Request, step Step, attempt int) error {
+	if _, ok := d.plugins[step.Instance]; !ok {
+		return fmt.Errorf("%w: %q", errUnknownInstance, step.Instance)
+	}
+
+	req.Attempt = attempt
+
+	return d.attempt(ctx, req, step, 1)
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, req *Request, step Step, index int) error {
+	n := req.Notification
+	n.Version = plugin.NotificationVersion
+	n.Channel = step.Channel
+	n.Step = index
+
+	if n.Attempt == 0 {
+		n.Attempt = 1
+	}
+	n.Text = req.text(step.Channel)
+
+	switch step.Channel {
+	case plugin.ChannelSMS:
+		d.prepareSMS(&n, step)
+	case plugin.ChannelPhone:
+		d.prepareSpeech(&n, step)
+	}
+
+	ctx, result := plugin.WithResult(ctx)
+
+	err := plugin.AsNotifier(d.plugins[step.Instance]).Notify(ctx, &n)
+	req.Result = *result
+
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errInvalidPushToken
+	}
+
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("email", req.User.Email).
+			Str("phone", req.User.PhoneNumber).
+			Str("notification_type", req.Type).
+			Str("step", step.String()).
+			Int("attempt", n.Attempt).
+			Str("alert_id", req.AlertID).
+			Str("request_id", req.RequestID).
+			Str("status", result.Status).
+			Msg("Unable to send notification")
+
+		d.logAction(&n, step, false, err.Error(), result)
+
+		return err
+	}
+
+	successStr := sentSuccess
+	if step.Channel == plugin.ChannelPhone {
+		successStr = callSuccess
+	}
+
+	d.logger.Info().
+		Str("notification_type", req.Type).
+		Str("step", step.String()).
+		Int("attempt", n.Attempt).
+		Str("phone", req.User.PhoneNumber).
+		Str("request_id", req.RequestID).
+		Str("status", result.Status).
+		Msg(successStr)
+
+	d.logAction(&n, step, true, successStr, result)
+
+	return nil
+}
+
+// prepareSMS transliterates and truncates sms text, so that it's not split into many expensive segments
+func (d *Dispatcher) prepareSMS(n *plugin.Notification, step Step) {
+	msg := sms.Prepare(n.Text, d.smsOptions(step.Instance, &n.User))
+
+	n.Text = msg.Text
+	n.Encoding = msg.Encoding
+	n.Segments = msg.Segments
+
+	d.pm.SMSSegments.WithLabelValues(step.Instance, msg.Encoding).Add(float64(msg.Segments))
+
+	if msg.Segments > 1 {
+		d.logger.Debug().
+			Str("step", step.String()).
+			Str("encoding", msg.Encoding).
+			Int("segments", msg.Segments).
+			Str("request_id", n.RequestID).
+			Msg("Sms is sent in several segments")
+	}
+}
+
+// smsOptions are options of plugin instance, user setting overrides transliteration
+func (d *Dispatcher) smsOptions(instance string, u *user.Item) sms.Options {
+	cfg, ok := d.sms.Instances[instance]
+	if !ok {
+		cfg = d.sms
+	}
+
+	opts := sms.Options{Translit: cfg.Translit, MaxSegments: cfg.MaxSegments}
+	if u.SMSTranslit != nil {
+		opts.Translit = *u.SMSTranslit
+	}
+
+	return opts
+}
+
+// prepareSpeech makes phone call text readable by TTS engine
+func (d *Dispatcher) prepareSpeech(n *plugin.Notification, step Step) {
+	cfg, ok := d.speech.Instances[step.Instance]
+	if !ok {
+		cfg = d.speech
+	}
+
+	if !cfg.Enabled {
+		return
+	}
+
+	opts := speech.Options{Language: cfg.Language, MaxLength: cfg.MaxLength}
+	n.Text = speech.Prepare(n.Text, opts)
+
+	if cfg.SSML {
+		n.SSML = speech.SSML(n.Text, opts)
+	}
+}
+
+func (d *Dispatcher) logAction(n *plugin.Notification, step Step, success bool, msg string, result *plugin.Result) {
+	if d.actionsLog == nil {
+		return
+	}
+
+	recipient := n.User.PhoneNumber
+	if step.Channel == plugin.ChannelSlack {
+		recipient = n.User.ID
+	}
+
+	record := &events.Record{
+		Timestamp:      time.Now(),
+		UserID:         n.User.ID,
+		Recipient:      recipient,
+		Channel:        step.Channel,
+		Plugin:         step.Instance,
+		Success:        success,
+		Msg:            msg,
+		ExternalID:     result.ExternalID,
+		Status:         result.Status,
+		AlertID:        n.AlertID,
+		IncidentID:     n.IncidentID,
+		Segments:       n.Segments,
+		NotificationID: n.NotificationID,
+	}
+
+	_ = d.actionsLog.Add(record)
+}
@@ -0,0 +1,74 @@
+package delivery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/config"
+	"github.com/ebogdanov/emu-oncall/internal/speech"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+// recordingPlugin keeps notifications and fails those of failChannel
+type recordingPlugin struct {
+	fakePlugin
+
+	failChannel string
+	received    []plugin.Notification
+}
+
+func (r *recordingPlugin) Notify(ctx context.Context, n *plugin.Notification) error {
+	r.received = append(r.received, *n)
+	plugin.ResultFromContext(ctx).Status = n.Channel + " status"
+
+	if n.Channel == r.failChannel {
+		return errProviderDown
+	}
+
+	return nil
+}
+
+func TestDeliverKeepsAttemptAndSetsStep(t *testing.T) {
+	p := &recordingPlugin{failChannel: plugin.ChannelPhone}
+
+	d, err := New(&config.Notify{
+		Speech:   config.Speech{Language: speech.LanguageEN},
+		Fallback: map[string][]string{plugin.ChannelPhone: {"phone", "sms"}},
+	}, map[string]plugin.Plugin{plugin.DefaultInstance: p}, nil, zerolog.Nop(), testMetrics)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	req := &Request{Notification: plugin.Notification{Type: plugin.ChannelPhone, Attempt: 3, Text: "db is down"}}
+
+	step, err := d.Deliver(context.Background(), req)
+	if err != nil || step.Channel != plugin.ChannelSMS {
+		t.Fatalf("step %v, error %v", step, err)
+	}
+
+	if req.Result.Status != "sms status" {
+		t.Errorf("result of the last attempt %+v", req.Result)
+	}
+
+	if len(p.received) != 2 {
+		t.Fatalf("received %d notifications", len(p.received))
+	}
+
+	for i, n := range p.received {
+		if n.Attempt != 3 || n.Step != i+1 || n.Version != plugin.NotificationVersion {
+			t.Errorf("notification %d: attempt %d, step %d, version %d", i, n.Attempt, n.Step, n.Version)
+		}
+	}
+
+	p.received = nil
+
+	if _, err = d.Deliver(context.Background(), &Request{Notification: plugin.Notification{Type: plugin.ChannelSMS}}); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+
+	if n := p.received[0]; n.Attempt != 1 || n.Step != 1 {
+		t.Errorf("first attempt: attempt %d, step %d", n.Attempt, n.Step)
+	}
+}
@@ -0,0 +1,137 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+const defaultHealthInterval = time.Minute
+
+// PluginStatus is result of last health check of plugin instance
+type PluginStatus struct {
+	Healthy   bool      `json:"healthy"`
+	Channels  []string  `json:"channels"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Health periodically probes plugins, so that API can tell whether notifications can be delivered
+type Health struct {
+	plugins  map[string]plugin.Plugin
+	interval time.Duration
+	logger   zerolog.Logger
+	pm       *metrics.Storage
+
+	mu     sync.RWMutex
+	status map[string]PluginStatus
+}
+
+func NewHealth(plugins map[string]plugin.Plugin, interval time.Duration, l zerolog.Logger, pm *metrics.Storage) *Health {
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+
+	return &Health{
+		plugins:  plugins,
+		interval: interval,
+		logger:   l.With().Str("component", "plugin_health").Logger(),
+		pm:       pm,
+		status:   make(map[string]PluginStatus),
+	}
+}
+
+// Start checks plugins until context is cancelled
+func (h *Health) Start(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check probes every plugin instance once, each probe is limited by check interval
+func (h *Health) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for name, p := range h.plugins {
+		wg.Add(1)
+
+		go func(name string, p plugin.Plugin) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, h.interval)
+			err := plugin.Health(checkCtx, p)
+			cancel()
+
+			status := PluginStatus{
+				Healthy:   err == nil,
+				Channels:  plugin.Channels(p),
+				CheckedAt: time.Now(),
+			}
+
+			gauge := 1.0
+			if err != nil {
+				status.Error = err.Error()
+				gauge = 0
+
+				h.logger.Warn().Err(err).Str("instance", name).Msg("Plugin is unhealthy")
+			}
+
+			h.pm.PluginHealth.WithLabelValues(name).Set(gauge)
+
+			h.mu.Lock()
+			h.status[name] = status
+			h.mu.Unlock()
+		}(name, p)
+	}
+
+	wg.Wait()
+}
+
+// Status returns last check result of every plugin instance
+func (h *Health) Status() map[string]PluginStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	result := make(map[string]PluginStatus, len(h.status))
+	for name, status := range h.status {
+		result[name] = status
+	}
+
+	return result
+}
+
+// Healthy reports whether any healthy plugin supports one of channels.
+// Plugins which were not checked yet are counted as healthy
+func (h *Health) Healthy(channels ...string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for name, p := range h.plugins {
+		status, checked := h.status[name]
+		if checked && !status.Healthy {
+			continue
+		}
+
+		for _, channel := range channels {
+			if plugin.Supports(p, channel) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,67 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+var errProviderDown = errors.New("provider is down")
+
+type fakePlugin struct {
+	channels []string
+	health   error
+}
+
+func (f *fakePlugin) CallPhone(context.Context, user.Item, string, string) error    { return nil }
+func (f *fakePlugin) SendSms(context.Context, user.Item, string, string) error      { return nil }
+func (f *fakePlugin) MessageSlack(context.Context, user.Item, string, string) error { return nil }
+func (f *fakePlugin) Channels() []string                                            { return f.channels }
+func (f *fakePlugin) Health(context.Context) error                                  { return f.health }
+
+var testMetrics = metrics.NewMetrics()
+
+func TestHealthyIsScopedToChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugins map[string]plugin.Plugin
+		want    bool
+	}{
+		{
+			name: "healthy sms does not make calls",
+			plugins: map[string]plugin.Plugin{
+				"voip": &fakePlugin{channels: []string{plugin.ChannelPhone}, health: errProviderDown},
+				"smsc": &fakePlugin{channels: []string{plugin.ChannelSMS}},
+			},
+		},
+		{
+			name: "one healthy phone plugin is enough",
+			plugins: map[string]plugin.Plugin{
+				"voip":   &fakePlugin{channels: []string{plugin.ChannelPhone}, health: errProviderDown},
+				"backup": &fakePlugin{channels: []string{plugin.ChannelPhone, plugin.ChannelSMS}},
+			},
+			want: true,
+		},
+		{
+			name:    "no phone plugin",
+			plugins: map[string]plugin.Plugin{"smsc": &fakePlugin{channels: []string{plugin.ChannelSMS}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealth(tt.plugins, 0, zerolog.Nop(), testMetrics)
+			h.Check(context.Background())
+
+			if got := h.Healthy(plugin.ChannelPhone); got != tt.want {
+				t.Errorf("Healthy(phone) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
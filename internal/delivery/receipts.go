@@ -0,0 +1,127 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/events"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+const (
+	receiptsQueueSize  = 1000
+	receiptRetryFirst  = time.Second
+	receiptRetryMax    = 30 * time.Second
+	defaultReceiptsTTL = 10 * time.Minute
+)
+
+// ReceiptHandler stores delivery receipt, events.ErrReceiptNotMatched asks to retry it later
+type ReceiptHandler func(ctx context.Context, r plugin.Receipt) error
+
+type pendingReceipt struct {
+	receipt  plugin.Receipt
+	handler  int
+	received time.Time
+	next     time.Time
+	delay    time.Duration
+}
+
+// Receipts applies delivery receipts in background. SMSC may report delivery before event of submitted
+// message is stored, so receipt which matched nothing is retried with backoff until it's older than ttl
+type Receipts struct {
+	handlers []ReceiptHandler
+	ttl      time.Duration
+	retryMin time.Duration
+	queue    chan plugin.Receipt
+	pending  []*pendingReceipt
+	logger   zerolog.Logger
+}
+
+func NewReceipts(ttl time.Duration, l zerolog.Logger, handlers ...ReceiptHandler) *Receipts {
+	if ttl <= 0 {
+		ttl = defaultReceiptsTTL
+	}
+
+	return &Receipts{
+		handlers: handlers,
+		ttl:      ttl,
+		retryMin: receiptRetryFirst,
+		queue:    make(chan plugin.Receipt, receiptsQueueSize),
+		logger:   l.With().Str("component", "receipts").Logger(),
+	}
+}
+
+// Add queues receipt, it's callback of plugin.ReceiptReporter and never blocks plugin
+func (r *Receipts) Add(receipt plugin.Receipt) {
+	select {
+	case r.queue <- receipt:
+	default:
+		r.logger.Error().Str("external_id", receipt.ExternalID).Msg("Receipts queue is full, receipt is dropped")
+	}
+}
+
+// Listen applies receipts until context is cancelled
+func (r *Receipts) Listen(ctx context.Context) {
+	ticker := time.NewTicker(r.retryMin)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case receipt := <-r.queue:
+			now := time.Now()
+			for i := range r.handlers {
+				r.apply(ctx, &pendingReceipt{receipt: receipt, handler: i, received: now, next: now}, now)
+			}
+		case now := <-ticker.C:
+			r.retry(ctx, now)
+		}
+	}
+}
+
+func (r *Receipts) retry(ctx context.Context, now time.Time) {
+	pending := r.pending
+	r.pending = nil
+
+	for _, p := range pending {
+		if now.Before(p.next) {
+			r.pending = append(r.pending, p)
+			continue
+		}
+
+		r.apply(ctx, p, now)
+	}
+}
+
+// apply runs handler, receipt is kept for retry only when it matched nothing
+func (r *Receipts) apply(ctx context.Context, p *pendingReceipt, now time.Time) {
+	err := r.handlers[p.handler](ctx, p.receipt)
+	if !errors.Is(err, events.ErrReceiptNotMatched) {
+		return
+	}
+
+	if now.Sub(p.received) >= r.ttl {
+		r.logger.Warn().
+			Str("external_id", p.receipt.ExternalID).
+			Str("status", p.receipt.Status).
+			Msg("Message of delivery receipt is not found")
+
+		return
+	}
+
+	p.delay *= 2
+	if p.delay == 0 {
+		p.delay = r.retryMin
+	}
+
+	if p.delay > receiptRetryMax {
+		p.delay = receiptRetryMax
+	}
+
+	p.next = now.Add(p.delay)
+	r.pending = append(r.pending, p)
+}
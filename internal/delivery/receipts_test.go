@@ -0,0 +1,89 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/events"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+// fakeStore matches receipt only after event of message was stored
+type fakeStore struct {
+	mu       sync.Mutex
+	stored   map[string]bool
+	statuses map[string]string
+	done     chan string
+}
+
+func (f *fakeStore) receipt(_ context.Context, r plugin.Receipt) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.stored[r.ExternalID] {
+		return events.ErrReceiptNotMatched
+	}
+
+	f.statuses[r.ExternalID] = r.Status
+	f.done <- r.ExternalID
+
+	return nil
+}
+
+func (f *fakeStore) store(externalID string) {
+	f.mu.Lock()
+	f.stored[externalID] = true
+	f.mu.Unlock()
+}
+
+func TestReceiptOutrunsEvent(t *testing.T) {
+	store := &fakeStore{stored: map[string]bool{}, statuses: map[string]string{}, done: make(chan string, 1)}
+
+	r := NewReceipts(time.Minute, zerolog.Nop(), store.receipt)
+	r.retryMin = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go r.Listen(ctx)
+
+	// Receipt comes before event of submitted message is inserted
+	r.Add(plugin.Receipt{ExternalID: "m1", Status: "delivered", Success: true})
+	time.Sleep(30 * time.Millisecond)
+	store.store("m1")
+
+	select {
+	case id := <-store.done:
+		if id != "m1" || store.statuses["m1"] != "delivered" {
+			t.Errorf("receipt %s is applied as %q", id, store.statuses[id])
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("receipt is lost")
+	}
+}
+
+func TestReceiptExpires(t *testing.T) {
+	calls := 0
+	r := NewReceipts(50*time.Millisecond, zerolog.Nop(), func(context.Context, plugin.Receipt) error {
+		calls++
+		return events.ErrReceiptNotMatched
+	})
+	r.retryMin = 10 * time.Millisecond
+
+	now := time.Now()
+	r.apply(context.Background(), &pendingReceipt{receipt: plugin.Receipt{ExternalID: "m1"}, received: now, next: now}, now)
+
+	if len(r.pending) != 1 {
+		t.Fatalf("%d pending receipts", len(r.pending))
+	}
+
+	r.retry(context.Background(), now.Add(time.Minute))
+
+	if len(r.pending) != 0 || calls != 2 {
+		t.Errorf("%d pending receipts after ttl, %d calls", len(r.pending), calls)
+	}
+}
@@ -2,6 +2,8 @@ package events
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/ebogdanov/emu-oncall/internal/db"
@@ -12,17 +14,34 @@ const (
 	waitTime = 100 * time.Millisecond
 )
 
+var (
+	errEventNotFound = errors.New("event-not-found")
+	// ErrReceiptNotMatched is returned when message of delivery receipt is not stored yet
+	ErrReceiptNotMatched = errors.New("receipt-not-matched")
+)
+
 type Service interface {
 	Add(i *Record) error
+	Receipt(ctx context.Context, externalID, status string, success bool) error
+	ByExternalID(ctx context.Context, externalID string) (*Record, error)
+	Acknowledged(ctx context.Context, incidentID int, since time.Time) (bool, error)
 }
 
 type Record struct {
-	Timestamp time.Time
-	UserID    string
-	Recipient string
-	Channel   string
-	Success   bool
-	Msg       string
+	Timestamp  time.Time
+	UserID     string
+	Recipient  string
+	Channel    string
+	Plugin     string
+	Success    bool
+	Msg        string
+	ExternalID string
+	Status     string
+	AlertID    string
+	IncidentID int
+	// Segments is count of sms parts billed by provider
+	Segments       int
+	NotificationID int64
 }
 
 type DefaultService struct {
@@ -68,6 +87,73 @@ func (d *DefaultService) Add(item *Record) error {
 	return nil
 }
 
+// Receipt updates delivery state of event, matched by provider message id.
+// Receipt can outrun event of submitted message, ErrReceiptNotMatched tells that it should be retried
+func (d *DefaultService) Receipt(ctx context.Context, externalID, status string, success bool) error {
+	res, err := d.db.ExecContext(ctx,
+		"UPDATE events SET status = $1, success = $2 WHERE external_id = $3",
+		status, success, externalID)
+
+	if err != nil {
+		d.logger.Error().Err(err).Str("external_id", externalID).Msg("unable to update event status")
+		return err
+	}
+
+	if cnt, _ := res.RowsAffected(); cnt == 0 {
+		return ErrReceiptNotMatched
+	}
+
+	return nil
+}
+
+// ByExternalID returns the latest event with provider message or call id
+func (d *DefaultService) ByExternalID(ctx context.Context, externalID string) (*Record, error) {
+	var (
+		item       = &Record{ExternalID: externalID}
+		plugin     sql.NullString
+		status     sql.NullString
+		alertID    sql.NullString
+		incidentID sql.NullInt64
+	)
+
+	err := d.db.QueryRowContext(ctx,
+		"SELECT date_add, user_id, channel, recipient, success, plugin, status, alert_id, incident_id FROM events WHERE external_id = $1 ORDER BY id DESC LIMIT 1",
+		externalID).
+		Scan(&item.Timestamp, &item.UserID, &item.Channel, &item.Recipient, &item.Success, &plugin, &status, &alertID, &incidentID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errEventNotFound
+	}
+
+	if err != nil {
+		d.logger.Error().Err(err).Str("external_id", externalID).Msg("unable to load event")
+		return nil, err
+	}
+
+	item.Plugin = plugin.String
+	item.Status = status.String
+	item.AlertID = alertID.String
+	item.IncidentID = int(incidentID.Int64)
+
+	return item, nil
+}
+
+// Acknowledged reports whether incident was acknowledged or silenced by DTMF after since
+func (d *DefaultService) Acknowledged(ctx context.Context, incidentID int, since time.Time) (bool, error) {
+	var found bool
+
+	err := d.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM events WHERE channel = 'dtmf' AND success AND incident_id = $1 AND status IN ('acknowledge', 'silence') AND date_add >= $2)",
+		incidentID, since).
+		Scan(&found)
+
+	if err != nil {
+		d.logger.Error().Err(err).Int("incident_id", incidentID).Msg("unable to check acknowledgement")
+	}
+
+	return found, err
+}
+
 func (d *DefaultService) insert(item *Record) {
 	msg := item.Msg
 	if len(msg) > 500 {
@@ -75,8 +161,8 @@ func (d *DefaultService) insert(item *Record) {
 	}
 
 	_, err := d.db.ExecContext(context.Background(),
-		"INSERT INTO events (date_add, user_id, channel, recipient, success, msg) VALUES ($1, $2, $3, $4, $5, $6)",
-		&item.Timestamp, &item.UserID, &item.Channel, &item.Recipient, &item.Success, &msg)
+		"INSERT INTO events (date_add, user_id, channel, recipient, success, msg, external_id, status, plugin, alert_id, incident_id, segments, notification_id) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, 0), NULLIF($12, 0), NULLIF($13, 0))",
+		&item.Timestamp, &item.UserID, &item.Channel, &item.Recipient, &item.Success, &msg, &item.ExternalID, &item.Status, &item.Plugin, &item.AlertID, &item.IncidentID, &item.Segments, &item.NotificationID)
 
 	if err != nil {
 		d.logger.Error().Err(err).Msg("unable to insert events into database")
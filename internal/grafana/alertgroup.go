@@ -5,10 +5,13 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ebogdanov/emu-oncall/plugin"
 )
 
 var (
 	regexpInstance = regexp.MustCompile(`\*instance\*:\s+(.*)\s`)
+	regexpSeverity = regexp.MustCompile(`\*severity\*:\s+(\S+)`)
 )
 
 type AlertGroup struct {
@@ -41,6 +44,9 @@ type Render interface {
 	AlertID() string
 	PhoneCall(string) string
 	SMSText(string) string
+	Details() *plugin.AlertDetails
+	Fill(n *plugin.Notification)
+	Handled() bool
 	Raw() interface{}
 }
 
@@ -49,21 +55,60 @@ func (a *AlertGroup) AlertID() string {
 }
 
 func (a *AlertGroup) PhoneCall(originalMessage string) string {
+	return a.withInstance(originalMessage)
+}
+
+func (a *AlertGroup) SMSText(originalMessage string) string {
+	return a.withInstance(originalMessage)
+}
+
+// Instance is value of "*instance*:" label of alert
+func (a *AlertGroup) Instance() string {
 	matches := regexpInstance.FindAllStringSubmatch(a.RenderForClassicMarkdown.Message, -1)
 	if len(matches) > 0 {
-		originalMessage = strings.Replace(originalMessage, ", alert channel", " "+matches[0][1]+", alert channel", -1)
+		return matches[0][1]
+	}
+
+	return ""
+}
+
+// withInstance is default message of OnCall with instance name before alert channel
+func (a *AlertGroup) withInstance(originalMessage string) string {
+	if instance := a.Instance(); instance != "" {
+		return strings.Replace(originalMessage, ", alert channel", " "+instance+", alert channel", -1)
 	}
 
 	return originalMessage
 }
 
-func (a *AlertGroup) SMSText(originalMessage string) string {
-	matches := regexpInstance.FindAllStringSubmatch(a.RenderForClassicMarkdown.Message, -1)
+// Details returns alert group rendered for web, so that plugins can use it as is
+func (a *AlertGroup) Details() *plugin.AlertDetails {
+	return &plugin.AlertDetails{
+		Title:      a.RenderForWeb.Title,
+		Message:    a.RenderForWeb.Message,
+		SourceLink: a.RenderForWeb.SourceLink,
+	}
+}
+
+// Fill copies incident fields into notification
+func (a *AlertGroup) Fill(n *plugin.Notification) {
+	n.AlertID = a.ID
+	n.IncidentID = a.InsideOrganizationNumber
+	n.Title = a.RenderForWeb.Title
+	n.AlertChannel = a.AlertReceiveChannel.VerbalName
+	n.SourceLink = a.RenderForWeb.SourceLink
+	n.Details = a.Details()
+	n.Render = a
+
+	matches := regexpSeverity.FindAllStringSubmatch(a.RenderForClassicMarkdown.Message, -1)
 	if len(matches) > 0 {
-		return strings.Replace(originalMessage, ", alert channel", " "+matches[0][1]+", alert channel", -1)
+		n.Severity = matches[0][1]
 	}
+}
 
-	return originalMessage
+// Handled is true when alert group is acknowledged, resolved or silenced, so nobody should be paged anymore
+func (a *AlertGroup) Handled() bool {
+	return a.Acknowledged || a.Resolved || a.Silenced
 }
 
 func (a *AlertGroup) Raw() interface{} {
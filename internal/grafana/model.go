@@ -67,6 +67,10 @@ type User struct {
 	LastSeenAt    string   `json:"lastSeenAt"`
 	LastSeenAtAge string   `json:"lastSeenAtAge"`
 	AuthLabels    []string `json:"authLabels"`
+
+	// UserID and Role are returned by /api/org/users instead of ID and IsAdmin
+	UserID int    `json:"userId"`
+	Role   string `json:"role"`
 }
 
 type ScheduleItem struct {
@@ -87,6 +91,8 @@ type scheduleEvent struct {
 	Msg          string
 	ScheduleName string
 	URL          string
+	Template     string
+	Schedule     *ScheduleItem
 }
 
 // "ok" or "alerting"
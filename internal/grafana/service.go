@@ -22,6 +22,14 @@ import (
 
 const (
 	endpointIncidentDetails = "%s/api/plugin-proxy/grafana-oncall-app/api/internal/v1/alertgroups?search=%d"
+	endpointAlertGroupAct   = "%s/api/plugin-proxy/grafana-oncall-app/api/internal/v1/alertgroups/%s/%s/"
+)
+
+// Alert group actions, names are the same as in OnCall internal API
+const (
+	ActionAcknowledge = "acknowledge"
+	ActionResolve     = "resolve"
+	ActionSilence     = "silence"
 )
 
 const (
@@ -49,9 +57,17 @@ var (
 
 type Service interface {
 	IncidentDetails(context.Context, int) (Render, error)
+	AlertGroup(ctx context.Context, incidentID int) (Render, error)
+	AlertGroupAction(ctx context.Context, incidentID int, action string, silence time.Duration) (Render, error)
+	Message(name string, data *TemplateData, fallback string) string
 	Start(context.Context)
 }
 
+type alertGroupActionRequest struct {
+	// Delay is silence duration in seconds, -1 is forever
+	Delay int64 `json:"delay"`
+}
+
 type ScheduleProcessor interface {
 	Current(ctx context.Context) (*ScheduleItem, error)
 }
@@ -59,6 +75,7 @@ type ScheduleProcessor interface {
 type Instance struct {
 	cfg           *config.Grafana
 	p             plugin.Plugin
+	templates     *Templates
 	repoUser      *user.Storage
 	client        httpClient
 	logger        zerolog.Logger
@@ -68,11 +85,12 @@ type Instance struct {
 	promMetrics   *metrics.Storage
 }
 
-func New(cfg *config.Grafana, p plugin.Plugin, u *user.Storage, l zerolog.Logger, pm *metrics.Storage) Service {
+func New(cfg *config.Grafana, p plugin.Plugin, t *Templates, u *user.Storage, l zerolog.Logger, pm *metrics.Storage) Service {
 	auth := &engineToken{Token: cfg.Token}
 
 	instance := &Instance{
 		p:             p,
+		templates:     t,
 		repoUser:      u,
 		cfg:           cfg,
 		sm:            &sync.RWMutex{},
@@ -86,12 +104,90 @@ func New(cfg *config.Grafana, p plugin.Plugin, u *user.Storage, l zerolog.Logger
 }
 
 func (g *Instance) IncidentDetails(ctx context.Context, incidentID int) (Render, error) {
+	if !g.cfg.IncidentDetails || incidentID == 0 {
+		return nil, nil
+	}
+
+	alertGroup, err := g.alertGroup(ctx, incidentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return alertGroup, nil
+}
+
+// AlertGroup searches alert group by incident number, regardless of grafana.oncall.incident_details
+func (g *Instance) AlertGroup(ctx context.Context, incidentID int) (Render, error) {
+	alertGroup, err := g.alertGroup(ctx, incidentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return alertGroup, nil
+}
+
+// AlertGroupAction finds alert group by incident number and acknowledges, resolves or silences it.
+// Zero silence duration means forever
+func (g *Instance) AlertGroupAction(ctx context.Context, incidentID int, action string, silence time.Duration) (Render, error) {
+	alertGroup, err := g.alertGroup(ctx, incidentID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := "{}"
+	if action == ActionSilence {
+		req := &alertGroupActionRequest{Delay: int64(silence.Seconds())}
+		if silence <= 0 {
+			req.Delay = -1
+		}
+
+		data, _ := json.Marshal(req)
+		body = string(data)
+	}
+
+	requestURL := fmt.Sprintf(endpointAlertGroupAct,
+		strings.TrimSuffix(g.cfg.URL, "/"), alertGroup.ID, action)
+
+	resp, err := g.client.Post(ctx, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result alertGroupResponse
+	if err = json.Unmarshal(resp, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Detail != "" {
+		return nil, errors.New(result.Detail)
+	}
+
+	if result.Message != "" {
+		return nil, errors.New(result.Message)
+	}
+
+	g.logger.Info().
+		Int("incident_id", incidentID).
+		Str("alert_id", alertGroup.ID).
+		Str("action", action).
+		Msg("Alert group action was performed")
+
+	return alertGroup, nil
+}
+
+// Message renders configured template, fallback is original OnCall text
+func (g *Instance) Message(name string, data *TemplateData, fallback string) string {
+	return g.templates.Render(name, data, fallback)
+}
+
+// alertGroup searches alert group by incident number, which is shown in notifications
+func (g *Instance) alertGroup(ctx context.Context, incidentID int) (*AlertGroup, error) {
 	var (
 		alertGroup alertGroupResponse
 	)
 
-	if !g.cfg.IncidentDetails || incidentID == 0 {
-		return nil, nil
+	if incidentID == 0 {
+		return nil, errNotFoundIncident
 	}
 
 	if g.cfg.URL == "" {
@@ -189,23 +285,39 @@ func (g *Instance) notify(ctx context.Context, msg *scheduleEvent) {
 		body      []byte
 	)
 
+	n := &plugin.Notification{
+		Type:  msg.Template,
+		Title: msg.Title,
+		Text:  msg.Msg,
+		User:  user.Item{ID: msg.UserID},
+	}
+
+	recipient, err = g.repoUser.DBQuery(ctx, user.Options{UserID: msg.UserID})
+	if err == nil && len(recipient.Result) > 0 {
+		n.User = recipient.Result[0]
+	}
+
+	text := g.templates.Render(msg.Template, &TemplateData{
+		Notification: n,
+		Schedule:     msg.Schedule,
+		Now:          time.Now(),
+	}, msg.Msg)
+
 	switch msg.Transport {
 	case callback:
 		req := &formattedAlert{
 			Title:   titleDuty,
-			Message: msg.Msg,
+			Message: text,
 		}
 
 		if body, err = json.Marshal(req); err == nil {
 			res, err = g.client.Post(ctx, msg.URL, string(body))
 		}
 	default:
-		recipient, err = g.repoUser.DBQuery(ctx, user.Options{UserID: msg.UserID})
-
-		msgID := fmt.Sprintf("duty_start_%s", msg.ScheduleName)
+		msgID := fmt.Sprintf("%s_%s", msg.Template, msg.ScheduleName)
 
 		if err == nil && len(recipient.Result) > 0 {
-			err = g.p.SendSms(ctx, recipient.Result[0], msgID, msg.Msg)
+			err = g.p.SendSms(ctx, n.User, msgID, text)
 		}
 	}
 
@@ -283,11 +395,14 @@ func (g *Instance) scheduleEntry(schedule *ScheduleItem) {
 		text := fmt.Sprintf(templateStartDuty, name)
 
 		g.notifyChannel <- &scheduleEvent{
-			Transport: schedule.transport,
-			UserID:    userID,
-			Msg:       text,
-			Title:     titleDuty,
-			URL:       schedule.callbackURL}
+			Transport:    schedule.transport,
+			UserID:       userID,
+			Msg:          text,
+			Title:        titleDuty,
+			URL:          schedule.callbackURL,
+			Template:     TemplateDutyStart,
+			ScheduleName: name,
+			Schedule:     schedule}
 	}
 
 	// What a pity - duty is over :(
@@ -301,11 +416,14 @@ func (g *Instance) scheduleEntry(schedule *ScheduleItem) {
 
 		text := fmt.Sprintf(templateEndDuty, name)
 		g.notifyChannel <- &scheduleEvent{
-			Transport: schedule.transport,
-			UserID:    userID,
-			Msg:       text,
-			Title:     titleDuty,
-			URL:       schedule.callbackURL}
+			Transport:    schedule.transport,
+			UserID:       userID,
+			Msg:          text,
+			Title:        titleDuty,
+			URL:          schedule.callbackURL,
+			Template:     TemplateDutyEnd,
+			ScheduleName: name,
+			Schedule:     schedule}
 	}
 
 	_, _ = curr.Pop()
@@ -0,0 +1,153 @@
+package grafana
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/translit"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+// Template names, configured in grafana.templates
+const (
+	TemplatePhone     = plugin.ChannelPhone
+	TemplateSMS       = plugin.ChannelSMS
+	TemplateSlack     = plugin.ChannelSlack
+	TemplateDutyStart = "duty_start"
+	TemplateDutyEnd   = "duty_end"
+)
+
+var errUnknownTemplate = errors.New("unknown template")
+
+var knownTemplates = map[string]bool{
+	TemplatePhone:     true,
+	TemplateSMS:       true,
+	TemplateSlack:     true,
+	TemplateDutyStart: true,
+	TemplateDutyEnd:   true,
+}
+
+var templateFuncs = template.FuncMap{
+	// truncate cuts text to n characters, "..." is not added, since every character costs in sms
+	"truncate": func(n int, s string) string {
+		runes := []rune(s)
+		if n < 0 || len(runes) <= n {
+			return s
+		}
+
+		return string(runes[:n])
+	},
+	"translit": translit.String,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	// formatTime uses Go layout, e.g. formatTime "02.01 15:04" .Now
+	"formatTime": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	// inZone converts time into IANA timezone, e.g. inZone "Europe/Moscow" .Now
+	"inZone": func(name string, t time.Time) (time.Time, error) {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return t, err
+		}
+
+		return t.In(loc), nil
+	},
+	"since": func(t time.Time) time.Duration {
+		return time.Since(t).Round(time.Second)
+	},
+}
+
+// TemplateData is passed to message templates. Notification carries original OnCall text,
+// user and incident fields, AlertGroup is nil when incident details are not loaded
+type TemplateData struct {
+	*plugin.Notification
+
+	AlertGroup *AlertGroup
+	Instance   string
+	Schedule   *ScheduleItem
+	Now        time.Time
+}
+
+// NewTemplateData collects alert group which was filled into notification
+func NewTemplateData(n *plugin.Notification) *TemplateData {
+	data := &TemplateData{
+		Notification: n,
+		Now:          time.Now(),
+	}
+
+	if alertGroup, ok := n.Render.(*AlertGroup); ok {
+		data.AlertGroup = alertGroup
+		data.Instance = alertGroup.Instance()
+	}
+
+	return data
+}
+
+// Templates renders configured messages, original text is used when template is missing or fails
+type Templates struct {
+	templates map[string]*template.Template
+	logger    zerolog.Logger
+}
+
+func NewTemplates(cfg map[string]string, l zerolog.Logger) (*Templates, error) {
+	t := &Templates{
+		templates: make(map[string]*template.Template),
+		logger:    l.With().Str("component", "templates").Logger(),
+	}
+
+	for name, text := range cfg {
+		if !knownTemplates[name] {
+			return nil, fmt.Errorf("%w: %q", errUnknownTemplate, name)
+		}
+
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		tpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+
+		t.templates[name] = tpl
+	}
+
+	return t, nil
+}
+
+// Render executes template by name, fallback is returned when there is no such template or it fails
+func (t *Templates) Render(name string, data *TemplateData, fallback string) string {
+	if t == nil {
+		return fallback
+	}
+
+	tpl, ok := t.templates[name]
+	if !ok {
+		return fallback
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		t.logger.Error().
+			Err(err).
+			Str("template", name).
+			Msg("Unable to render template, original text is used")
+
+		return fallback
+	}
+
+	text := strings.TrimSpace(buf.String())
+	if text == "" {
+		return fallback
+	}
+
+	return text
+}
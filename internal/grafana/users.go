@@ -0,0 +1,196 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/config"
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+const endpointOrgUsers = "%s/api/org/users"
+
+// Results of sync besides user.Import* ones
+const (
+	syncDeactivated = "deactivated"
+	syncFailed      = "failed"
+)
+
+var errEmptyGrafanaURL = errors.New("grafana.url is empty, users can't be synced")
+
+// SyncSummary counts users by result of one sync run
+type SyncSummary struct {
+	Created     int
+	Updated     int
+	Unchanged   int
+	Deactivated int
+	Failed      int
+}
+
+// UserSync periodically imports users of Grafana organization into oncall_users
+type UserSync struct {
+	cfg         *config.Grafana
+	repoUser    *user.Storage
+	client      httpClient
+	logger      zerolog.Logger
+	promMetrics *metrics.Storage
+}
+
+func NewUserSync(cfg *config.Grafana, u *user.Storage, l zerolog.Logger, pm *metrics.Storage) *UserSync {
+	auth := &engineToken{Token: cfg.Token}
+
+	return &UserSync{
+		cfg:         cfg,
+		repoUser:    u,
+		client:      newAPIClient(auth.HeaderValue(), pm),
+		logger:      l.With().Str("component", "user_sync").Logger(),
+		promMetrics: pm,
+	}
+}
+
+// Start runs sync right away and then every grafana.user_sync.interval, it does nothing when sync is disabled
+func (s *UserSync) Start(ctx context.Context) {
+	if !s.cfg.UserSync.Enabled || s.cfg.UserSync.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.UserSync.Interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = s.Run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run syncs users once: Grafana users are created or updated, disabled and vanished ones are deactivated
+func (s *UserSync) Run(ctx context.Context) (*SyncSummary, error) {
+	dryRun := s.cfg.UserSync.DryRun
+	summary := &SyncSummary{}
+
+	users, err := s.orgUsers(ctx)
+	if err != nil {
+		s.count(syncFailed, 1)
+		s.logger.Error().Err(err).Msg("Unable to load users from Grafana")
+
+		return nil, err
+	}
+
+	seen := make([]string, 0, len(users))
+
+	for i := range users {
+		u := &users[i]
+
+		id := u.UserID
+		if id == 0 {
+			id = u.ID
+		}
+
+		name := u.Name
+		if name == "" {
+			name = u.Login
+		}
+
+		userID, result, err := s.repoUser.Insert(ctx, id, name, u.Login, u.Email, user.GrafanaRole(u.Role), !u.IsDisabled, dryRun)
+
+		switch result {
+		case user.ImportCreated:
+			summary.Created++
+		case user.ImportUpdated:
+			summary.Updated++
+		case user.ImportUnchanged:
+			summary.Unchanged++
+		default:
+			summary.Failed++
+
+			s.logger.Error().
+				Err(err).
+				Str("login", u.Login).
+				Msg("Unable to sync user")
+		}
+
+		if userID != "" {
+			seen = append(seen, userID)
+		}
+	}
+
+	// Empty or partly failed list must not deactivate everybody
+	if summary.Failed == 0 {
+		deactivated, err := s.repoUser.DeactivateMissing(ctx, seen, dryRun)
+		if err != nil {
+			summary.Failed++
+			s.logger.Error().Err(err).Msg("Unable to deactivate users missing in Grafana")
+		}
+
+		summary.Deactivated = len(deactivated)
+
+		if len(deactivated) > 0 {
+			s.logger.Info().
+				Strs("user_id", deactivated).
+				Bool("dry_run", dryRun).
+				Msg("Users missing in Grafana are deactivated")
+		}
+	}
+
+	s.count(user.ImportCreated, summary.Created)
+	s.count(user.ImportUpdated, summary.Updated)
+	s.count(user.ImportUnchanged, summary.Unchanged)
+	s.count(syncDeactivated, summary.Deactivated)
+	s.count(syncFailed, summary.Failed)
+
+	s.logger.Info().
+		Int("grafana", len(users)).
+		Int("created", summary.Created).
+		Int("updated", summary.Updated).
+		Int("unchanged", summary.Unchanged).
+		Int("deactivated", summary.Deactivated).
+		Int("failed", summary.Failed).
+		Bool("dry_run", dryRun).
+		Msg("Users are synced from Grafana")
+
+	return summary, nil
+}
+
+// orgUsers loads users of organization which header_token belongs to
+func (s *UserSync) orgUsers(ctx context.Context) ([]User, error) {
+	if s.cfg.URL == "" {
+		return nil, errEmptyGrafanaURL
+	}
+
+	resp, err := s.client.Get(ctx, fmt.Sprintf(endpointOrgUsers, strings.TrimSuffix(s.cfg.URL, "/")))
+	if err != nil {
+		return nil, err
+	}
+
+	var users []User
+	if err = json.Unmarshal(resp, &users); err != nil {
+		// Grafana answers with object on error, e.g. when token is not organization admin
+		var apiErr Err
+		if json.Unmarshal(resp, &apiErr) == nil && apiErr.Message != "" {
+			return nil, errors.New(apiErr.Message)
+		}
+
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (s *UserSync) count(result string, n int) {
+	if n > 0 {
+		s.promMetrics.UserSync.WithLabelValues(result, strconv.FormatBool(s.cfg.UserSync.DryRun)).Add(float64(n))
+	}
+}
@@ -12,6 +12,9 @@ const (
 	scheduleCount           = "emu_read_schedule_count"
 	dbQueryDuration         = "db_query_duration"
 	dbQueryErrorsCount      = "db_query_errors_count"
+	pluginHealth            = "emu_plugin_health"
+	smsSegmentsCount        = "emu_sms_segments_count"
+	userSyncCount           = "emu_user_sync_count"
 )
 
 type Storage struct {
@@ -23,6 +26,9 @@ type Storage struct {
 	HTTPRequestDuration *prometheus.HistogramVec
 	SchedulesCounter    *prometheus.CounterVec
 	DBQueryErrorCounter *prometheus.CounterVec
+	PluginHealth        *prometheus.GaugeVec
+	SMSSegments         *prometheus.CounterVec
+	UserSync            *prometheus.CounterVec
 }
 
 func NewMetrics() *Storage {
@@ -76,6 +82,27 @@ func NewMetrics() *Storage {
 			},
 			[]string{"query"},
 		),
+		PluginHealth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: pluginHealth,
+				Help: "Result of last plugin health check, 1 is healthy",
+			},
+			[]string{"instance"},
+		),
+		SMSSegments: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: smsSegmentsCount,
+				Help: "Count of sms segments passed to plugins",
+			},
+			[]string{"instance", "encoding"},
+		),
+		UserSync: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: userSyncCount,
+				Help: "Users of Grafana sync by result: created, updated, unchanged, deactivated, failed",
+			},
+			[]string{"result", "dry_run"},
+		),
 	}
 
 	prometheus.MustRegister(m.Heartbeat)
@@ -85,6 +112,9 @@ func NewMetrics() *Storage {
 	prometheus.MustRegister(m.SchedulesCounter)
 	prometheus.MustRegister(m.DBQueryErrorCounter)
 	prometheus.MustRegister(m.DBQueryTime)
+	prometheus.MustRegister(m.PluginHealth)
+	prometheus.MustRegister(m.SMSSegments)
+	prometheus.MustRegister(m.UserSync)
 
 	return m
 }
@@ -0,0 +1,374 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/config"
+	"github.com/ebogdanov/emu-oncall/internal/db"
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/redial"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+const (
+	tableNotifications = "notifications"
+
+	// Lifecycle of notification: queued (waiting for the next attempt) -> sending -> delivered (accepted by plugin)
+	// -> acknowledged (confirmed by delivery receipt or DTMF). Failed is final, e.g. after max attempts
+	StatusQueued       = "queued"
+	StatusSending      = "sending"
+	StatusDelivered    = "delivered"
+	StatusFailed       = "failed"
+	StatusAcknowledged = "acknowledged"
+
+	// staleSending is time after which message in sending status is counted as lost by stopped process
+	staleSending = 10 * time.Minute
+	maxListLimit = 1000
+	maxErrorLen  = 500
+)
+
+var (
+	colsMessage = []string{"id", "date_add", "updated_at", "next_at", "request_id", "type", "user_id", "email",
+		"alert_id", "incident_id", "attempt", "max_attempts", "status", "channel", "step", "error"}
+
+	errInvalidStatus       = errors.New("invalid-status")
+	errNotificationMissing = errors.New("notification-not-found")
+	errRecipientMissing    = errors.New("recipient-not-found-or-deactivated")
+)
+
+// Message is notification stored in outbox
+type Message struct {
+	ID          int64     `json:"id"`
+	Created     time.Time `json:"created_at"`
+	Updated     time.Time `json:"updated_at"`
+	NextAt      time.Time `json:"next_at"`
+	RequestID   string    `json:"request_id,omitempty"`
+	Type        string    `json:"type"`
+	UserID      string    `json:"user_id"`
+	Email       string    `json:"email"`
+	AlertID     string    `json:"alert_id,omitempty"`
+	IncidentID  int       `json:"incident_id,omitempty"`
+	Attempt     int       `json:"attempt"`
+	MaxAttempts int       `json:"max_attempts"`
+	Status      string    `json:"status"`
+	Channel     string    `json:"channel,omitempty"`
+	Step        string    `json:"step,omitempty"`
+	Error       string    `json:"error,omitempty"`
+
+	req *delivery.Request
+}
+
+// Service stores notifications in database and delivers them by worker pool, with exponential backoff between attempts.
+// Message which failed MaxAttempts times is moved to dead status
+type Service struct {
+	cfg        config.Outbox
+	db         *db.DBx
+	dispatcher *delivery.Dispatcher
+	redial     *redial.Service
+	users      *user.Storage
+	logger     zerolog.Logger
+	pm         *metrics.Storage
+
+	queue chan *Message
+}
+
+func New(cfg config.Outbox, dbx *db.DBx, dispatcher *delivery.Dispatcher, redialSvc *redial.Service, users *user.Storage,
+	l zerolog.Logger, pm *metrics.Storage) *Service {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+
+	return &Service{
+		cfg:        cfg,
+		db:         dbx,
+		dispatcher: dispatcher,
+		redial:     redialSvc,
+		users:      users,
+		logger:     l.With().Str("component", "outbox").Logger(),
+		pm:         pm,
+		queue:      make(chan *Message, cfg.Workers),
+	}
+}
+
+// Enabled reports whether notifications from OnCall are delivered asynchronously
+func (s *Service) Enabled() bool {
+	return s.cfg.Enabled
+}
+
+// Enqueue stores notification, it's delivered by worker as soon as possible
+func (s *Service) Enqueue(ctx context.Context, req *delivery.Request) (int64, error) {
+	return s.EnqueueAt(ctx, req, time.Now())
+}
+
+// EnqueueAt stores notification which is delivered by worker not earlier than at, e.g. after quiet hours
+func (s *Service) EnqueueAt(ctx context.Context, req *delivery.Request, at time.Time) (int64, error) {
+	id, err := s.insert(ctx, req, StatusQueued, at, 0, s.cfg.MaxAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	s.pm.Notifications.WithLabelValues("outbox_enqueued").Inc()
+
+	return id, nil
+}
+
+func (s *Service) insert(ctx context.Context, req *delivery.Request, status string, nextAt time.Time,
+	attempt, maxAttempts int) (int64, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+
+	query, args, err := sq.Insert(tableNotifications).
+		Columns("date_add", "updated_at", "next_at", "request_id", "type", "user_id", "email", "alert_id", "incident_id",
+			"payload", "attempt", "max_attempts", "status").
+		Values(now, now, nextAt, req.RequestID, req.Type, req.User.ID, req.User.Email, req.AlertID, req.IncidentID,
+			string(payload), attempt, maxAttempts, status).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	if err = s.db.QueryRowContext(ctx, query, args...).Scan(&id); err != nil {
+		s.logger.Error().Err(err).Str("request_id", req.RequestID).Msgf("unable to insert into %s", tableNotifications)
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Start runs worker pool until context is cancelled, messages which are being delivered are finished.
+// Pool runs even when outbox is disabled, since deferred notifications are delivered by it
+func (s *Service) Start(ctx context.Context) {
+	var workers sync.WaitGroup
+
+	for i := 0; i < s.cfg.Workers; i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for msg := range s.queue {
+				s.deliver(msg)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(s.queue)
+			workers.Wait()
+
+			return
+		case <-ticker.C:
+			s.poll(ctx)
+		}
+	}
+}
+
+// poll claims due messages, so that they are not picked by another poll or instance
+func (s *Service) poll(ctx context.Context) {
+	now := time.Now()
+
+	rows, err := s.db.QueryContext(ctx, `UPDATE notifications SET status = $1, updated_at = $2
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE (status = $3 AND next_at <= $2) OR (status = $1 AND updated_at <= $4)
+			ORDER BY next_at ASC
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+strings.Join(colsMessage, ", ")+`, payload`,
+		StatusSending, now, StatusQueued, now.Add(-staleSending), s.cfg.Workers)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("unable to claim notifications from outbox")
+		return
+	}
+
+	var claimed []*Message
+
+	for rows.Next() {
+		msg, err := scan(rows, true)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("unable to scan notification row")
+			continue
+		}
+
+		claimed = append(claimed, msg)
+	}
+	_ = rows.Close()
+
+	for _, msg := range claimed {
+		s.queue <- msg
+	}
+}
+
+// deliver makes one attempt with fallback chain. It's not cancelled with service context,
+// so that call which is in progress is not interrupted on shutdown
+func (s *Service) deliver(msg *Message) {
+	ctx := context.Background()
+	msg.Attempt++
+
+	var step delivery.Step
+
+	// User is loaded again, since payload has no private fields (e.g. telegram chat) and phone could be changed.
+	// Deleted or deactivated user is not paged by copy from payload, message may be delivered hours later
+	recipient, err := s.users.WithEmail(ctx, msg.Email)
+	if err == nil && recipient.ID == "" {
+		err = errRecipientMissing
+	}
+
+	if err == nil {
+		recipient.Prefer(msg.req.Type)
+		msg.req.User = *recipient
+		msg.req.Attempt = msg.Attempt
+
+		step, err = s.dispatcher.Deliver(ctx, msg.req)
+	}
+
+	switch {
+	case errors.Is(err, errRecipientMissing):
+		msg.Status = StatusFailed
+		msg.Error = err.Error()
+	case err == nil:
+		msg.Status = StatusDelivered
+		msg.Channel = step.Channel
+		msg.Step = step.String()
+		msg.Error = ""
+	case msg.Attempt >= msg.MaxAttempts:
+		msg.Status = StatusFailed
+		msg.Error = err.Error()
+
+		s.pm.Notifications.WithLabelValues("outbox_dead").Inc()
+	default:
+		msg.Status = StatusQueued
+		msg.NextAt = time.Now().Add(s.backoff(msg.Attempt))
+		msg.Error = err.Error()
+	}
+
+	s.update(ctx, msg)
+
+	s.logger.Info().
+		Int64("id", msg.ID).
+		Str("request_id", msg.RequestID).
+		Str("notification_type", msg.Type).
+		Int("attempt", msg.Attempt).
+		Str("status", msg.Status).
+		Str("step", msg.Step).
+		Msg("Outbox delivery attempt is finished")
+
+	// Unanswered call is repeated by redial policy, only when outbox gave up or delivered it without answer
+	if msg.Type == plugin.ChannelPhone && !errors.Is(err, errRecipientMissing) &&
+		(msg.Status == StatusFailed || (err == nil && !redial.Answered(msg.req, step, err))) {
+		_ = s.redial.Schedule(ctx, msg.req)
+	}
+}
+
+// backoff is doubled after every failed attempt
+func (s *Service) backoff(attempt int) time.Duration {
+	delay := s.cfg.Backoff
+	for i := 1; i < attempt && delay < s.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if s.cfg.MaxBackoff > 0 && delay > s.cfg.MaxBackoff {
+		delay = s.cfg.MaxBackoff
+	}
+
+	return delay
+}
+
+func (s *Service) update(ctx context.Context, msg *Message) {
+	errText := msg.Error
+	if len(errText) > maxErrorLen {
+		errText = errText[:maxErrorLen]
+	}
+
+	query, args, err := sq.Update(tableNotifications).
+		Set("updated_at", time.Now()).
+		Set("next_at", msg.NextAt).
+		Set("attempt", msg.Attempt).
+		Set("status", msg.Status).
+		Set("channel", msg.Channel).
+		Set("step", msg.Step).
+		Set("error", errText).
+		Where(sq.Eq{"id": msg.ID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
+		s.logger.Error().Err(err).Int64("id", msg.ID).Msg("unable to update notification in outbox")
+	}
+}
+
+func scan(rows *sql.Rows, withPayload bool) (*Message, error) {
+	var (
+		msg        = &Message{}
+		requestID  sql.NullString
+		alertID    sql.NullString
+		incidentID sql.NullInt64
+		channel    sql.NullString
+		step       sql.NullString
+		errText    sql.NullString
+		payload    string
+	)
+
+	dest := []interface{}{&msg.ID, &msg.Created, &msg.Updated, &msg.NextAt, &requestID, &msg.Type, &msg.UserID, &msg.Email,
+		&alertID, &incidentID, &msg.Attempt, &msg.MaxAttempts, &msg.Status, &channel, &step, &errText}
+	if withPayload {
+		dest = append(dest, &payload)
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	msg.RequestID = requestID.String
+	msg.AlertID = alertID.String
+	msg.IncidentID = int(incidentID.Int64)
+	msg.Channel = channel.String
+	msg.Step = step.String
+	msg.Error = errText.String
+
+	if withPayload {
+		msg.req = &delivery.Request{}
+		if err := json.Unmarshal([]byte(payload), msg.req); err != nil {
+			return nil, err
+		}
+
+		msg.req.NotificationID = msg.ID
+	}
+
+	return msg, nil
+}
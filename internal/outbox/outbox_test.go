@@ -0,0 +1,29 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ebogdanov/emu-oncall/internal/config"
+)
+
+func TestBackoff(t *testing.T) {
+	s := &Service{cfg: config.Outbox{Backoff: 10 * time.Second, MaxBackoff: time.Minute}}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 10 * time.Second},
+		{attempt: 2, want: 20 * time.Second},
+		{attempt: 3, want: 40 * time.Second},
+		{attempt: 4, want: time.Minute},
+		{attempt: 10, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := s.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
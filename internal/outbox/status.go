@@ -0,0 +1,198 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
+	"github.com/ebogdanov/emu-oncall/internal/events"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+// receiptDelivered is status of delivery receipt, when message reached handset
+const receiptDelivered = "delivered"
+
+// Filter of notifications listing, empty fields are not applied
+type Filter struct {
+	UserID     string
+	IncidentID int
+	// Channel matches both requested type and channel which delivered notification
+	Channel  string
+	Statuses []string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// Track stores notification which is delivered synchronously, so that it has ID and status as well
+func (s *Service) Track(ctx context.Context, req *delivery.Request) (int64, error) {
+	return s.insert(ctx, req, StatusSending, time.Now(), 1, 1)
+}
+
+// Finish stores result of synchronous delivery
+func (s *Service) Finish(ctx context.Context, id int64, step delivery.Step, err error) {
+	if id == 0 {
+		return
+	}
+
+	msg := &Message{ID: id, Attempt: 1, NextAt: time.Now(), Status: StatusDelivered, Channel: step.Channel, Step: step.String()}
+	if err != nil {
+		msg.Status = StatusFailed
+		msg.Channel, msg.Step = "", ""
+		msg.Error = err.Error()
+	}
+
+	s.update(ctx, msg)
+}
+
+// Get returns notification by ID
+func (s *Service) Get(ctx context.Context, id int64) (*Message, error) {
+	result, err := s.list(ctx, sq.Eq{"id": id}, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return nil, errNotificationMissing
+	}
+
+	return result[0], nil
+}
+
+// List returns notifications, newest first
+func (s *Service) List(ctx context.Context, f Filter) ([]*Message, error) {
+	where := sq.And{}
+
+	if f.UserID != "" {
+		where = append(where, sq.Eq{"user_id": f.UserID})
+	}
+
+	if f.IncidentID != 0 {
+		where = append(where, sq.Eq{"incident_id": f.IncidentID})
+	}
+
+	if f.Channel != "" {
+		where = append(where, sq.Or{sq.Eq{"type": f.Channel}, sq.Eq{"channel": f.Channel}})
+	}
+
+	if len(f.Statuses) > 0 {
+		for _, status := range f.Statuses {
+			switch status {
+			case StatusQueued, StatusSending, StatusDelivered, StatusFailed, StatusAcknowledged:
+			default:
+				return nil, errInvalidStatus
+			}
+		}
+
+		where = append(where, sq.Eq{"status": f.Statuses})
+	}
+
+	if !f.From.IsZero() {
+		where = append(where, sq.GtOrEq{"date_add": f.From})
+	}
+
+	if !f.To.IsZero() {
+		where = append(where, sq.Lt{"date_add": f.To})
+	}
+
+	return s.list(ctx, where, f.Limit)
+}
+
+// Receipt updates status by provider delivery report: failed report fails notification,
+// report of delivery to handset acknowledges it
+func (s *Service) Receipt(ctx context.Context, r plugin.Receipt) error {
+	status := StatusAcknowledged
+
+	switch {
+	case !r.Success:
+		status = StatusFailed
+	case r.Status != receiptDelivered:
+		return nil
+	}
+
+	cnt, err := s.setStatus(ctx, r.ExternalID, status, r.Msg)
+	if err == nil && cnt == 0 {
+		// Notification is marked delivered after plugin returns, receipt may come earlier
+		return events.ErrReceiptNotMatched
+	}
+
+	return err
+}
+
+// Acknowledge marks notification which was matched by plugin call or message ID, e.g. on DTMF callback
+func (s *Service) Acknowledge(ctx context.Context, externalID string) error {
+	_, err := s.setStatus(ctx, externalID, StatusAcknowledged, "")
+
+	return err
+}
+
+// setStatus finds notification by events of its delivery, only delivered notification can change status
+func (s *Service) setStatus(ctx context.Context, externalID, status, msg string) (int64, error) {
+	if externalID == "" {
+		return 0, nil
+	}
+
+	res, err := s.db.ExecContext(ctx, `UPDATE notifications SET status = $1, error = NULLIF($2, ''), updated_at = $3
+		WHERE status = $4 AND id = (
+			SELECT notification_id FROM events WHERE external_id = $5 AND notification_id IS NOT NULL ORDER BY id DESC LIMIT 1
+		)`,
+		status, msg, time.Now(), StatusDelivered, externalID)
+
+	if err != nil {
+		s.logger.Error().Err(err).Str("external_id", externalID).Msg("unable to update notification status")
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *Service) list(ctx context.Context, where sq.Sqlizer, limit int) ([]*Message, error) {
+	if limit <= 0 || limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	query, args, err := sq.Select(colsMessage...).
+		From(tableNotifications).
+		Where(where).
+		OrderBy("id DESC").
+		Limit(uint64(limit)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("failed execute sql select query from %s", tableNotifications)
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	result := make([]*Message, 0)
+
+	for rows.Next() {
+		msg, err := scan(rows, false)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("unable to scan notification row")
+			return nil, err
+		}
+
+		result = append(result, msg)
+	}
+
+	return result, rows.Err()
+}
+
+// IsNotFound reports whether error means that there is no such notification
+func IsNotFound(err error) bool {
+	return errors.Is(err, errNotificationMissing)
+}
+
+// IsInvalidFilter reports whether error is caused by filter of List, not by storage
+func IsInvalidFilter(err error) bool {
+	return errors.Is(err, errInvalidStatus)
+}
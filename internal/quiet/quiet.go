@@ -0,0 +1,399 @@
+package quiet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/config"
+	"github.com/ebogdanov/emu-oncall/internal/db"
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
+	"github.com/ebogdanov/emu-oncall/internal/events"
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+// Actions during quiet hours
+const (
+	ActionDeliver   = "deliver"
+	ActionDowngrade = "downgrade"
+	ActionDefer     = "defer"
+	ActionDelegate  = "delegate"
+
+	// maxMerged limits chain of adjacent windows, e.g. Friday evening followed by weekend
+	maxMerged  = 14
+	clockFmt   = "15:04"
+	untilFmt   = "2006-01-02 15:04 MST"
+	statusPref = "quiet_"
+)
+
+var (
+	errUnknownAction   = errors.New("unknown-quiet-action")
+	errInvalidTimezone = errors.New("invalid-timezone")
+	errInvalidWeekday  = errors.New("invalid-weekday")
+	errInvalidClock    = errors.New("invalid-time-of-day")
+	errInvalidPeriod   = errors.New("invalid-dnd-period")
+	errMissingDelegate = errors.New("delegate-not-found")
+
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday,
+		"mon": time.Monday,
+		"tue": time.Tuesday,
+		"wed": time.Wednesday,
+		"thu": time.Thursday,
+		"fri": time.Friday,
+		"sat": time.Saturday,
+	}
+)
+
+// Window is either weekly quiet hours (weekdays with start and end time of day, end before start means next day)
+// or temporary do-not-disturb period between StartsAt and EndsAt
+type Window struct {
+	ID       int64      `json:"id"`
+	Weekdays []string   `json:"weekdays,omitempty"`
+	Start    string     `json:"start,omitempty"`
+	End      string     `json:"end,omitempty"`
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+// Policy of user, empty actions mean defaults from notify.quiet. Delegate is email of user who gets delegated pages
+type Policy struct {
+	UserID        string    `json:"user_id"`
+	Timezone      string    `json:"timezone"`
+	Critical      string    `json:"critical,omitempty"`
+	Informational string    `json:"informational,omitempty"`
+	Delegate      string    `json:"delegate,omitempty"`
+	Windows       []*Window `json:"windows"`
+	// ActiveUntil is set when user is in quiet hours right now
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+}
+
+// Decision is what should be done with notification, Until is end of quiet hours
+type Decision struct {
+	Action   string
+	Until    time.Time
+	Delegate *user.Item
+}
+
+// Service applies quiet hours and do-not-disturb periods of users to notifications
+type Service struct {
+	cfg        config.Quiet
+	db         *db.DBx
+	users      *user.Storage
+	actionsLog events.Service
+	logger     zerolog.Logger
+	pm         *metrics.Storage
+}
+
+func New(cfg config.Quiet, dbx *db.DBx, users *user.Storage, actionsLog events.Service, l zerolog.Logger,
+	pm *metrics.Storage) (*Service, error) {
+	for _, action := range []string{cfg.Critical, cfg.Informational} {
+		if !knownAction(action) {
+			return nil, fmt.Errorf("%w: %q", errUnknownAction, action)
+		}
+	}
+
+	return &Service{
+		cfg:        cfg,
+		db:         dbx,
+		users:      users,
+		actionsLog: actionsLog,
+		logger:     l.With().Str("component", "quiet").Logger(),
+		pm:         pm,
+	}, nil
+}
+
+// Decide checks whether user is in quiet hours, every action except deliver is recorded in events.
+// Notification is delivered when policy can't be loaded or delegate can't be paged
+func (s *Service) Decide(ctx context.Context, req *delivery.Request) *Decision {
+	result := &Decision{Action: ActionDeliver}
+
+	p, err := s.Policy(ctx, req.User.ID)
+	if err != nil {
+		return result
+	}
+
+	now := time.Now()
+
+	result.Until = p.Until(now)
+	if result.Until.IsZero() {
+		return result
+	}
+
+	result.Action = s.action(p, req)
+
+	switch result.Action {
+	case ActionDowngrade:
+		// Only calls are downgraded, sms is already the quiet channel
+		if req.Type != plugin.ChannelPhone {
+			result.Action = ActionDeliver
+		}
+	case ActionDelegate:
+		result.Delegate = s.delegate(ctx, p, req.Type)
+		if result.Delegate == nil {
+			result.Action = ActionDeliver
+		}
+	}
+
+	if result.Action != ActionDeliver {
+		s.audit(req, p, result, now)
+	}
+
+	return result
+}
+
+// action is taken from user policy or defaults by alert criticality
+func (s *Service) action(p *Policy, req *delivery.Request) string {
+	if s.critical(req) {
+		if p.Critical != "" {
+			return p.Critical
+		}
+
+		return s.cfg.Critical
+	}
+
+	if p.Informational != "" {
+		return p.Informational
+	}
+
+	return s.cfg.Informational
+}
+
+// critical reports whether alert has critical severity, alert without known severity is treated as critical
+func (s *Service) critical(req *delivery.Request) bool {
+	if req.Severity == "" {
+		return true
+	}
+
+	for _, severity := range s.cfg.CriticalSeverities {
+		if strings.EqualFold(severity, req.Severity) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Service) delegate(ctx context.Context, p *Policy, notificationType string) *user.Item {
+	if p.Delegate == "" {
+		s.logger.Warn().Str("user_id", p.UserID).Msg("Quiet policy delegates page, but delegate is not set")
+		return nil
+	}
+
+	delegate, err := s.users.WithEmail(ctx, p.Delegate)
+	if err == nil {
+		delegate.Prefer(notificationType)
+	}
+
+	if err != nil || delegate.ID == "" || delegate.ID == p.UserID || !reachable(delegate, notificationType) {
+		s.logger.Warn().
+			Err(err).
+			Str("user_id", p.UserID).
+			Str("delegate", p.Delegate).
+			Msg("Delegate can't be paged, notification is delivered to user")
+
+		return nil
+	}
+
+	return delegate
+}
+
+// reachable reports whether user has contact for notification type: slack member or verified phone number
+func reachable(u *user.Item, notificationType string) bool {
+	if notificationType == plugin.ChannelSlack {
+		return u.Slack != nil && u.Slack.UserID != ""
+	}
+
+	return u.IsPhoneNumberVerified && u.PhoneNumber != ""
+}
+
+func (s *Service) audit(req *delivery.Request, p *Policy, d *Decision, now time.Time) {
+	until := d.Until.In(p.location()).Format(untilFmt)
+
+	msg := fmt.Sprintf("Quiet hours until %s, %s is deferred", until, req.Type)
+	recipient := req.User.PhoneNumber
+
+	switch d.Action {
+	case ActionDowngrade:
+		msg = fmt.Sprintf("Quiet hours until %s, phone call is downgraded to sms", until)
+	case ActionDelegate:
+		msg = fmt.Sprintf("Quiet hours until %s, %s is delegated to %s", until, req.Type, d.Delegate.Email)
+		recipient = d.Delegate.PhoneNumber
+		if req.Type == plugin.ChannelSlack {
+			recipient = d.Delegate.ID
+		}
+	}
+
+	s.pm.Notifications.WithLabelValues(statusPref + d.Action).Inc()
+
+	s.logger.Info().
+		Str("user_id", req.User.ID).
+		Str("notification_type", req.Type).
+		Int("incident_id", req.IncidentID).
+		Str("request_id", req.RequestID).
+		Str("action", d.Action).
+		Time("until", d.Until).
+		Msg("Notification during quiet hours")
+
+	if s.actionsLog != nil {
+		_ = s.actionsLog.Add(&events.Record{
+			Timestamp:  now,
+			UserID:     req.User.ID,
+			Recipient:  recipient,
+			Channel:    req.Type,
+			Success:    true,
+			Msg:        msg,
+			Status:     statusPref + d.Action,
+			AlertID:    req.AlertID,
+			IncidentID: req.IncidentID,
+		})
+	}
+}
+
+// Until returns end of quiet hours which cover now, adjacent windows are merged. Zero time means user is available
+func (p *Policy) Until(now time.Time) time.Time {
+	var (
+		loc   = p.location()
+		until time.Time
+	)
+
+	for i := 0; i < maxMerged; i++ {
+		next := now
+		if !until.IsZero() {
+			next = until
+		}
+
+		end := time.Time{}
+		for _, w := range p.Windows {
+			if e := w.until(next, loc); e.After(end) {
+				end = e
+			}
+		}
+
+		if !end.After(next) {
+			break
+		}
+
+		until = end
+	}
+
+	return until
+}
+
+// Validate checks policy fields, windows are validated separately
+func (p *Policy) Validate() error {
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return errInvalidTimezone
+	}
+
+	for _, action := range []string{p.Critical, p.Informational} {
+		if action != "" && !knownAction(action) {
+			return errUnknownAction
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) location() *time.Location {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// Validate checks that window is either quiet hours or do-not-disturb period
+func (w *Window) Validate() error {
+	if w.StartsAt != nil || w.EndsAt != nil {
+		if w.StartsAt == nil || w.EndsAt == nil || !w.EndsAt.After(*w.StartsAt) {
+			return errInvalidPeriod
+		}
+
+		return nil
+	}
+
+	if len(w.Weekdays) == 0 {
+		return errInvalidWeekday
+	}
+
+	for _, day := range w.Weekdays {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return errInvalidWeekday
+		}
+	}
+
+	for _, clock := range []string{w.Start, w.End} {
+		if _, err := time.Parse(clockFmt, clock); err != nil {
+			return errInvalidClock
+		}
+	}
+
+	return nil
+}
+
+// until returns end of window when now is inside it, otherwise zero time.
+// Quiet hours started on previous day are checked as well, e.g. 22:00-07:00
+func (w *Window) until(now time.Time, loc *time.Location) time.Time {
+	if w.StartsAt != nil && w.EndsAt != nil {
+		if !now.Before(*w.StartsAt) && now.Before(*w.EndsAt) {
+			return *w.EndsAt
+		}
+
+		return time.Time{}
+	}
+
+	start, errStart := time.Parse(clockFmt, w.Start)
+	end, errEnd := time.Parse(clockFmt, w.End)
+	if errStart != nil || errEnd != nil {
+		return time.Time{}
+	}
+
+	local := now.In(loc)
+
+	for _, offset := range []int{0, -1} {
+		day := local.AddDate(0, 0, offset)
+		if !w.has(day.Weekday()) {
+			continue
+		}
+
+		from := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+		to := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+		if !to.After(from) {
+			to = to.AddDate(0, 0, 1)
+		}
+
+		if !now.Before(from) && now.Before(to) {
+			return to
+		}
+	}
+
+	return time.Time{}
+}
+
+func (w *Window) has(day time.Weekday) bool {
+	for _, name := range w.Weekdays {
+		if d, ok := weekdays[strings.ToLower(name)]; ok && d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+func knownAction(action string) bool {
+	switch action {
+	case ActionDeliver, ActionDowngrade, ActionDefer, ActionDelegate:
+		return true
+	}
+
+	return false
+}
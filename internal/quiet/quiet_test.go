@@ -0,0 +1,189 @@
+package quiet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+func TestPolicyUntil(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2024-01-01 is Monday, clocks in Berlin are moved forward at 2024-03-31 02:00
+	at := func(loc *time.Location, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, loc)
+	}
+	utc := func(day, hour int) time.Time {
+		return at(time.UTC, time.January, day, hour, 0)
+	}
+	period := func(from, to time.Time) *Window {
+		return &Window{StartsAt: &from, EndsAt: &to}
+	}
+
+	nights := &Window{Weekdays: []string{"mon"}, Start: "22:00", End: "07:00"}
+
+	tests := []struct {
+		name     string
+		timezone string
+		windows  []*Window
+		now      time.Time
+		want     time.Time
+	}{
+		{
+			name:    "no windows",
+			windows: nil,
+			now:     utc(1, 23),
+		},
+		{
+			name:    "overnight window",
+			windows: []*Window{nights},
+			now:     utc(1, 23),
+			want:    utc(2, 7),
+		},
+		{
+			name:    "overnight window started on previous day",
+			windows: []*Window{nights},
+			now:     utc(2, 6),
+			want:    utc(2, 7),
+		},
+		{
+			name:    "end of window is excluded",
+			windows: []*Window{nights},
+			now:     utc(2, 7),
+		},
+		{
+			name:    "other weekday",
+			windows: []*Window{nights},
+			now:     utc(2, 23),
+		},
+		{
+			name:    "before start",
+			windows: []*Window{nights},
+			now:     utc(1, 21),
+		},
+		{
+			name:    "day window",
+			windows: []*Window{{Weekdays: []string{"Tue"}, Start: "12:00", End: "13:00"}},
+			now:     at(time.UTC, time.January, 2, 12, 30),
+			want:    utc(2, 13),
+		},
+		{
+			name:     "time of day in policy timezone",
+			timezone: "Europe/Moscow",
+			windows:  []*Window{nights},
+			now:      utc(1, 20),
+			want:     utc(2, 4),
+		},
+		{
+			name: "adjacent windows are merged",
+			windows: []*Window{
+				{Weekdays: []string{"fri"}, Start: "18:00", End: "00:00"},
+				{Weekdays: []string{"sat", "sun"}, Start: "00:00", End: "00:00"},
+				{Weekdays: []string{"mon"}, Start: "00:00", End: "09:00"},
+			},
+			now:  utc(5, 20),
+			want: utc(8, 9),
+		},
+		{
+			name: "gap between windows",
+			windows: []*Window{
+				{Weekdays: []string{"fri"}, Start: "18:00", End: "23:00"},
+				{Weekdays: []string{"sat"}, Start: "00:00", End: "09:00"},
+			},
+			now:  utc(5, 20),
+			want: utc(5, 23),
+		},
+		{
+			name:     "window over daylight saving time change",
+			timezone: "Europe/Berlin",
+			windows:  []*Window{{Weekdays: []string{"sat"}, Start: "22:00", End: "07:00"}},
+			now:      at(berlin, time.March, 31, 1, 30),
+			want:     at(berlin, time.March, 31, 7, 0),
+		},
+		{
+			name:    "do-not-disturb period",
+			windows: []*Window{period(utc(3, 0), utc(5, 0))},
+			now:     utc(4, 12),
+			want:    utc(5, 0),
+		},
+		{
+			name:    "do-not-disturb period is over",
+			windows: []*Window{period(utc(3, 0), utc(5, 0))},
+			now:     utc(5, 0),
+		},
+		{
+			name:    "do-not-disturb period extends quiet hours",
+			windows: []*Window{nights, period(utc(2, 6), utc(2, 12))},
+			now:     utc(1, 23),
+			want:    utc(2, 12),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timezone := tt.timezone
+			if timezone == "" {
+				timezone = "UTC"
+			}
+
+			p := &Policy{Timezone: timezone, Windows: tt.windows}
+			if got := p.Until(tt.now); !got.Equal(tt.want) {
+				t.Errorf("Until(%s) = %s, want %s", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowUntilDaylightSavingTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Window{Weekdays: []string{"sat"}, Start: "22:00", End: "07:00"}
+
+	// Night of clocks change is one hour shorter, but ends at the same time of day
+	from := time.Date(2024, time.March, 30, 22, 0, 0, 0, berlin)
+	want := time.Date(2024, time.March, 31, 7, 0, 0, 0, berlin)
+
+	if got := w.until(from, berlin); !got.Equal(want) {
+		t.Fatalf("until(%s) = %s, want %s", from, got, want)
+	}
+
+	if got := want.Sub(from); got != 8*time.Hour {
+		t.Errorf("window lasts %s, want %s", got, 8*time.Hour)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	phone := &user.Item{PhoneNumber: "+10000000000", IsPhoneNumberVerified: true}
+	unverified := &user.Item{PhoneNumber: "+10000000000"}
+	slack := &user.Item{Slack: &user.Slack{UserID: "U1"}}
+
+	tests := []struct {
+		name             string
+		item             *user.Item
+		notificationType string
+		want             bool
+	}{
+		{name: "phone call to verified phone", item: phone, notificationType: plugin.ChannelPhone, want: true},
+		{name: "sms to verified phone", item: phone, notificationType: plugin.ChannelSMS, want: true},
+		{name: "phone call to unverified phone", item: unverified, notificationType: plugin.ChannelPhone},
+		{name: "slack message without phone", item: slack, notificationType: plugin.ChannelSlack, want: true},
+		{name: "slack message without slack member", item: phone, notificationType: plugin.ChannelSlack},
+		{name: "phone call to slack member", item: slack, notificationType: plugin.ChannelPhone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reachable(tt.item, tt.notificationType); got != tt.want {
+				t.Errorf("reachable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package quiet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	tablePolicies = "quiet_policies"
+	tableWindows  = "quiet_windows"
+)
+
+var (
+	colsWindow = []string{"id", "weekdays", "start_time", "end_time", "starts_at", "ends_at", "reason"}
+
+	errWindowNotFound = errors.New("quiet-window-not-found")
+)
+
+// IsNotFound reports whether error means that window does not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, errWindowNotFound)
+}
+
+// Policy loads user policy with windows, user without stored policy gets defaults
+func (s *Service) Policy(ctx context.Context, userID string) (*Policy, error) {
+	p := &Policy{UserID: userID, Timezone: time.UTC.String(), Windows: []*Window{}}
+
+	var (
+		critical      sql.NullString
+		informational sql.NullString
+		delegate      sql.NullString
+	)
+
+	query, args, err := sq.Select("timezone", "critical", "informational", "delegate").
+		From(tablePolicies).
+		Where(sq.Eq{"user_id": userID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(&p.Timezone, &critical, &informational, &delegate)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to select from %s", tablePolicies)
+		return nil, err
+	}
+
+	p.Critical = critical.String
+	p.Informational = informational.String
+	p.Delegate = delegate.String
+
+	if p.Windows, err = s.windows(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if until := p.Until(time.Now()); !until.IsZero() {
+		p.ActiveUntil = &until
+	}
+
+	return p, nil
+}
+
+// SavePolicy stores timezone, actions and delegate of user, windows are not changed
+func (s *Service) SavePolicy(ctx context.Context, p *Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	if p.Delegate != "" {
+		delegate, err := s.users.WithEmail(ctx, p.Delegate)
+		if err != nil || delegate.ID == "" || delegate.ID == p.UserID {
+			return errMissingDelegate
+		}
+	}
+
+	query, args, err := sq.Insert(tablePolicies).
+		Columns("user_id", "timezone", "critical", "informational", "delegate", "updated_at").
+		Values(p.UserID, p.Timezone, nullString(p.Critical), nullString(p.Informational), nullString(p.Delegate), time.Now()).
+		Suffix(`ON CONFLICT (user_id) DO UPDATE SET timezone = EXCLUDED.timezone, critical = EXCLUDED.critical,
+			informational = EXCLUDED.informational, delegate = EXCLUDED.delegate, updated_at = EXCLUDED.updated_at`).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
+		s.logger.Error().Err(err).Str("user_id", p.UserID).Msgf("unable to save into %s", tablePolicies)
+		return err
+	}
+
+	return nil
+}
+
+// AddWindow stores quiet hours or do-not-disturb period of user
+func (s *Service) AddWindow(ctx context.Context, userID string, w *Window) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	var startsAt, endsAt interface{}
+	if w.StartsAt != nil {
+		startsAt, endsAt = w.StartsAt.UTC(), w.EndsAt.UTC()
+	}
+
+	days := make([]string, 0, len(w.Weekdays))
+	for _, day := range w.Weekdays {
+		days = append(days, strings.ToLower(day))
+	}
+
+	query, args, err := sq.Insert(tableWindows).
+		Columns("date_add", "user_id", "weekdays", "start_time", "end_time", "starts_at", "ends_at", "reason").
+		Values(time.Now(), userID, nullString(strings.Join(days, ",")), nullString(w.Start), nullString(w.End),
+			startsAt, endsAt, nullString(w.Reason)).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.QueryRowContext(ctx, query, args...).Scan(&w.ID); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to insert into %s", tableWindows)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteWindow removes window of user
+func (s *Service) DeleteWindow(ctx context.Context, userID string, id int64) error {
+	query, args, err := sq.Delete(tableWindows).
+		Where(sq.Eq{"id": id, "user_id": userID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Int64("id", id).Msgf("unable to delete from %s", tableWindows)
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errWindowNotFound
+	}
+
+	return nil
+}
+
+func (s *Service) windows(ctx context.Context, userID string) ([]*Window, error) {
+	query, args, err := sq.Select(colsWindow...).
+		From(tableWindows).
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("id ASC").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to select from %s", tableWindows)
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	result := make([]*Window, 0)
+
+	for rows.Next() {
+		var (
+			w        = &Window{}
+			days     sql.NullString
+			start    sql.NullString
+			end      sql.NullString
+			startsAt sql.NullTime
+			endsAt   sql.NullTime
+			reason   sql.NullString
+		)
+
+		if err = rows.Scan(&w.ID, &days, &start, &end, &startsAt, &endsAt, &reason); err != nil {
+			return nil, err
+		}
+
+		if days.String != "" {
+			w.Weekdays = strings.Split(days.String, ",")
+		}
+
+		w.Start, w.End, w.Reason = start.String, end.String, reason.String
+
+		if startsAt.Valid && endsAt.Valid {
+			from, to := utc(startsAt.Time), utc(endsAt.Time)
+			w.StartsAt, w.EndsAt = &from, &to
+		}
+
+		result = append(result, w)
+	}
+
+	return result, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// utc restores UTC of period, column has no time zone
+func utc(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
@@ -0,0 +1,348 @@
+package redial
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/config"
+	"github.com/ebogdanov/emu-oncall/internal/db"
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
+	"github.com/ebogdanov/emu-oncall/internal/events"
+	"github.com/ebogdanov/emu-oncall/internal/grafana"
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+const (
+	tableRedials = "redials"
+
+	statusPending      = "pending"
+	statusAnswered     = "answered"
+	statusAcknowledged = "acknowledged"
+	statusExhausted    = "exhausted"
+	statusCancelled    = "cancelled"
+
+	maxPollInterval = 10 * time.Second
+	batchSize       = 100
+)
+
+var (
+	colsRedial = []string{"id", "date_add", "email", "alert_id", "incident_id", "request_id", "text", "attempt", "attempts"}
+)
+
+type item struct {
+	id         int64
+	created    time.Time
+	email      string
+	alertID    string
+	incidentID int
+	requestID  string
+	text       string
+	attempt    int
+	attempts   int
+}
+
+// Service redials unanswered phone calls until call is answered or alert group is handled.
+// Pending calls are stored in database, so that policy survives restarts
+type Service struct {
+	cfg        config.Redial
+	db         *db.DBx
+	dispatcher *delivery.Dispatcher
+	users      *user.Storage
+	grafanaSvc grafana.Service
+	actionsLog events.Service
+	logger     zerolog.Logger
+	pm         *metrics.Storage
+
+	inFlight sync.WaitGroup
+}
+
+func New(cfg config.Redial, dbx *db.DBx, dispatcher *delivery.Dispatcher, users *user.Storage,
+	gfSvc grafana.Service, actionsLog events.Service, l zerolog.Logger, pm *metrics.Storage) *Service {
+	return &Service{
+		cfg:        cfg,
+		db:         dbx,
+		dispatcher: dispatcher,
+		users:      users,
+		grafanaSvc: gfSvc,
+		actionsLog: actionsLog,
+		logger:     l.With().Str("component", "redial").Logger(),
+		pm:         pm,
+	}
+}
+
+// Enabled reports whether policy allows more than one call
+func (s *Service) Enabled() bool {
+	return s.cfg.Attempts > 1
+}
+
+// Applies reports whether unanswered call for this notification should be repeated
+func (s *Service) Applies(req *delivery.Request) bool {
+	if !s.Enabled() || req.Type != plugin.ChannelPhone {
+		return false
+	}
+
+	if len(s.cfg.Severities) == 0 {
+		return true
+	}
+
+	for _, severity := range s.cfg.Severities {
+		if strings.EqualFold(severity, req.Severity) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Answered reports whether call was answered: only plugins which wait for callee (e.g. voip) report it,
+// call which was only accepted by provider is not answered
+func Answered(req *delivery.Request, step delivery.Step, err error) bool {
+	return err == nil && step.Channel == plugin.ChannelPhone && req.Result.Status == plugin.CallAnswered
+}
+
+// Schedule stores unanswered call, first call is counted as attempt
+func (s *Service) Schedule(ctx context.Context, req *delivery.Request) error {
+	if !s.Applies(req) {
+		return nil
+	}
+
+	text := req.Text
+	if t, ok := req.Texts[plugin.ChannelPhone]; ok {
+		text = t
+	}
+
+	now := time.Now()
+
+	query, args, err := sq.Insert(tableRedials).
+		Columns("date_add", "next_at", "email", "alert_id", "incident_id", "request_id", "text", "attempt", "attempts", "status").
+		Values(now, now.Add(s.cfg.Delay), req.User.Email, req.AlertID, req.IncidentID, req.RequestID, text, 1, s.cfg.Attempts, statusPending).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
+		s.logger.Error().Err(err).Str("email", req.User.Email).Msg("unable to schedule redial")
+		return err
+	}
+
+	s.logger.Info().
+		Str("email", req.User.Email).
+		Int("incident_id", req.IncidentID).
+		Dur("delay", s.cfg.Delay).
+		Int("attempts", s.cfg.Attempts).
+		Msg("Call was not answered, redial is scheduled")
+
+	return nil
+}
+
+// Start polls due calls until context is cancelled
+func (s *Service) Start(ctx context.Context) {
+	if !s.Enabled() {
+		return
+	}
+
+	interval := s.cfg.Delay
+	if interval > maxPollInterval || interval <= 0 {
+		interval = maxPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.inFlight.Wait()
+			return
+		case <-ticker.C:
+			s.poll(ctx)
+		}
+	}
+}
+
+func (s *Service) poll(ctx context.Context) {
+	now := time.Now()
+
+	query, args, err := sq.Select(colsRedial...).
+		From(tableRedials).
+		Where(sq.Eq{"status": statusPending}).
+		Where(sq.LtOrEq{"next_at": now}).
+		OrderBy("next_at ASC").
+		Limit(batchSize).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("failed execute sql select query from %s", tableRedials)
+		return
+	}
+
+	var due []*item
+
+	for rows.Next() {
+		var (
+			i          = &item{}
+			alertID    sql.NullString
+			incidentID sql.NullInt64
+			requestID  sql.NullString
+		)
+
+		if err = rows.Scan(&i.id, &i.created, &i.email, &alertID, &incidentID, &requestID, &i.text, &i.attempt, &i.attempts); err != nil {
+			s.logger.Error().Err(err).Msg("unable to scan redial row")
+			break
+		}
+
+		i.alertID = alertID.String
+		i.incidentID = int(incidentID.Int64)
+		i.requestID = requestID.String
+
+		due = append(due, i)
+	}
+	_ = rows.Close()
+
+	for _, i := range due {
+		if !s.claim(ctx, i, now) {
+			continue
+		}
+
+		s.inFlight.Add(1)
+
+		// Call which is in progress is finished on shutdown, otherwise it's placed again after restart
+		go func(i *item) {
+			defer s.inFlight.Done()
+			s.redial(context.WithoutCancel(ctx), i)
+		}(i)
+	}
+}
+
+// claim moves next_at forward, so that call which is in progress is not picked up by next poll.
+// If process stops during call, it's retried after delay
+func (s *Service) claim(ctx context.Context, i *item, now time.Time) bool {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE redials SET next_at = $1 WHERE id = $2 AND status = $3 AND next_at <= $4",
+		now.Add(s.cfg.Delay), i.id, statusPending, now)
+	if err != nil {
+		s.logger.Error().Err(err).Int64("id", i.id).Msg("unable to claim redial")
+		return false
+	}
+
+	cnt, _ := res.RowsAffected()
+
+	return cnt == 1
+}
+
+func (s *Service) redial(ctx context.Context, i *item) {
+	n := plugin.Notification{
+		RequestID:  i.requestID,
+		Type:       plugin.ChannelPhone,
+		AlertID:    i.alertID,
+		IncidentID: i.incidentID,
+		Text:       i.text,
+	}
+
+	if i.incidentID != 0 {
+		if s.handled(ctx, i, &n) {
+			s.finish(ctx, i, i.attempt, statusAcknowledged)
+			return
+		}
+	}
+
+	recipient, err := s.users.WithEmail(ctx, i.email)
+	if err != nil || recipient.ID == "" {
+		s.logger.Warn().Err(err).Str("email", i.email).Msg("User for redial is not found")
+		s.finish(ctx, i, i.attempt, statusCancelled)
+
+		return
+	}
+	recipient.Prefer(plugin.ChannelPhone)
+	n.User = *recipient
+
+	s.pm.Notifications.WithLabelValues("redial").Inc()
+
+	attempt := i.attempt + 1
+	req := &delivery.Request{Notification: n}
+	step := s.step()
+	err = s.dispatcher.DeliverStep(ctx, req, step, attempt)
+
+	switch {
+	case Answered(req, step, err):
+		s.finish(ctx, i, attempt, statusAnswered)
+	case attempt >= i.attempts:
+		s.finish(ctx, i, attempt, statusExhausted)
+	default:
+		s.update(ctx, i, attempt, statusPending)
+	}
+}
+
+// handled checks OnCall alert group and DTMF callbacks, alert group data is copied into notification
+func (s *Service) handled(ctx context.Context, i *item, n *plugin.Notification) bool {
+	alertGroup, err := s.grafanaSvc.AlertGroup(ctx, i.incidentID)
+	if err != nil {
+		s.logger.Warn().Err(err).Int("incident_id", i.incidentID).Msg("Unable to check alert group, redial anyway")
+	}
+
+	if alertGroup != nil {
+		alertGroup.Fill(n)
+
+		if alertGroup.Handled() {
+			return true
+		}
+	}
+
+	acknowledged, _ := s.actionsLog.Acknowledged(ctx, i.incidentID, i.created)
+
+	return acknowledged
+}
+
+// step is the first phone step of phone fallback chain
+func (s *Service) step() delivery.Step {
+	for _, step := range s.dispatcher.Chain(plugin.ChannelPhone) {
+		if step.Channel == plugin.ChannelPhone {
+			return step
+		}
+	}
+
+	return delivery.Step{Channel: plugin.ChannelPhone, Instance: plugin.DefaultInstance}
+}
+
+func (s *Service) finish(ctx context.Context, i *item, attempt int, status string) {
+	s.update(ctx, i, attempt, status)
+
+	s.logger.Info().
+		Str("email", i.email).
+		Int("incident_id", i.incidentID).
+		Int("attempt", attempt).
+		Str("status", status).
+		Msg("Redial is finished")
+}
+
+func (s *Service) update(ctx context.Context, i *item, attempt int, status string) {
+	query, args, err := sq.Update(tableRedials).
+		Set("attempt", attempt).
+		Set("status", status).
+		Set("next_at", time.Now().Add(s.cfg.Delay)).
+		Where(sq.Eq{"id": i.id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
+		s.logger.Error().Err(err).Int64("id", i.id).Msg("unable to update redial")
+	}
+}
@@ -0,0 +1,36 @@
+package redial
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ebogdanov/emu-oncall/internal/delivery"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+func TestAnswered(t *testing.T) {
+	phone := delivery.Step{Channel: plugin.ChannelPhone, Instance: plugin.DefaultInstance}
+	sms := delivery.Step{Channel: plugin.ChannelSMS, Instance: plugin.DefaultInstance}
+
+	tests := []struct {
+		name   string
+		step   delivery.Step
+		status string
+		err    error
+		want   bool
+	}{
+		{name: "answered call", step: phone, status: plugin.CallAnswered, want: true},
+		{name: "call accepted by webhook", step: phone, status: "sent"},
+		{name: "call without status", step: phone},
+		{name: "busy", step: phone, status: plugin.CallBusy, err: errors.New("busy")},
+		{name: "delivered by sms fallback", step: sms, status: plugin.CallAnswered},
+	}
+
+	for _, tt := range tests {
+		req := &delivery.Request{Result: plugin.Result{Status: tt.status}}
+
+		if got := Answered(req, tt.step, tt.err); got != tt.want {
+			t.Errorf("%s: answered %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
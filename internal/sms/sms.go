@@ -0,0 +1,278 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/ebogdanov/emu-oncall/internal/translit"
+)
+
+// Encodings of sms text
+const (
+	EncodingGSM7 = "gsm7"
+	EncodingUCS2 = "ucs2"
+)
+
+// Segment sizes, in septets for GSM-7 and UTF-16 code units for UCS-2.
+// Long message loses part of every segment for concatenation header
+const (
+	singleGSM7 = 160
+	partGSM7   = 153
+	singleUCS2 = 70
+	partUCS2   = 67
+)
+
+// ErrNotGSM7 is returned by Encode for characters which are out of GSM 03.38 alphabet
+var ErrNotGSM7 = errors.New("character is not in GSM 03.38 alphabet")
+
+var (
+	regexpLink     = regexp.MustCompile(`https?://\S+`)
+	regexpIncident = regexp.MustCompile(`#\d+`)
+)
+
+// gsm7Alphabet is GSM 03.38 default alphabet in order of septet codes, 0x1B is escape to extension table
+const (
+	gsm7Alphabet = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Escape = 0x1B
+)
+
+// gsm7Basic maps character to its septet, gsm7Extension characters take two septets (escape + code)
+var (
+	gsm7Basic     = alphabet(gsm7Alphabet)
+	gsm7Extension = map[rune]byte{
+		'\f': 0x0A,
+		'^':  0x14,
+		'{':  0x28,
+		'}':  0x29,
+		'\\': 0x2F,
+		'[':  0x3C,
+		'~':  0x3D,
+		']':  0x3E,
+		'|':  0x40,
+		'€':  0x65,
+	}
+)
+
+// Options of sms preparation
+type Options struct {
+	// Translit replaces Cyrillic with Latin, so that message fits GSM-7
+	Translit bool
+	// MaxSegments limits message length, 0 is unlimited
+	MaxSegments int
+}
+
+// Message is sms text with its encoding and count of segments which are billed by provider
+type Message struct {
+	Text     string
+	Encoding string
+	// Length is in septets for GSM-7 and in UTF-16 code units for UCS-2
+	Length   int
+	Segments int
+}
+
+// Prepare transliterates and truncates text according to options
+func Prepare(text string, opts Options) Message {
+	if opts.Translit {
+		text = translit.String(text)
+	}
+
+	return Analyze(Truncate(text, opts.MaxSegments))
+}
+
+// Analyze detects encoding and counts segments
+func Analyze(text string) Message {
+	encoding := Encoding(text)
+	length := units(text, encoding)
+
+	return Message{
+		Text:     text,
+		Encoding: encoding,
+		Length:   length,
+		Segments: segments(length, encoding),
+	}
+}
+
+// Encoding is GSM-7 when every character is in GSM 03.38 alphabet, otherwise message is sent as UCS-2
+func Encoding(text string) string {
+	for _, r := range text {
+		if !isGSM7(r) {
+			return EncodingUCS2
+		}
+	}
+
+	return EncodingGSM7
+}
+
+// Split divides text into segments of concatenated message by the same limits which Analyze counts.
+// Characters are never split, so GSM-7 escape and its code or UTF-16 surrogate pair stay in one segment
+func Split(text, encoding string) []string {
+	single, part := sizes(encoding)
+	if units(text, encoding) <= single {
+		return []string{text}
+	}
+
+	var (
+		result []string
+		start  int
+		length int
+	)
+
+	for i, r := range text {
+		size := runeUnits(r, encoding)
+		if length+size > part {
+			result = append(result, text[start:i])
+			start, length = i, 0
+		}
+
+		length += size
+	}
+
+	return append(result, text[start:])
+}
+
+// Encode returns message bytes as they are sent by SMSC: unpacked GSM 03.38 septets, one per octet,
+// or big-endian UTF-16 for UCS-2. GSM-7 fails for characters out of the alphabet
+func Encode(text, encoding string) ([]byte, error) {
+	if encoding == EncodingUCS2 {
+		result := make([]byte, 0, 2*len(text))
+		for _, u := range utf16.Encode([]rune(text)) {
+			result = append(result, byte(u>>8), byte(u))
+		}
+
+		return result, nil
+	}
+
+	result := make([]byte, 0, len(text))
+
+	for _, r := range text {
+		if code, ok := gsm7Basic[r]; ok {
+			result = append(result, code)
+			continue
+		}
+
+		code, ok := gsm7Extension[r]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrNotGSM7, r)
+		}
+
+		result = append(result, gsm7Escape, code)
+	}
+
+	return result, nil
+}
+
+// Truncate cuts text to fit maxSegments. Incident number and the first link are kept,
+// since they are the only parts needed to find alert group
+func Truncate(text string, maxSegments int) string {
+	if maxSegments <= 0 || Analyze(text).Segments <= maxSegments {
+		return text
+	}
+
+	encoding := Encoding(text)
+
+	single, part := sizes(encoding)
+	capacity := maxSegments * part
+	if maxSegments == 1 {
+		capacity = single
+	}
+
+	suffix := ""
+	if link := regexpLink.FindString(text); link != "" {
+		suffix = " " + link
+	}
+
+	budget := capacity - units(suffix, encoding)
+	if budget <= 0 {
+		return cut(text, capacity, encoding)
+	}
+
+	body := strings.Join(strings.Fields(regexpLink.ReplaceAllString(text, "")), " ")
+	short := cut(body, budget, encoding)
+
+	if incident := regexpIncident.FindString(body); incident != "" && !strings.Contains(short, incident) {
+		short = cut(incident+" "+body, budget, encoding)
+	}
+
+	return strings.TrimSpace(short) + suffix
+}
+
+// cut keeps characters while they fit limit
+func cut(text string, limit int, encoding string) string {
+	length := 0
+
+	for i, r := range text {
+		size := runeUnits(r, encoding)
+		if length+size > limit {
+			return text[:i]
+		}
+
+		length += size
+	}
+
+	return text
+}
+
+func units(text, encoding string) int {
+	length := 0
+	for _, r := range text {
+		length += runeUnits(r, encoding)
+	}
+
+	return length
+}
+
+func runeUnits(r rune, encoding string) int {
+	if encoding == EncodingUCS2 {
+		return len(utf16.Encode([]rune{r}))
+	}
+
+	if _, ok := gsm7Extension[r]; ok {
+		return 2
+	}
+
+	return 1
+}
+
+func segments(length int, encoding string) int {
+	single, part := sizes(encoding)
+
+	if length <= single {
+		return 1
+	}
+
+	return (length + part - 1) / part
+}
+
+func sizes(encoding string) (single, part int) {
+	if encoding == EncodingUCS2 {
+		return singleUCS2, partUCS2
+	}
+
+	return singleGSM7, partGSM7
+}
+
+func isGSM7(r rune) bool {
+	if _, ok := gsm7Basic[r]; ok {
+		return true
+	}
+
+	_, ok := gsm7Extension[r]
+
+	return ok
+}
+
+// alphabet maps characters to their position, escape is not a character of its own
+func alphabet(chars string) map[rune]byte {
+	result := make(map[rune]byte)
+	for i, r := range []rune(chars) {
+		if i != gsm7Escape {
+			result[r] = byte(i)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,132 @@
+package sms
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAlphabetHasAllSeptets(t *testing.T) {
+	// 128 codes, escape is not a character
+	if len(gsm7Basic) != 127 {
+		t.Fatalf("alphabet has %d characters", len(gsm7Basic))
+	}
+
+	tests := map[rune]byte{'@': 0x00, '\n': 0x0A, 'Δ': 0x10, 'Æ': 0x1C, ' ': 0x20, '¡': 0x40, 'A': 0x41, '§': 0x5F, '¿': 0x60, 'à': 0x7F}
+	for r, want := range tests {
+		if got := gsm7Basic[r]; got != want {
+			t.Errorf("%q is 0x%02X, want 0x%02X", r, got, want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		encoding string
+		want     []byte
+		wantErr  error
+	}{
+		{name: "ascii letters", text: "Hi", encoding: EncodingGSM7, want: []byte{0x48, 0x69}},
+		{name: "at sign is zero", text: "a@b", encoding: EncodingGSM7, want: []byte{0x61, 0x00, 0x62}},
+		{name: "national characters", text: "£è_", encoding: EncodingGSM7, want: []byte{0x01, 0x04, 0x11}},
+		{name: "extension table", text: "{€}", encoding: EncodingGSM7, want: []byte{0x1B, 0x28, 0x1B, 0x65, 0x1B, 0x29}},
+		{name: "backtick is not gsm", text: "`", encoding: EncodingGSM7, wantErr: ErrNotGSM7},
+		{name: "cyrillic as ucs2", text: "Да", encoding: EncodingUCS2, want: []byte{0x04, 0x14, 0x04, 0x30}},
+		{name: "surrogate pair", text: "🔥", encoding: EncodingUCS2, want: []byte{0xD8, 0x3D, 0xDD, 0x25}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(tt.text, tt.encoding)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		wantEncoding string
+		wantLength   int
+		wantSegments int
+	}{
+		{name: "plain", text: "db is down", wantEncoding: EncodingGSM7, wantLength: 10, wantSegments: 1},
+		{name: "escape takes two septets", text: "[1]", wantEncoding: EncodingGSM7, wantLength: 5, wantSegments: 1},
+		{name: "full gsm segment", text: strings.Repeat("a", 160), wantEncoding: EncodingGSM7, wantLength: 160, wantSegments: 1},
+		{name: "two gsm segments", text: strings.Repeat("a", 161), wantEncoding: EncodingGSM7, wantLength: 161, wantSegments: 2},
+		{name: "cyrillic", text: strings.Repeat("я", 71), wantEncoding: EncodingUCS2, wantLength: 71, wantSegments: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := Analyze(tt.text)
+			if msg.Encoding != tt.wantEncoding || msg.Length != tt.wantLength || msg.Segments != tt.wantSegments {
+				t.Errorf("got %s/%d/%d, want %s/%d/%d", msg.Encoding, msg.Length, msg.Segments,
+					tt.wantEncoding, tt.wantLength, tt.wantSegments)
+			}
+		})
+	}
+}
+
+func TestSplitMatchesSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "single", text: "short"},
+		{name: "gsm", text: strings.Repeat("abc ", 100)},
+		{name: "escape on boundary", text: strings.Repeat("a", 152) + "{" + strings.Repeat("b", 10)},
+		{name: "ucs2", text: strings.Repeat("тревога ", 30)},
+		{name: "surrogate on boundary", text: strings.Repeat("я", 66) + "🔥" + strings.Repeat("я", 10)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := Analyze(tt.text)
+			parts := Split(tt.text, msg.Encoding)
+
+			if len(parts) != msg.Segments {
+				t.Fatalf("%d parts, Analyze counts %d", len(parts), msg.Segments)
+			}
+
+			if strings.Join(parts, "") != tt.text {
+				t.Error("parts don't make the text")
+			}
+
+			_, limit := sizes(msg.Encoding)
+			if len(parts) == 1 {
+				limit, _ = sizes(msg.Encoding)
+			}
+
+			for i, part := range parts {
+				if n := units(part, msg.Encoding); n > limit {
+					t.Errorf("part %d has %d units, limit %d", i, n, limit)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateKeepsIncidentAndLink(t *testing.T) {
+	text := "#42 " + strings.Repeat("disk is full on db-1 ", 20) + "https://grafana.local/a/42"
+
+	got := Truncate(text, 1)
+
+	if Analyze(got).Segments != 1 {
+		t.Errorf("%q is longer than one segment", got)
+	}
+
+	if !strings.HasPrefix(got, "#42 ") || !strings.HasSuffix(got, " https://grafana.local/a/42") {
+		t.Errorf("incident or link is lost: %q", got)
+	}
+}
@@ -0,0 +1,132 @@
+package speech
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxSpokenNumber is limit of numbers spelled out, longer ones are read digit by digit
+const maxSpokenNumber = 999_999_999
+
+type numberWords struct {
+	ones     []string
+	teens    []string
+	tens     []string
+	hundreds []string
+	thousand [3]string // forms for 1, 2-4, 5+ (English uses only the first one)
+	million  [3]string
+	point    string
+	dot      string   // separator of IP addresses and versions
+	feminine []string // 1 and 2 before "thousand" in Russian
+}
+
+var numbersEN = &numberWords{
+	ones:     []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine"},
+	teens:    []string{"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"},
+	tens:     []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"},
+	thousand: [3]string{"thousand", "thousand", "thousand"},
+	million:  [3]string{"million", "million", "million"},
+	point:    "point",
+	dot:      "dot",
+}
+
+var numbersRU = &numberWords{
+	ones:  []string{"ноль", "один", "два", "три", "четыре", "пять", "шесть", "семь", "восемь", "девять"},
+	teens: []string{"десять", "одиннадцать", "двенадцать", "тринадцать", "четырнадцать", "пятнадцать", "шестнадцать", "семнадцать", "восемнадцать", "девятнадцать"},
+	tens:  []string{"", "", "двадцать", "тридцать", "сорок", "пятьдесят", "шестьдесят", "семьдесят", "восемьдесят", "девяносто"},
+	hundreds: []string{"", "сто", "двести", "триста", "четыреста", "пятьсот", "шестьсот", "семьсот", "восемьсот",
+		"девятьсот"},
+	thousand: [3]string{"тысяча", "тысячи", "тысяч"},
+	million:  [3]string{"миллион", "миллиона", "миллионов"},
+	point:    "запятая",
+	dot:      "точка",
+	feminine: []string{"", "одна", "две"},
+}
+
+// spell returns number in words, digits are spelled one by one when number is too long
+func (w *numberWords) spell(digits string) string {
+	n, err := strconv.Atoi(digits)
+	if err != nil || n > maxSpokenNumber || (len(digits) > 1 && digits[0] == '0') {
+		return w.digits(digits)
+	}
+
+	if n == 0 {
+		return w.ones[0]
+	}
+
+	var words []string
+
+	if millions := n / 1_000_000; millions > 0 {
+		words = append(words, w.group(millions, false)...)
+		words = append(words, w.form(w.million, millions))
+	}
+
+	if thousands := n / 1000 % 1000; thousands > 0 {
+		words = append(words, w.group(thousands, true)...)
+		words = append(words, w.form(w.thousand, thousands))
+	}
+
+	if rest := n % 1000; rest > 0 {
+		words = append(words, w.group(rest, false)...)
+	}
+
+	return strings.Join(words, " ")
+}
+
+func (w *numberWords) digits(digits string) string {
+	words := make([]string, 0, len(digits))
+	for _, d := range digits {
+		words = append(words, w.ones[d-'0'])
+	}
+
+	return strings.Join(words, " ")
+}
+
+// group spells number below 1000
+func (w *numberWords) group(n int, feminine bool) []string {
+	var words []string
+
+	if h := n / 100; h > 0 {
+		if w.hundreds != nil {
+			words = append(words, w.hundreds[h])
+		} else {
+			words = append(words, w.ones[h], "hundred")
+		}
+	}
+
+	switch rest := n % 100; {
+	case rest >= 20:
+		words = append(words, w.tens[rest/10])
+		if rest%10 > 0 {
+			words = append(words, w.unit(rest%10, feminine))
+		}
+	case rest >= 10:
+		words = append(words, w.teens[rest-10])
+	case rest > 0:
+		words = append(words, w.unit(rest, feminine))
+	}
+
+	return words
+}
+
+func (w *numberWords) unit(n int, feminine bool) string {
+	if feminine && n < len(w.feminine) {
+		return w.feminine[n]
+	}
+
+	return w.ones[n]
+}
+
+// form picks plural form by last digits: 1, 2-4 or 5+
+func (w *numberWords) form(forms [3]string, n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 14:
+		return forms[2]
+	case n%10 == 1:
+		return forms[0]
+	case n%10 >= 2 && n%10 <= 4:
+		return forms[1]
+	default:
+		return forms[2]
+	}
+}
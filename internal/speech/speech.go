@@ -0,0 +1,189 @@
+package speech
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Languages of spoken text
+const (
+	LanguageEN = "en"
+	LanguageRU = "ru"
+)
+
+var (
+	regexpLink       = regexp.MustCompile(`https?://\S+`)
+	regexpIncident   = regexp.MustCompile(`#(\d+)`)
+	regexpCamelCase  = regexp.MustCompile(`(\p{Ll})(\p{Lu})`)
+	regexpIdentifier = regexp.MustCompile(`([\p{L}\d])[_.:/]+([\p{L}\d])`)
+	regexpLetterNum  = regexp.MustCompile(`(\p{L})(\d)|(\d)(\p{L})`)
+	regexpDotted     = regexp.MustCompile(`\d+(?:\.\d+){2,}`)
+	regexpDecimal    = regexp.MustCompile(`(\d+)[.,](\d+)`)
+	regexpNumber     = regexp.MustCompile(`\d+`)
+	regexpWord       = regexp.MustCompile(`[\p{L}\d]+`)
+	regexpPunct      = regexp.MustCompile(`\s+([,.:;!?])`)
+	regexpSentence   = regexp.MustCompile(`([.!?])\s+`)
+	regexpSpaces     = regexp.MustCompile(`\s+`)
+)
+
+type language struct {
+	tag           string
+	numbers       *numberWords
+	incident      string
+	percent       string
+	abbreviations map[string]string
+}
+
+var languages = map[string]*language{
+	LanguageEN: {
+		tag:      "en-US",
+		numbers:  numbersEN,
+		incident: "number",
+		percent:  "percent",
+		abbreviations: map[string]string{
+			"cpu":  "C P U",
+			"db":   "database",
+			"dc":   "data center",
+			"env":  "environment",
+			"err":  "error",
+			"hdd":  "disk",
+			"k8s":  "kubernetes",
+			"msg":  "message",
+			"oom":  "out of memory",
+			"prod": "production",
+			"ssd":  "disk",
+			"vm":   "virtual machine",
+		},
+	},
+	LanguageRU: {
+		tag:      "ru-RU",
+		numbers:  numbersRU,
+		incident: "номер",
+		percent:  "процентов",
+		abbreviations: map[string]string{
+			"бд":   "база данных",
+			"цод":  "дата центр",
+			"cpu":  "процессор",
+			"db":   "база данных",
+			"k8s":  "кубернетес",
+			"oom":  "нехватка памяти",
+			"prod": "продакшн",
+		},
+	},
+}
+
+// Options of speech preparation
+type Options struct {
+	// Language is used for numbers and abbreviations, en or ru
+	Language string
+	// MaxLength limits spoken text in characters, 0 is unlimited
+	MaxLength int
+}
+
+// Supported reports whether language is known
+func Supported(lang string) bool {
+	_, ok := languages[lang]
+	return ok
+}
+
+// Prepare turns alert text into something TTS engine can read: links are removed, incident numbers,
+// numbers and abbreviations are spelled, metric names are split into words
+func Prepare(text string, opts Options) string {
+	lang, ok := languages[opts.Language]
+	if !ok {
+		lang = languages[LanguageEN]
+	}
+
+	text = regexpLink.ReplaceAllString(text, " ")
+	text = lang.expand(text)
+	text = regexpIncident.ReplaceAllString(text, lang.incident+" $1")
+
+	// "db01" is read as "db zero one", abbreviations are expanded once more after split
+	text = regexpLetterNum.ReplaceAllString(text, "$1$3 $2$4")
+	text = lang.expand(text)
+
+	// IP addresses and versions like 10.0.0.1 or 1.2.3 are not decimals, every group is read as number
+	text = regexpDotted.ReplaceAllStringFunc(text, func(s string) string {
+		groups := strings.Split(s, ".")
+		for i, group := range groups {
+			groups[i] = lang.numbers.spell(group)
+		}
+
+		return strings.Join(groups, " "+lang.numbers.dot+" ")
+	})
+
+	text = regexpDecimal.ReplaceAllStringFunc(text, func(s string) string {
+		parts := regexpDecimal.FindStringSubmatch(s)
+		return lang.numbers.spell(parts[1]) + " " + lang.numbers.point + " " + lang.numbers.digits(parts[2])
+	})
+
+	// Repeat, since one match consumes letter which can start the next one, e.g. "a_b_c"
+	for regexpIdentifier.MatchString(text) {
+		text = regexpIdentifier.ReplaceAllString(text, "$1 $2")
+	}
+
+	text = regexpCamelCase.ReplaceAllString(text, "$1 $2")
+	text = regexpNumber.ReplaceAllStringFunc(text, lang.numbers.spell)
+	text = strings.ReplaceAll(text, "%", " "+lang.percent)
+
+	text = strings.Join(strings.Fields(strings.Map(speakable, text)), " ")
+	text = regexpPunct.ReplaceAllString(text, "$1")
+
+	return truncate(text, opts.MaxLength)
+}
+
+// expand replaces known abbreviations, they are matched as whole words regardless of case
+func (l *language) expand(text string) string {
+	return regexpWord.ReplaceAllStringFunc(text, func(word string) string {
+		if full, ok := l.abbreviations[strings.ToLower(word)]; ok {
+			return full
+		}
+
+		return word
+	})
+}
+
+// SSML wraps prepared text into speak element, sentences are separated with pauses
+func SSML(text string, opts Options) string {
+	lang, ok := languages[opts.Language]
+	if !ok {
+		lang = languages[LanguageEN]
+	}
+
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(text))
+
+	body := regexpSentence.ReplaceAllString(escaped.String(), `$1<break time="500ms"/>`)
+
+	return fmt.Sprintf(`<speak xml:lang="%s">%s</speak>`, lang.tag, body)
+}
+
+// speakable keeps letters, digits, spaces and punctuation which makes pauses
+func speakable(r rune) rune {
+	switch {
+	case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsSpace(r):
+		return r
+	case strings.ContainsRune(",.:;!?-'", r):
+		return r
+	default:
+		return ' '
+	}
+}
+
+// truncate cuts text by word boundary
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if limit <= 0 || len(runes) <= limit {
+		return text
+	}
+
+	text = string(runes[:limit])
+	if i := strings.LastIndexByte(text, ' '); i > 0 {
+		text = text[:i]
+	}
+
+	return strings.TrimRight(regexpSpaces.ReplaceAllString(text, " "), " ,:;-")
+}
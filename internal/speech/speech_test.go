@@ -0,0 +1,108 @@
+package speech
+
+import "testing"
+
+func TestPrepare(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		opts Options
+		want string
+	}{
+		{
+			name: "link is removed",
+			text: "See https://grafana.local/a/1 now",
+			want: "See now",
+		},
+		{
+			name: "incident number",
+			text: "#1234 fired",
+			want: "number one thousand two hundred thirty four fired",
+		},
+		{
+			name: "metric names are split into words",
+			text: "HighMemoryUsage on node_exporter",
+			want: "High Memory Usage on node exporter",
+		},
+		{
+			name: "abbreviations and host names",
+			text: "CPU of k8s on db01",
+			want: "C P U of kubernetes on database zero one",
+		},
+		{
+			name: "decimal and percent",
+			text: "usage is 95.5%",
+			want: "usage is ninety five point five percent",
+		},
+		{
+			name: "ip address is not decimal",
+			text: "Host 10.0.0.1 is down",
+			want: "Host ten dot zero dot zero dot one is down",
+		},
+		{
+			name: "version is not decimal",
+			text: "Upgrade to 1.22.3 failed",
+			want: "Upgrade to one dot twenty two dot three failed",
+		},
+		{
+			name: "russian",
+			text: "Сервер 192.168.1.10 недоступен, БД 2,5 с",
+			opts: Options{Language: LanguageRU},
+			want: "Сервер сто девяносто два точка сто шестьдесят восемь точка один точка десять недоступен, база данных два запятая пять с",
+		},
+		{
+			name: "russian feminine thousand",
+			text: "21000 ошибок",
+			opts: Options{Language: LanguageRU},
+			want: "двадцать одна тысяча ошибок",
+		},
+		{
+			name: "long number is read by digits",
+			text: "id 12345678901",
+			want: "id one two three four five six seven eight nine zero one",
+		},
+		{
+			name: "symbols are dropped",
+			text: "disk [full] -> /var",
+			want: "disk full - var",
+		},
+		{
+			name: "truncated by word",
+			text: "one two three four five six",
+			opts: Options{MaxLength: 14},
+			want: "one two three",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Prepare(tt.text, tt.opts); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSML(t *testing.T) {
+	tests := []struct {
+		text string
+		opts Options
+		want string
+	}{
+		{
+			text: "Disk is full. Call me!",
+			want: `<speak xml:lang="en-US">Disk is full.<break time="500ms"/>Call me!</speak>`,
+		},
+		{
+			text: "A & B",
+			opts: Options{Language: LanguageRU},
+			want: `<speak xml:lang="ru-RU">A &amp; B</speak>`,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := SSML(tt.text, tt.opts); got != tt.want {
+			t.Errorf("got  %q\nwant %q", got, tt.want)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 var (
 	errInvalidAuthToken = errors.New("invalid auth token")
+	errAdminDisabled    = errors.New("admin API is disabled, app.admin_token is not set")
 )
 
 type Service interface {
@@ -19,13 +20,24 @@ type Service interface {
 
 type envTokenService struct {
 	authToken string
+	// required rejects all requests when token is not set
+	required bool
 }
 
 func NewFromConfig(app *config.App) Service {
 	return &envTokenService{authToken: app.AuthToken}
 }
 
+// NewAdminFromConfig checks token of admin scope, unlike OnCall token it can't be left blank to accept any key
+func NewAdminFromConfig(app *config.App) Service {
+	return &envTokenService{authToken: app.AdminToken, required: true}
+}
+
 func (s *envTokenService) Verify(r *http.Request) error {
+	if s.authToken == "" && s.required {
+		return errAdminDisabled
+	}
+
 	if s.authToken == "" {
 		return nil
 	}
@@ -0,0 +1,37 @@
+package translit
+
+import (
+	"strings"
+	"unicode"
+)
+
+// table is Cyrillic to Latin, close to Russian passport transliteration
+var table = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "ie", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu",
+	'я': "ia", 'і': "i", 'ї': "i", 'є': "ie", 'ґ': "g",
+}
+
+// String replaces Cyrillic letters with Latin ones, other characters are kept as is
+func String(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for _, r := range s {
+		latin, ok := table[unicode.ToLower(r)]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+
+		if unicode.IsUpper(r) && latin != "" {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+
+		b.WriteString(latin)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,463 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+const (
+	searchPageSize = 100
+
+	// Unique indexes of oncall_users, see 01-init.sql
+	indexUserID = "index_user_id"
+	indexEmail  = "index_email_unique"
+)
+
+var (
+	colsRecord = []string{"user_id", "name", "username", "email", "phone_number", "role", "active", "phone_verified_at",
+		"phone_verified"}
+
+	// regexpEmail is intentionally loose, only obvious typos are rejected
+	regexpEmail    = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	regexpE164     = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+	regexpUserID   = regexp.MustCompile(`^[A-Z0-9]{1,15}$`)
+	regexpUsername = regexp.MustCompile(`^[a-zA-Z0-9._@-]{1,32}$`)
+
+	errUserNotFound  = errors.New("user-not-found")
+	errUserIDTaken   = errors.New("user-id-already-exists")
+	errEmailTaken    = errors.New("email-already-exists")
+	errInvalidUserID = errors.New("invalid-user-id")
+	errInvalidName   = errors.New("invalid-username")
+	errInvalidEmail  = errors.New("invalid-email")
+	errInvalidPhone  = errors.New("invalid-phone-number-e164")
+	errInvalidRole   = errors.New("invalid-role")
+	errAmbiguousUser = errors.New("phone-number-of-several-users")
+)
+
+// Record is user as it's managed by admin API, it includes deactivated users
+type Record struct {
+	UserID        string `json:"user_id"`
+	Name          string `json:"name"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	PhoneNumber   string `json:"phone_number"`
+	PhoneVerified bool   `json:"is_phone_number_verified"`
+	Role          string `json:"role"`
+	Active        bool   `json:"active"`
+}
+
+// Change is partial update of user, nil fields are not changed
+type Change struct {
+	Name        *string `json:"name"`
+	Username    *string `json:"username"`
+	Email       *string `json:"email"`
+	PhoneNumber *string `json:"phone_number"`
+	Role        *string `json:"role"`
+	Active      *bool   `json:"active"`
+}
+
+// Search filters users by substring of user_id, name, username, email or phone number
+type Search struct {
+	Query  string
+	Role   string
+	Active *bool
+	Page   int
+}
+
+// IsNotFound reports whether error means that user does not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, errUserNotFound)
+}
+
+// IsAmbiguous reports whether phone number lookup matched several users
+func IsAmbiguous(err error) bool {
+	return errors.Is(err, errAmbiguousUser)
+}
+
+// IsInvalid reports whether user was rejected by validation
+func IsInvalid(err error) bool {
+	for _, e := range []error{errUserIDTaken, errEmailTaken, errInvalidUserID, errInvalidName, errInvalidEmail,
+		errInvalidPhone, errInvalidRole} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks fields of user, blank phone number is allowed
+func (r *Record) Validate() error {
+	switch {
+	case !regexpUserID.MatchString(r.UserID):
+		return errInvalidUserID
+	case !regexpUsername.MatchString(r.Username):
+		return errInvalidName
+	case !regexpEmail.MatchString(r.Email):
+		return errInvalidEmail
+	case r.PhoneNumber != "" && !regexpE164.MatchString(r.PhoneNumber):
+		return errInvalidPhone
+	case !validRole(r.Role):
+		return errInvalidRole
+	}
+
+	return nil
+}
+
+// Validate checks fields which are changed, other fields are kept as is even if they don't pass Record.Validate,
+// e.g. username of user imported from Grafana
+func (c *Change) Validate() error {
+	r := &Record{}
+	c.apply(r)
+
+	switch {
+	case c.Username != nil && !regexpUsername.MatchString(r.Username):
+		return errInvalidName
+	case c.Email != nil && !regexpEmail.MatchString(r.Email):
+		return errInvalidEmail
+	case c.PhoneNumber != nil && r.PhoneNumber != "" && !regexpE164.MatchString(r.PhoneNumber):
+		return errInvalidPhone
+	case c.Role != nil && !validRole(r.Role):
+		return errInvalidRole
+	}
+
+	return nil
+}
+
+func validRole(role string) bool {
+	switch role {
+	case roleAdmin, roleUser, roleObserver:
+		return true
+	}
+
+	return false
+}
+
+func (c *Change) apply(r *Record) {
+	for _, field := range []struct {
+		value *string
+		dest  *string
+	}{
+		{c.Name, &r.Name},
+		{c.Username, &r.Username},
+		{c.Email, &r.Email},
+		{c.PhoneNumber, &r.PhoneNumber},
+		{c.Role, &r.Role},
+	} {
+		if field.value != nil {
+			*field.dest = strings.TrimSpace(*field.value)
+		}
+	}
+
+	if c.Active != nil {
+		r.Active = *c.Active
+	}
+}
+
+// SearchUsers lists users including deactivated ones, page has 100 users
+func (s *Storage) SearchUsers(ctx context.Context, f Search) ([]Record, error) {
+	where := sq.And{}
+
+	if f.Query != "" {
+		like := "%" + strings.ToLower(f.Query) + "%"
+		where = append(where, sq.Or{
+			sq.Like{"lower(user_id)": like},
+			sq.Like{"lower(name)": like},
+			sq.Like{"lower(username)": like},
+			sq.Like{"lower(email)": like},
+			sq.Like{"phone_number": like},
+		})
+	}
+
+	if f.Role != "" {
+		where = append(where, sq.Eq{"role": f.Role})
+	}
+
+	if f.Active != nil {
+		where = append(where, sq.Eq{"active": *f.Active})
+	}
+
+	builder := sq.Select(colsRecord...).
+		From(tableOnCallUsers).
+		Where(where).
+		OrderBy("id ASC").
+		Limit(searchPageSize).
+		PlaceholderFormat(sq.Dollar)
+
+	if f.Page > 1 {
+		builder = builder.Offset(uint64((f.Page - 1) * searchPageSize))
+	}
+
+	return s.records(ctx, builder)
+}
+
+// Record returns user by user_id, deactivated users are returned as well
+func (s *Storage) Record(ctx context.Context, userID string) (*Record, error) {
+	result, err := s.records(ctx, sq.Select(colsRecord...).
+		From(tableOnCallUsers).
+		Where(sq.Eq{"user_id": userID}).
+		Limit(1).
+		PlaceholderFormat(sq.Dollar))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return nil, errUserNotFound
+	}
+
+	return &result[0], nil
+}
+
+// Create stores new user, user_id is generated when it's blank
+func (s *Storage) Create(ctx context.Context, r *Record) error {
+	if r.UserID == "" {
+		r.UserID = randomUserID()
+	}
+
+	if r.Role == "" {
+		r.Role = roleUser
+	}
+
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	if err := s.unique(ctx, r, ""); err != nil {
+		return err
+	}
+
+	query, args, err := sq.Insert(tableOnCallUsers).
+		Columns("user_id", "name", "username", "email", "phone_number", "role", "active").
+		Values(r.UserID, r.Name, r.Username, r.Email, nullString(r.PhoneNumber), r.Role, r.Active).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
+		s.logger.Error().Err(err).Str("user_id", r.UserID).Msgf("unable to insert into %s", tableOnCallUsers)
+		return taken(err)
+	}
+
+	r.PhoneVerified = false
+
+	return nil
+}
+
+// Update changes user, changed phone number has to be verified again
+func (s *Storage) Update(ctx context.Context, userID string, c *Change) (*Record, error) {
+	r, err := s.Record(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.Validate(); err != nil {
+		return nil, err
+	}
+
+	phone := r.PhoneNumber
+	c.apply(r)
+
+	if c.Email != nil {
+		if err = s.unique(ctx, r, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	builder := builderUpdateUser.Where(sq.Eq{"user_id": userID})
+	changed := false
+
+	for _, field := range []struct {
+		column  string
+		changed bool
+		value   interface{}
+	}{
+		{"name", c.Name != nil, r.Name},
+		{"username", c.Username != nil, r.Username},
+		{"email", c.Email != nil, r.Email},
+		{"phone_number", c.PhoneNumber != nil, nullString(r.PhoneNumber)},
+		{"role", c.Role != nil, r.Role},
+		{"active", c.Active != nil, r.Active},
+	} {
+		if field.changed {
+			builder = builder.Set(field.column, field.value)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return r, nil
+	}
+
+	if r.PhoneNumber != phone {
+		builder = builder.Set("phone_verified_at", nil).Set("phone_verified", nil)
+		r.PhoneVerified = false
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to update %s", tableOnCallUsers)
+		return nil, taken(err)
+	}
+
+	return r, nil
+}
+
+// Delete removes user with contact methods, quiet hours and phone verifications in one transaction.
+// Pending redials are cancelled and queued notifications are failed, so that deleted user is not paged anymore
+func (s *Storage) Delete(ctx context.Context, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = tx.Rollback() }()
+
+	var email string
+
+	err = tx.QueryRowContext(ctx, `DELETE FROM oncall_users WHERE user_id = $1 RETURNING coalesce(email, '')`, userID).
+		Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUserNotFound
+	}
+
+	if err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to delete from %s", tableOnCallUsers)
+		return err
+	}
+
+	for _, leftover := range []struct {
+		table string
+		query string
+		args  []any
+	}{
+		{tableContacts, `DELETE FROM user_contacts WHERE user_id = $1`, []any{userID}},
+		{"quiet_policies", `DELETE FROM quiet_policies WHERE user_id = $1`, []any{userID}},
+		{"quiet_windows", `DELETE FROM quiet_windows WHERE user_id = $1`, []any{userID}},
+		{"phone_verifications", `DELETE FROM phone_verifications WHERE user_id = $1`, []any{userID}},
+		{"notifications", `UPDATE notifications SET status = 'failed', error = $2, updated_at = $3
+			WHERE user_id = $1 AND status = 'queued'`, []any{userID, errUserNotFound.Error(), time.Now()}},
+		{"redials", `UPDATE redials SET status = 'cancelled' WHERE lower(email) = lower($1) AND status = 'pending'`,
+			[]any{email}},
+	} {
+		if _, err = tx.ExecContext(ctx, leftover.query, leftover.args...); err != nil {
+			s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to delete user from %s", leftover.table)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// unique checks that user_id and email are not used by other user. It gives clear error before insert, concurrent
+// requests are stopped by unique indexes, see taken
+func (s *Storage) unique(ctx context.Context, r *Record, exceptUserID string) error {
+	var userID, email string
+
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, coalesce(email, '') FROM oncall_users
+		WHERE (user_id = $1 OR lower(email) = lower($2)) AND user_id <> $3`, r.UserID, r.Email, exceptUserID)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	if !rows.Next() {
+		return rows.Err()
+	}
+
+	if err = rows.Scan(&userID, &email); err != nil {
+		return err
+	}
+
+	if userID == r.UserID {
+		return errUserIDTaken
+	}
+
+	return errEmailTaken
+}
+
+// taken maps violation of unique index to the same errors as unique returns
+func taken(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code.Name() != "unique_violation" {
+		return err
+	}
+
+	switch pqErr.Constraint {
+	case indexUserID:
+		return errUserIDTaken
+	case indexEmail:
+		return errEmailTaken
+	}
+
+	return err
+}
+
+func (s *Storage) records(ctx context.Context, builder sq.SelectBuilder) ([]Record, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("failed execute sql select query from %s", tableOnCallUsers)
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	result := make([]Record, 0)
+
+	for rows.Next() {
+		var (
+			r               Record
+			name            sql.NullString
+			email           sql.NullString
+			phone           sql.NullString
+			active          sql.NullBool
+			phoneVerifiedAt sql.NullTime
+			phoneVerified   sql.NullString
+		)
+
+		err = rows.Scan(&r.UserID, &name, &r.Username, &email, &phone, &r.Role, &active, &phoneVerifiedAt, &phoneVerified)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Name, r.Email, r.PhoneNumber, r.Active = name.String, email.String, phone.String, active.Bool
+		r.PhoneVerified = phoneConfirmed(r.PhoneNumber, phoneVerifiedAt, phoneVerified)
+
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+// randomUserID has the same format as IDs of users imported from Grafana
+func randomUserID() string {
+	b := make([]byte, 7)
+	_, _ = rand.Read(b)
+
+	return "U" + strings.ToUpper(hex.EncodeToString(b))
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,72 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestChangeValidate(t *testing.T) {
+	str := func(s string) *string { return &s }
+	active := false
+
+	tests := []struct {
+		name   string
+		change Change
+		want   error
+	}{
+		{name: "only active", change: Change{Active: &active}},
+		{name: "name is free text", change: Change{Name: str("Иван Петров")}},
+		{name: "blank phone", change: Change{PhoneNumber: str("")}},
+		{name: "phone", change: Change{PhoneNumber: str("+79990001122")}},
+		{name: "invalid phone", change: Change{PhoneNumber: str("89990001122")}, want: errInvalidPhone},
+		{name: "invalid email", change: Change{Email: str("ivan")}, want: errInvalidEmail},
+		{name: "blank username", change: Change{Username: str(" ")}, want: errInvalidName},
+		{name: "invalid role", change: Change{Role: str("root")}, want: errInvalidRole},
+		{name: "role", change: Change{Role: str(roleObserver)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTakenMapsUniqueViolation(t *testing.T) {
+	errOther := errors.New("connection refused")
+	foreignKey := &pq.Error{Code: "23503", Constraint: indexUserID}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "user_id", err: &pq.Error{Code: "23505", Constraint: indexUserID}, want: errUserIDTaken},
+		{name: "email", err: fmt.Errorf("insert: %w", &pq.Error{Code: "23505", Constraint: indexEmail}), want: errEmailTaken},
+		{name: "other index", err: &pq.Error{Code: "23505", Constraint: "id_primary_key"}},
+		{name: "other violation", err: foreignKey, want: foreignKey},
+		{name: "other error", err: errOther, want: errOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := taken(tt.err)
+			if tt.want == nil {
+				if IsInvalid(got) {
+					t.Errorf("error %v is reported as validation error", got)
+				}
+
+				return
+			}
+
+			if !errors.Is(got, tt.want) {
+				t.Errorf("error %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
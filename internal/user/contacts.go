@@ -0,0 +1,331 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Types of contact methods
+const (
+	ContactPhone    = "phone"
+	ContactTelegram = "telegram"
+	ContactEmail    = "email"
+	ContactSlack    = "slack"
+	ContactMatrix   = "matrix"
+
+	tableContacts = "user_contacts"
+)
+
+var (
+	colsContact = []string{"id", "user_id", "type", "value", "priority", "verified", "notify_types"}
+
+	regexpPhone = regexp.MustCompile(`^\+?[0-9]{5,19}$`)
+
+	errContactNotFound = errors.New("contact-not-found")
+	errContactType     = errors.New("unknown-contact-type")
+	errContactValue    = errors.New("invalid-contact-value")
+)
+
+// Contact is contact method of user. Lower Priority is preferred, only verified contacts are used for notifications.
+// Verified is set only by verification service, it's reset when value is changed.
+// NotifyTypes limits contact to notification types (phone, sms, slack), empty means all types
+type Contact struct {
+	ID          int64    `json:"id"`
+	Type        string   `json:"type"`
+	Value       string   `json:"value"`
+	Priority    int      `json:"priority"`
+	Verified    bool     `json:"verified"`
+	NotifyTypes []string `json:"notify_types,omitempty"`
+}
+
+// IsContactNotFound reports whether error means that contact does not exist
+func IsContactNotFound(err error) bool {
+	return errors.Is(err, errContactNotFound)
+}
+
+// Validate checks type and value of contact
+func (c *Contact) Validate() error {
+	switch c.Type {
+	case ContactPhone:
+		if !regexpPhone.MatchString(c.Value) {
+			return errContactValue
+		}
+	case ContactEmail:
+		if !strings.Contains(c.Value, "@") {
+			return errContactValue
+		}
+	case ContactTelegram, ContactSlack, ContactMatrix:
+		if strings.TrimSpace(c.Value) == "" {
+			return errContactValue
+		}
+	default:
+		return errContactType
+	}
+
+	return nil
+}
+
+func (c *Contact) allows(notificationType string) bool {
+	if len(c.NotifyTypes) == 0 || notificationType == "" {
+		return true
+	}
+
+	for _, t := range c.NotifyTypes {
+		if strings.EqualFold(t, notificationType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Best returns verified contact of given type with the lowest priority which is allowed for notification type
+func (i *Item) Best(contactType, notificationType string) *Contact {
+	var best *Contact
+
+	for n := range i.Contacts {
+		c := &i.Contacts[n]
+		if c.Type != contactType || !c.Verified || !c.allows(notificationType) {
+			continue
+		}
+
+		if best == nil || c.Priority < best.Priority {
+			best = c
+		}
+	}
+
+	return best
+}
+
+// Prefer replaces phone number, telegram chat, slack member, matrix ID and email for notifications with the best
+// verified contacts for notification type. Fields from oncall_users are kept when there is no such contact,
+// so it's called once after user was loaded
+func (i *Item) Prefer(notificationType string) {
+	for _, contactType := range []string{ContactPhone, ContactTelegram, ContactSlack, ContactMatrix, ContactEmail} {
+		if c := i.Best(contactType, notificationType); c != nil {
+			i.Use(c)
+		}
+	}
+}
+
+// Use replaces field of user for contact type with value of contact
+func (i *Item) Use(c *Contact) {
+	switch c.Type {
+	case ContactPhone:
+		i.PhoneNumber = c.Value
+		i.IsPhoneNumberVerified = c.Verified
+	case ContactTelegram:
+		i.TelegramChatID = c.Value
+	case ContactSlack:
+		teamID := i.ID
+		if i.Slack != nil {
+			teamID = i.Slack.TeamID
+		}
+
+		i.Slack = &Slack{UserID: c.Value, TeamID: teamID}
+	case ContactMatrix:
+		i.MatrixID = c.Value
+	case ContactEmail:
+		i.NotifyEmail = c.Value
+	}
+}
+
+// Contacts returns contact methods of user, preferred first
+func (s *Storage) Contacts(ctx context.Context, userID string) ([]Contact, error) {
+	result, err := s.contactsOf(ctx, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+
+	if result[userID] == nil {
+		return []Contact{}, nil
+	}
+
+	return result[userID], nil
+}
+
+// Contact returns contact method of user
+func (s *Storage) Contact(ctx context.Context, userID string, id int64) (*Contact, error) {
+	contacts, err := s.Contacts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for n := range contacts {
+		if contacts[n].ID == id {
+			return &contacts[n], nil
+		}
+	}
+
+	return nil, errContactNotFound
+}
+
+// AddContact stores contact method of user, it's not verified
+func (s *Storage) AddContact(ctx context.Context, userID string, c *Contact) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	c.Verified = false
+
+	query, args, err := sq.Insert(tableContacts).
+		Columns("date_add", "user_id", "type", "value", "priority", "verified", "notify_types").
+		Values(time.Now(), userID, c.Type, c.Value, c.Priority, c.Verified, strings.Join(c.NotifyTypes, ",")).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.QueryRowContext(ctx, query, args...).Scan(&c.ID); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to insert into %s", tableContacts)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateContact changes value, priority and notification types of contact. Verified flag is kept
+// only when type and value are not changed, it's returned in c
+func (s *Storage) UpdateContact(ctx context.Context, userID string, c *Contact) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	query, args, err := sq.Update(tableContacts).
+		Set("verified", sq.Expr("verified AND type = ? AND value = ?", c.Type, c.Value)).
+		Set("type", c.Type).
+		Set("value", c.Value).
+		Set("priority", c.Priority).
+		Set("notify_types", strings.Join(c.NotifyTypes, ",")).
+		Where(sq.Eq{"id": c.ID, "user_id": userID}).
+		Suffix("RETURNING verified").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(&c.Verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errContactNotFound
+	}
+
+	if err != nil {
+		s.logger.Error().Err(err).Int64("id", c.ID).Msgf("unable to change %s", tableContacts)
+	}
+
+	return err
+}
+
+// VerifyContact marks contact as verified, when its value is still the same
+func (s *Storage) VerifyContact(ctx context.Context, userID string, id int64, value string) error {
+	query, args, err := sq.Update(tableContacts).
+		Set("verified", true).
+		Where(sq.Eq{"id": id, "user_id": userID, "value": value}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return s.execContact(ctx, query, args, id)
+}
+
+// DeleteContact removes contact method of user
+func (s *Storage) DeleteContact(ctx context.Context, userID string, id int64) error {
+	query, args, err := sq.Delete(tableContacts).
+		Where(sq.Eq{"id": id, "user_id": userID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return s.execContact(ctx, query, args, id)
+}
+
+func (s *Storage) execContact(ctx context.Context, query string, args []interface{}, id int64) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Int64("id", id).Msgf("unable to change %s", tableContacts)
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errContactNotFound
+	}
+
+	return nil
+}
+
+// contactsOf loads contacts of several users with one query
+func (s *Storage) contactsOf(ctx context.Context, userIDs []string) (map[string][]Contact, error) {
+	query, args, err := sq.Select(colsContact...).
+		From(tableContacts).
+		Where(sq.Eq{"user_id": userIDs}).
+		OrderBy("priority ASC", "id ASC").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("failed execute sql select query from %s", tableContacts)
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	result := make(map[string][]Contact)
+
+	for rows.Next() {
+		var (
+			c           Contact
+			userID      string
+			notifyTypes sql.NullString
+		)
+
+		if err = rows.Scan(&c.ID, &userID, &c.Type, &c.Value, &c.Priority, &c.Verified, &notifyTypes); err != nil {
+			return nil, err
+		}
+
+		if notifyTypes.String != "" {
+			c.NotifyTypes = strings.Split(notifyTypes.String, ",")
+		}
+
+		result[userID] = append(result[userID], c)
+	}
+
+	return result, rows.Err()
+}
+
+// withContacts loads contacts into users, user is still usable with oncall_users fields when it fails
+func (s *Storage) withContacts(ctx context.Context, items []Item) {
+	if len(items) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(items))
+	for n := range items {
+		ids = append(ids, items[n].ID)
+	}
+
+	contacts, err := s.contactsOf(ctx, ids)
+	if err != nil {
+		return
+	}
+
+	for n := range items {
+		items[n].Contacts = contacts[items[n].ID]
+	}
+}
@@ -0,0 +1,48 @@
+package user
+
+import "testing"
+
+func TestPrefer(t *testing.T) {
+	item := Item{
+		ID:          "U1",
+		PhoneNumber: "+79990000000",
+		Contacts: []Contact{
+			{ID: 1, Type: ContactPhone, Value: "+79990000001", Priority: 2, Verified: true},
+			{ID: 2, Type: ContactPhone, Value: "+79990000002", Priority: 1, Verified: true, NotifyTypes: []string{"sms"}},
+			{ID: 3, Type: ContactPhone, Value: "+79990000003", Priority: 0},
+			{ID: 4, Type: ContactTelegram, Value: "100", Verified: true},
+			{ID: 5, Type: ContactSlack, Value: "M1", Verified: true},
+		},
+	}
+
+	phone := item
+	phone.Prefer("phone")
+
+	if phone.PhoneNumber != "+79990000001" || !phone.IsPhoneNumberVerified {
+		t.Errorf("phone: number %q, verified %v", phone.PhoneNumber, phone.IsPhoneNumberVerified)
+	}
+
+	if phone.TelegramChatID != "100" || phone.Slack == nil || phone.Slack.UserID != "M1" || phone.Slack.TeamID != "U1" {
+		t.Errorf("phone: telegram %q, slack %+v", phone.TelegramChatID, phone.Slack)
+	}
+
+	sms := item
+	sms.Prefer("sms")
+
+	if sms.PhoneNumber != "+79990000002" {
+		t.Errorf("sms: number %q", sms.PhoneNumber)
+	}
+
+	if item.PhoneNumber != "+79990000000" || item.Slack != nil {
+		t.Errorf("original user is changed: %+v", item)
+	}
+}
+
+func TestUseUnverifiedPhone(t *testing.T) {
+	item := Item{PhoneNumber: "+79990000000", IsPhoneNumberVerified: true}
+	item.Use(&Contact{Type: ContactPhone, Value: "+79990000003"})
+
+	if item.PhoneNumber != "+79990000003" || item.IsPhoneNumberVerified {
+		t.Errorf("number %q, verified %v", item.PhoneNumber, item.IsPhoneNumberVerified)
+	}
+}
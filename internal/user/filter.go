@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"net/http"
+	"strings"
 
 	"github.com/ebogdanov/emu-oncall/internal/db"
 	"github.com/rs/zerolog"
@@ -17,8 +18,10 @@ const (
 )
 
 var (
-	colsWithPhone  = []string{"id", "user_id", "email", "username", "role", "phone_number"}
-	colsWithActive = []string{"id", "user_id", "email", "username", "role", "active"}
+	colsWithPhone = []string{"id", "user_id", "email", "username", "role", "phone_number", "telegram_chat_id", "sms_translit",
+		"phone_verified_at", "phone_verified"}
+	colsWithActive = []string{"id", "user_id", "email", "username", "role", "active", "name", "synced_at", "grafana_role",
+		"grafana_active"}
 
 	builderUsersSelect = sq.Select(colsWithPhone...).
 				From(tableOnCallUsers).
@@ -76,12 +79,39 @@ func (s *Storage) DBQuery(ctx context.Context, opts Options) (*List, error) {
 
 	cntResult, _ := s.db.QueryContext(ctx, queryCnt, args...)
 
-	return s.process(cntResult, sqlResult, opts)
+	result, err := s.process(cntResult, sqlResult, opts)
+	if err != nil {
+		return result, err
+	}
+
+	// Listing shows contacts which are preferred for phone calls
+	s.withContacts(ctx, result.Result)
+
+	for n := range result.Result {
+		item := &result.Result[n]
+		item.Prefer(ContactPhone)
+
+		if opts.Short {
+			item.PhoneNumber, item.Slack = "", nil
+		}
+	}
+
+	return result, nil
 }
 
 func (s *Storage) WithEmail(ctx context.Context, email string) (*Item, error) {
-	opts := &Options{Email: email, Limit: 1, Short: false}
+	return s.one(ctx, &Options{Email: email, Limit: 1, Short: false})
+}
+
+// WithPhone looks up user by verified phone number or verified phone contact, sender numbers often come without "+",
+// so both forms are checked. Empty Item is returned when user is not found, number of several users is ambiguous
+func (s *Storage) WithPhone(ctx context.Context, phone string) (*Item, error) {
+	digits := strings.TrimPrefix(strings.TrimSpace(phone), "+")
+
+	return s.one(ctx, &Options{Phones: []string{digits, "+" + digits}, Limit: 2, Short: false})
+}
 
+func (s *Storage) one(ctx context.Context, opts *Options) (*Item, error) {
 	query, _, args, err := s.dbQuery(*opts)
 	if err != nil {
 		return nil, err
@@ -97,14 +127,10 @@ func (s *Storage) WithEmail(ctx context.Context, email string) (*Item, error) {
 	}
 
 	defer func() { _ = sqlResult.Close() }()
-	var (
-		id uint64
-	)
 
 	item := &Item{}
 	if sqlResult.Next() {
-		err = sqlResult.Scan(&id, &item.ID, &item.Email, &item.Username, &item.Role, &item.PhoneNumber)
-
+		item, err = scanItem(sqlResult)
 		if err != nil {
 			s.logger.Error().
 				Err(err).
@@ -113,12 +139,12 @@ func (s *Storage) WithEmail(ctx context.Context, email string) (*Item, error) {
 			return nil, err
 		}
 
-		item.IsPhoneNumberVerified = item.PhoneNumber != ""
-
-		item.Slack = &Slack{
-			UserID: item.ID,
-			TeamID: item.ID,
+		if sqlResult.Next() {
+			return nil, errAmbiguousUser
 		}
+
+		// Contacts are optional, user is notified by oncall_users fields when they can't be loaded
+		item.Contacts, _ = s.Contacts(ctx, item.ID)
 	}
 
 	return item, nil
@@ -137,6 +163,12 @@ func (s *Storage) dbQuery(opts Options) (query, cntQuery string, args []interfac
 		cntBuilder = cntBuilder.Limit(uint64(opts.Limit))
 	}
 
+	// Deactivated users are not reported to OnCall and don't get notifications
+	if !opts.All {
+		selectQueryBuilder = selectQueryBuilder.Where(sq.Eq{"active": true})
+		cntBuilder = cntBuilder.Where(sq.Eq{"active": true})
+	}
+
 	if opts.UserID != "" {
 		whereUserID := sq.Eq{"user_id": opts.UserID}
 
@@ -151,6 +183,22 @@ func (s *Storage) dbQuery(opts Options) (query, cntQuery string, args []interfac
 		cntBuilder = cntBuilder.Where(whereEmail)
 	}
 
+	if len(opts.Phones) > 0 {
+		contactQuery, contactArgs, _ := sq.Select("user_id").
+			From(tableContacts).
+			Where(sq.Eq{"type": ContactPhone, "value": opts.Phones, "verified": true}).
+			ToSql()
+
+		// Only verified numbers are matched, see phoneConfirmed
+		wherePhone := sq.Or{
+			sq.And{sq.Eq{"phone_number": opts.Phones}, sq.NotEq{"phone_verified_at": nil}, sq.Expr("phone_verified = phone_number")},
+			sq.Expr("user_id IN ("+contactQuery+")", contactArgs...),
+		}
+
+		selectQueryBuilder = selectQueryBuilder.Where(wherePhone)
+		cntBuilder = cntBuilder.Where(wherePhone)
+	}
+
 	if len(opts.Roles) > 0 {
 		whereRoleID := sq.Or{}
 		for _, item := range opts.Roles {
@@ -177,10 +225,8 @@ func (s *Storage) dbQuery(opts Options) (query, cntQuery string, args []interfac
 
 func (s *Storage) process(cntResult, sqlResult *sql.Rows, opts Options) (*List, error) {
 	var (
-		id          uint64
-		err         error
-		cntRows     sql.NullInt64
-		phoneNumber sql.NullString
+		err     error
+		cntRows sql.NullInt64
 	)
 
 	defer func() {
@@ -209,29 +255,22 @@ func (s *Storage) process(cntResult, sqlResult *sql.Rows, opts Options) (*List,
 	}
 
 	for sqlResult.Next() {
-		var item Item
-
-		err = sqlResult.Scan(&id, &item.ID, &item.Email, &item.Username, &item.Role, &phoneNumber)
+		var item *Item
 
+		item, err = scanItem(sqlResult)
 		if err != nil {
 			s.logger.Error().
 				Err(err).
 				Msg("unable to scan user row")
 			break
 		}
-		item.IsPhoneNumberVerified = phoneNumber.String != ""
-
-		// Add "Slack details" + PhoneNumber if requested
-		if !opts.Short {
-			item.PhoneNumber = phoneNumber.String
 
-			item.Slack = &Slack{
-				UserID: item.ID,
-				TeamID: item.ID,
-			}
+		// "Slack details" + PhoneNumber only if requested
+		if opts.Short {
+			item.PhoneNumber, item.TelegramChatID, item.SMSTranslit, item.Slack = "", "", nil, nil
 		}
 
-		responseList.Result = append(responseList.Result, item)
+		responseList.Result = append(responseList.Result, *item)
 	}
 
 	if responseList.Count > itemsOnPage*int64(opts.Page) {
@@ -241,3 +280,51 @@ func (s *Storage) process(cntResult, sqlResult *sql.Rows, opts Options) (*List,
 
 	return responseList, err
 }
+
+// rowScanner is implemented by *sql.Rows and *sql.Row
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanItem reads row of colsWithPhone, NULL columns are blank, e.g. phone number of user created without it
+// or email of user synced from Grafana without it
+func scanItem(row rowScanner) (*Item, error) {
+	var (
+		id              uint64
+		email           sql.NullString
+		phoneNumber     sql.NullString
+		telegramChatID  sql.NullString
+		smsTranslit     sql.NullBool
+		phoneVerifiedAt sql.NullTime
+		phoneVerified   sql.NullString
+	)
+
+	item := &Item{}
+
+	err := row.Scan(&id, &item.ID, &email, &item.Username, &item.Role, &phoneNumber, &telegramChatID, &smsTranslit,
+		&phoneVerifiedAt, &phoneVerified)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Email = email.String
+	item.PhoneNumber = phoneNumber.String
+	item.IsPhoneNumberVerified = phoneConfirmed(item.PhoneNumber, phoneVerifiedAt, phoneVerified)
+	item.TelegramChatID = telegramChatID.String
+	item.SMSTranslit = nullBool(smsTranslit)
+
+	item.Slack = &Slack{
+		UserID: item.ID,
+		TeamID: item.ID,
+	}
+
+	return item, nil
+}
+
+func nullBool(v sql.NullBool) *bool {
+	if !v.Valid {
+		return nil
+	}
+
+	return &v.Bool
+}
@@ -0,0 +1,79 @@
+package user
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestPhoneLookupMatchesOnlyVerifiedNumbers(t *testing.T) {
+	s := &Storage{logger: zerolog.Nop()}
+
+	query, _, args, err := s.dbQuery(Options{Phones: []string{"79990001122", "+79990001122"}, Limit: 2})
+	if err != nil {
+		t.Fatalf("dbQuery: %v", err)
+	}
+
+	for _, part := range []string{"phone_verified_at IS NOT NULL", "phone_verified = phone_number", "verified = $", "LIMIT 2"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("query has no %q: %s", part, query)
+		}
+	}
+
+	verified := false
+	for _, arg := range args {
+		verified = verified || arg == true
+	}
+
+	if !verified {
+		t.Errorf("contacts are not limited to verified ones: %v", args)
+	}
+}
+
+// fakeRow assigns values like database/sql does: NULL is accepted only by sql.Scanner destinations
+type fakeRow []any
+
+func (r fakeRow) Scan(dest ...any) error {
+	if len(dest) != len(r) {
+		return fmt.Errorf("expected %d destination arguments, not %d", len(r), len(dest))
+	}
+
+	for i, value := range r {
+		if scanner, ok := dest[i].(sql.Scanner); ok {
+			if err := scanner.Scan(value); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if value == nil {
+			return fmt.Errorf("converting NULL to %T is unsupported", dest[i])
+		}
+
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+	}
+
+	return nil
+}
+
+func TestScanItemWithoutPhone(t *testing.T) {
+	row := fakeRow{uint64(1), "UABCD1234", "user@localhost", "user", roleUser, nil, nil, nil, nil, nil}
+
+	item, err := scanItem(row)
+	if err != nil {
+		t.Fatalf("scanItem: %v", err)
+	}
+
+	if item.ID != "UABCD1234" || item.Email != "user@localhost" || item.PhoneNumber != "" || item.IsPhoneNumberVerified {
+		t.Errorf("unexpected user: %+v", item)
+	}
+
+	if item.SMSTranslit != nil || item.Slack == nil || item.Slack.UserID != item.ID {
+		t.Errorf("unexpected optional fields: %+v", item)
+	}
+}
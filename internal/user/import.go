@@ -2,7 +2,7 @@ package user
 
 import (
 	"context"
-	"strconv"
+	"time"
 
 	//nolint:gosec
 	"crypto/md5" // md5 here is for uniq value based on username, so this is safe
@@ -14,61 +14,91 @@ import (
 	sq "github.com/Masterminds/squirrel"
 )
 
-func (s *Storage) Insert(ctx context.Context, id int, name, userName, email string, isAdmin, isActive bool) (bool, error) {
+// Results of Insert
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+)
+
+type importedUser struct {
+	userID   string
+	name     string
+	email    string
+	role     string
+	active   bool
+	syncedAt sql.NullTime
+	// grafanaRole and grafanaActive are reported by Grafana on the last sync
+	grafanaRole   sql.NullString
+	grafanaActive sql.NullBool
+}
+
+// GrafanaRole maps role of Grafana organization: Admin is admin, Editor is user, Viewer can only observe
+func GrafanaRole(orgRole string) string {
+	switch strings.ToLower(orgRole) {
+	case "admin":
+		return roleAdmin
+	case "editor":
+		return roleUser
+	default:
+		return roleObserver
+	}
+}
+
+// Insert creates or updates user imported from Grafana, existing user is found by generated ID or email.
+// Role and active flag are changed only when Grafana changed them since the last sync, so that changes of admin API
+// are kept; user disabled in Grafana is always deactivated. Phone number and contact methods are never changed.
+// With dryRun nothing is written, result tells what would be done
+func (s *Storage) Insert(ctx context.Context, id int, name, userName, email, role string, isActive, dryRun bool) (userID, result string, err error) {
 	// Calculate ID
 	userHash := hashUserID(id, userName)
 
-	// Select
-	selectUserBuilder := builderUserGet.Where(sq.Eq{"user_id": userHash})
-	query, args, err := selectUserBuilder.ToSql()
+	// Select, user created by admin API with the same email is taken over
+	where := sq.Or{sq.Eq{"user_id": userHash}}
+	if email != "" {
+		where = append(where, sq.Expr("lower(email) = lower(?)", email))
+	}
 
+	query, args, err := builderUserGet.
+		Where(where).
+		OrderByClause("user_id = ? DESC", userHash).
+		ToSql()
 	if err != nil {
 		s.logger.Error().
 			Err(err).
 			Msgf("Failed build SQL select %s query", tableOnCallUsers)
 
-		return false, err
+		return "", "", err
 	}
 
-	sqlResult, err := s.db.QueryContext(ctx, query, args...)
+	current, err := s.imported(ctx, query, args)
 	if err != nil {
 		s.logger.Error().
 			Err(err).
 			Msgf("Failed execute SQL select %s query", tableOnCallUsers)
 
-		return false, err
+		return "", "", err
 	}
-	defer func() { _ = sqlResult.Close() }()
 
-	if sqlResult.Next() {
-		// Compare name - email / admin role / disabled, if not matches - UPDATE
-		query, args, err = s.updateQuery(userHash, email, isAdmin, isActive, sqlResult)
+	userID, result = userHash, ImportCreated
 
-		if len(args) == 0 {
-			if err != nil {
-				s.logger.Error().
-					Err(err).
-					Str("username", userName).
-					Msgf("Failed execute update %s query", tableOnCallUsers)
-			}
+	if current != nil {
+		userID = current.userID
 
-			return false, err
+		// Compare name - email / role / disabled, if not matches - UPDATE
+		updateSQL, changed := s.updateQuery(current, name, email, role, isActive)
+		if !changed {
+			return userID, ImportUnchanged, nil
 		}
 
-		s.logger.Info().Str("username", userName).Msg("Update user")
+		result = ImportUpdated
+		query, args, err = updateSQL.ToSql()
 	} else {
-		role := roleUser
-		if isAdmin {
-			role = roleAdmin
-		}
-
-		s.logger.Info().Str("username", userName).Msg("Insert user")
-
 		// Not found - insert new record
-		query, args, err = sq.Insert("users").
+		query, args, err = sq.Insert(tableOnCallUsers).
 			PlaceholderFormat(sq.Dollar).
-			Columns("user_id", "name", "username", "active", "email", "role").
-			Values(userHash, name, userName, isActive, email, role).
+			Columns("user_id", "name", "username", "active", "email", "role", "synced_at", "grafana_role", "grafana_active").
+			Values(userHash, name, userName, isActive, nullString(email), role, time.Now(), role, isActive).
 			ToSql()
 	}
 
@@ -79,58 +109,166 @@ func (s *Storage) Insert(ctx context.Context, id int, name, userName, email stri
 			Interface("args", args).
 			Msg("Failed build SQL user query")
 
-		return false, err
+		return "", "", err
 	}
 
-	sqlResult2, err := s.db.QueryContext(ctx, query, args...)
+	s.logger.Info().
+		Str("username", userName).
+		Bool("dry_run", dryRun).
+		Msgf("User is %s", result)
 
-	if err != nil {
+	if dryRun {
+		return userID, result, nil
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
 		s.logger.Error().
 			Err(err).
 			Str("query", query).
 			Interface("args", args).
 			Msg("Failed execute SQL query")
 
-		return false, err
+		return "", "", err
 	}
-	defer func() { _ = sqlResult2.Close() }()
 
-	return true, nil
+	return userID, result, nil
 }
 
-func (s *Storage) updateQuery(userID, email string, isAdmin, isActive bool, sqlResult *sql.Rows) (query string, args []interface{}, err error) {
+// DeactivateMissing deactivates imported users which are not in Grafana anymore, users created by admin API are kept.
+// It returns user_id of deactivated users, with dryRun they are only looked up. Nobody is deactivated when seen is empty
+func (s *Storage) DeactivateMissing(ctx context.Context, seen []string, dryRun bool) ([]string, error) {
+	if len(seen) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sq.Select("user_id").
+		From(tableOnCallUsers).
+		Where(sq.And{
+			sq.NotEq{"synced_at": nil},
+			sq.Eq{"active": true},
+			sq.NotEq{"user_id": seen},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("failed execute sql select query from %s", tableOnCallUsers)
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	missing := make([]string, 0)
+
+	for rows.Next() {
+		var userID string
+		if err = rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+
+		missing = append(missing, userID)
+	}
+
+	if err = rows.Err(); err != nil || len(missing) == 0 || dryRun {
+		return missing, err
+	}
+
+	query, args, err = builderUpdateUser.
+		Set("active", false).
+		Set("grafana_active", false).
+		Where(sq.Eq{"user_id": missing}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
+		s.logger.Error().Err(err).Msgf("unable to update %s", tableOnCallUsers)
+		return nil, err
+	}
+
+	return missing, nil
+}
+
+func (s *Storage) imported(ctx context.Context, query string, args []interface{}) (*importedUser, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
 	var (
-		dbID       int
-		dbUserID   string
-		dbEmail    string
-		dbUsername string
-		dbRole     string
-		dbActive   bool
+		u           importedUser
+		dbID        int
+		name, email sql.NullString
+		dbUsername  string
+		active      sql.NullBool
 	)
 
-	updateSQL := builderUpdateUser.Where(sq.Eq{"user_id": userID})
+	err = rows.Scan(&dbID, &u.userID, &email, &dbUsername, &u.role, &active, &name, &u.syncedAt, &u.grafanaRole, &u.grafanaActive)
+	if err != nil {
+		return nil, err
+	}
+
+	u.name, u.email, u.active = name.String, email.String, active.Bool
+
+	return &u, nil
+}
+
+func (s *Storage) updateQuery(current *importedUser, name, email, role string, isActive bool) (sq.UpdateBuilder, bool) {
+	changed := false
+	updateSQL := builderUpdateUser.Where(sq.Eq{"user_id": current.userID})
+
+	set := func(column string, value interface{}) {
+		updateSQL = updateSQL.Set(column, value)
+		changed = true
+	}
+
+	if current.name != name {
+		set("name", name)
+	}
+
+	if !strings.EqualFold(current.email, email) {
+		set("email", nullString(email))
+	}
 
-	if err := sqlResult.Scan(&dbID, &dbUserID, &dbEmail, &dbUsername, &dbRole, &dbActive); err != nil {
-		return "", nil, err
+	// Role set by admin is kept until it's changed in Grafana, user taken over from admin API keeps role as well
+	if current.grafanaRole.Valid && current.grafanaRole.String != role && current.role != role {
+		set("role", role)
 	}
 
-	if strings.Compare(dbEmail, email) != 0 {
-		updateSQL = updateSQL.Set("email", email)
+	if !current.grafanaRole.Valid || current.grafanaRole.String != role {
+		set("grafana_role", role)
 	}
 
-	if dbRole == roleAdmin && !isAdmin {
-		updateSQL = updateSQL.Set("role", roleUser)
+	// Grafana disables user, or enables it again after it was disabled there or deactivated as missing.
+	// User deactivated by admin stays deactivated while Grafana reports it enabled
+	switch {
+	case !isActive && current.active:
+		set("active", false)
+	case isActive && !current.active && current.grafanaActive.Valid && !current.grafanaActive.Bool:
+		set("active", true)
 	}
 
-	if dbRole == roleUser && isAdmin {
-		updateSQL = updateSQL.Set("role", roleAdmin)
+	if !current.grafanaActive.Valid || current.grafanaActive.Bool != isActive {
+		set("grafana_active", isActive)
 	}
 
-	if dbActive != isActive {
-		updateSQL = updateSQL.Set("active", strconv.FormatBool(isActive))
+	// User created by admin API is managed by sync from now on
+	if !current.syncedAt.Valid {
+		set("synced_at", time.Now())
 	}
 
-	return updateSQL.ToSql()
+	return updateSQL, changed
 }
 
 func hashUserID(id int, userName string) string {
@@ -0,0 +1,108 @@
+package user
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateQueryKeepsAdminChanges(t *testing.T) {
+	synced := sql.NullTime{Time: time.Now(), Valid: true}
+	grafanaUser := sql.NullString{String: roleUser, Valid: true}
+	grafanaActive := sql.NullBool{Bool: true, Valid: true}
+
+	tests := []struct {
+		name     string
+		current  importedUser
+		role     string
+		isActive bool
+		want     []string
+	}{
+		{
+			name:     "role set by admin is kept",
+			current:  importedUser{role: roleAdmin, active: true, syncedAt: synced, grafanaRole: grafanaUser, grafanaActive: grafanaActive},
+			role:     roleUser,
+			isActive: true,
+		},
+		{
+			name:     "role changed in grafana",
+			current:  importedUser{role: roleUser, active: true, syncedAt: synced, grafanaRole: grafanaUser, grafanaActive: grafanaActive},
+			role:     roleObserver,
+			isActive: true,
+			want:     []string{"role", "grafana_role"},
+		},
+		{
+			name:     "user deactivated by admin stays deactivated",
+			current:  importedUser{role: roleUser, syncedAt: synced, grafanaRole: grafanaUser, grafanaActive: grafanaActive},
+			role:     roleUser,
+			isActive: true,
+		},
+		{
+			name:    "user disabled in grafana",
+			current: importedUser{role: roleUser, active: true, syncedAt: synced, grafanaRole: grafanaUser, grafanaActive: grafanaActive},
+			role:    roleUser,
+			want:    []string{"active", "grafana_active"},
+		},
+		{
+			name: "user enabled in grafana again",
+			current: importedUser{role: roleUser, syncedAt: synced, grafanaRole: grafanaUser,
+				grafanaActive: sql.NullBool{Valid: true}},
+			role:     roleUser,
+			isActive: true,
+			want:     []string{"active", "grafana_active"},
+		},
+		{
+			name:     "user created by admin is taken over",
+			current:  importedUser{role: roleAdmin},
+			role:     roleUser,
+			isActive: true,
+			want:     []string{"grafana_role", "grafana_active", "synced_at"},
+		},
+	}
+
+	s := &Storage{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, changed := s.updateQuery(&tt.current, tt.current.name, tt.current.email, tt.role, tt.isActive)
+			if changed != (len(tt.want) > 0) {
+				t.Fatalf("changed %v, want columns %v", changed, tt.want)
+			}
+
+			if !changed {
+				return
+			}
+
+			query, _, err := builder.ToSql()
+			if err != nil {
+				t.Fatalf("ToSql: %v", err)
+			}
+
+			set := query[strings.Index(query, " SET ")+5 : strings.Index(query, " WHERE ")]
+
+			columns := make([]string, 0)
+			for _, item := range strings.Split(set, ", ") {
+				columns = append(columns, strings.Fields(item)[0])
+			}
+
+			if strings.Join(columns, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("columns %v, want %v", columns, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanItemOfSyncedUser(t *testing.T) {
+	// Sync stores blank email as NULL and never sets phone number
+	row := fakeRow{uint64(2), hashUserID(7, "viewer"), nil, "viewer", roleObserver, nil, nil, nil, nil, nil}
+
+	item, err := scanItem(row)
+	if err != nil {
+		t.Fatalf("scanItem: %v", err)
+	}
+
+	if item.ID != hashUserID(7, "viewer") || item.Email != "" || item.PhoneNumber != "" || item.Role != roleObserver {
+		t.Errorf("unexpected user: %+v", item)
+	}
+}
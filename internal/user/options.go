@@ -26,9 +26,13 @@ type Options struct {
 	Username string
 	Page     int
 	Email    string
-	Short    bool
-	Roles    []string
-	Limit    int
+	// Phones matches verified phone numbers and verified phone contacts
+	Phones []string
+	Short  bool
+	Roles  []string
+	Limit  int
+	// All includes deactivated users
+	All bool
 }
 
 func (s *Storage) fromHTTPRequest(req http.Request) *Options {
@@ -0,0 +1,39 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// WithID looks up user by user_id, phone number and other fields are taken from oncall_users without contacts.
+// Empty Item is returned when user is not found
+func (s *Storage) WithID(ctx context.Context, userID string) (*Item, error) {
+	return s.one(ctx, &Options{UserID: userID, Limit: 1, Short: false})
+}
+
+// ConfirmPhone marks phone number of user as verified, number stays verified until it's changed
+func (s *Storage) ConfirmPhone(ctx context.Context, userID, phone string) error {
+	query, args, err := builderUpdateUser.
+		Set("phone_verified_at", time.Now()).
+		Set("phone_verified", phone).
+		Where(sq.Eq{"user_id": userID, "phone_number": phone}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to confirm phone number in %s", tableOnCallUsers)
+		return err
+	}
+
+	return nil
+}
+
+// phoneConfirmed reports whether the current number is the one which was verified
+func phoneConfirmed(phone string, verifiedAt sql.NullTime, verified sql.NullString) bool {
+	return phone != "" && verifiedAt.Valid && verified.String == phone
+}
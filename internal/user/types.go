@@ -13,6 +13,14 @@ type Item struct {
 	PhoneNumber           string `json:"phone_number,omitempty"`
 	IsPhoneNumberVerified bool   `json:"is_phone_number_verified"`
 	Slack                 *Slack `json:"slack,omitempty"`
+	TelegramChatID        string `json:"-"`
+	// MatrixID and NotifyEmail are taken from verified contact methods, see Prefer
+	MatrixID    string `json:"-"`
+	NotifyEmail string `json:"-"`
+	// Contacts are contact methods from user_contacts table
+	Contacts []Contact `json:"-"`
+	// SMSTranslit overrides notify.sms.translit for user, nil means not set
+	SMSTranslit *bool `json:"-"`
 }
 
 type List struct {
@@ -0,0 +1,337 @@
+package verification
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/config"
+	"github.com/ebogdanov/emu-oncall/internal/db"
+	"github.com/ebogdanov/emu-oncall/internal/metrics"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin"
+)
+
+const (
+	tableVerifications = "phone_verifications"
+
+	minCodeLength = 4
+	maxCodeLength = 10
+
+	smsText   = "Emu-OnCall verification code: %s"
+	phoneText = "Your Emu-OnCall verification code is %s. Once again, %s"
+)
+
+var (
+	errUnknownInstance = errors.New("unknown plugin instance")
+	errUserNotFound    = errors.New("user-not-found")
+	errEmptyPhone      = errors.New("empty-phone-number")
+	errChannel         = errors.New("unsupported-verification-channel")
+	errTooFrequent     = errors.New("verification-code-sent-recently")
+	errNoCode          = errors.New("verification-code-not-requested")
+	errCodeExpired     = errors.New("verification-code-expired")
+	errCodeInvalid     = errors.New("verification-code-invalid")
+	errTooManyAttempts = errors.New("verification-attempts-exceeded")
+	errPhoneChanged    = errors.New("phone-number-changed")
+	errContactChanged  = errors.New("contact-changed")
+
+	rejections = []error{errEmptyPhone, errChannel, errTooFrequent, errNoCode, errCodeExpired, errCodeInvalid,
+		errTooManyAttempts, errPhoneChanged, errContactChanged}
+)
+
+// IsNotFound reports whether error means that user or contact method does not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, errUserNotFound) || user.IsContactNotFound(err)
+}
+
+// IsRejected reports whether request can't be done because of user input or state, not because of failure
+func IsRejected(err error) bool {
+	for _, e := range rejections {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Service confirms phone numbers of oncall_users and contact methods with one-time codes. Phone numbers get code
+// by sms or phone call, other contact methods by plugin configured for their type. Only hash of code is stored
+type Service struct {
+	cfg      config.Verification
+	db       *db.DBx
+	users    *user.Storage
+	notifier plugin.Plugin
+	contacts map[string]plugin.Plugin
+	logger   zerolog.Logger
+	pm       *metrics.Storage
+}
+
+// target is where code is sent: phone number of user or contact method
+type target struct {
+	recipient user.Item
+	contact   *user.Contact
+	value     string
+}
+
+func (t *target) contactID() sql.NullInt64 {
+	if t.contact == nil {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: t.contact.ID, Valid: true}
+}
+
+func New(cfg config.Verification, dbx *db.DBx, users *user.Storage, plugins map[string]plugin.Plugin, l zerolog.Logger,
+	pm *metrics.Storage) (*Service, error) {
+	notifier, ok := plugins[cfg.Instance]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errUnknownInstance, cfg.Instance)
+	}
+
+	contacts := make(map[string]plugin.Plugin, len(cfg.Contacts))
+	for contactType, instance := range cfg.Contacts {
+		if contacts[contactType], ok = plugins[instance]; !ok {
+			return nil, fmt.Errorf("contacts.%s: %w: %q", contactType, errUnknownInstance, instance)
+		}
+	}
+
+	if cfg.CodeLength < minCodeLength {
+		cfg.CodeLength = minCodeLength
+	}
+
+	if cfg.CodeLength > maxCodeLength {
+		cfg.CodeLength = maxCodeLength
+	}
+
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+
+	return &Service{
+		cfg:      cfg,
+		db:       dbx,
+		users:    users,
+		notifier: notifier,
+		contacts: contacts,
+		logger:   l.With().Str("component", "verification").Logger(),
+		pm:       pm,
+	}, nil
+}
+
+// Send generates code for the current phone number of user, or for contact method when contactID is set,
+// and sends it. Phone numbers get code by sms or phone call, previous codes of user are not valid anymore
+func (s *Service) Send(ctx context.Context, userID, channel string, contactID int64) (time.Time, error) {
+	t, err := s.target(ctx, userID, contactID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	notifier := s.notifier
+
+	switch {
+	case t.contact != nil && t.contact.Type != user.ContactPhone:
+		if notifier = s.contacts[t.contact.Type]; notifier == nil {
+			return time.Time{}, errChannel
+		}
+
+		channel = plugin.ChannelSMS
+		if t.contact.Type == user.ContactSlack {
+			channel = plugin.ChannelSlack
+		}
+	case channel != plugin.ChannelSMS && channel != plugin.ChannelPhone:
+		return time.Time{}, errChannel
+	}
+
+	var lastSent sql.NullTime
+
+	err = s.db.QueryRowContext(ctx, `SELECT max(date_add) FROM phone_verifications WHERE user_id = $1`, userID).Scan(&lastSent)
+	if err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to select from %s", tableVerifications)
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	if lastSent.Valid && now.Sub(lastSent.Time) < s.cfg.ResendInterval {
+		return time.Time{}, errTooFrequent
+	}
+
+	code, err := s.code()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	expires := now.Add(s.cfg.TTL)
+
+	query, args, err := sq.Insert(tableVerifications).
+		Columns("date_add", "user_id", "contact_id", "phone_number", "channel", "code", "expires_at").
+		Values(now, userID, t.contactID(), t.value, channel, hash(userID, code), expires).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, args...); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to insert into %s", tableVerifications)
+		return time.Time{}, err
+	}
+
+	switch channel {
+	case plugin.ChannelPhone:
+		spoken := strings.Join(strings.Split(code, ""), " ")
+		err = notifier.CallPhone(ctx, t.recipient, "", fmt.Sprintf(phoneText, spoken, spoken))
+	case plugin.ChannelSlack:
+		err = notifier.MessageSlack(ctx, t.recipient, "", fmt.Sprintf(smsText, code))
+	default:
+		err = notifier.SendSms(ctx, t.recipient, "", fmt.Sprintf(smsText, code))
+	}
+
+	if err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Str("channel", channel).Msg("unable to send verification code")
+
+		// Code which was not sent doesn't block the next request
+		_, _ = s.db.ExecContext(ctx, `DELETE FROM phone_verifications WHERE user_id = $1 AND code = $2`, userID, hash(userID, code))
+
+		return time.Time{}, err
+	}
+
+	s.pm.Notifications.WithLabelValues("verification_sent").Inc()
+
+	s.logger.Info().
+		Str("user_id", userID).
+		Str("channel", channel).
+		Int64("contact_id", contactID).
+		Time("expires_at", expires).
+		Msg("Verification code is sent")
+
+	return expires, nil
+}
+
+// Confirm checks the latest code of user, phone number or contact method is verified when code matches
+// and it was not changed after code was sent
+func (s *Service) Confirm(ctx context.Context, userID, code string) error {
+	var (
+		id        int64
+		contactID sql.NullInt64
+		value     string
+		codeHash  string
+		expires   time.Time
+		attempts  int
+	)
+
+	err := s.db.QueryRowContext(ctx, `SELECT id, contact_id, phone_number, code, expires_at, attempts FROM phone_verifications
+		WHERE user_id = $1 AND confirmed_at IS NULL ORDER BY id DESC LIMIT 1`, userID).
+		Scan(&id, &contactID, &value, &codeHash, &expires, &attempts)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return errNoCode
+	case err != nil:
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to select from %s", tableVerifications)
+		return err
+	case attempts >= s.cfg.MaxAttempts:
+		return errTooManyAttempts
+	case time.Now().After(expires):
+		return errCodeExpired
+	}
+
+	t, err := s.target(ctx, userID, contactID.Int64)
+
+	switch {
+	case err != nil:
+		return err
+	case t.value == value:
+	case contactID.Valid:
+		return errContactChanged
+	default:
+		return errPhoneChanged
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash(userID, strings.TrimSpace(code))), []byte(codeHash)) != 1 {
+		_, _ = s.db.ExecContext(ctx, `UPDATE phone_verifications SET attempts = attempts + 1 WHERE id = $1`, id)
+		s.pm.Notifications.WithLabelValues("verification_failed").Inc()
+
+		return errCodeInvalid
+	}
+
+	if _, err = s.db.ExecContext(ctx, `UPDATE phone_verifications SET confirmed_at = $1 WHERE id = $2`, time.Now(), id); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msgf("unable to update %s", tableVerifications)
+		return err
+	}
+
+	if contactID.Valid {
+		err = s.users.VerifyContact(ctx, userID, contactID.Int64, value)
+	} else {
+		err = s.users.ConfirmPhone(ctx, userID, value)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.pm.Notifications.WithLabelValues("verification_confirmed").Inc()
+
+	s.logger.Info().Str("user_id", userID).Int64("contact_id", contactID.Int64).Msg("Verification code is confirmed")
+
+	return nil
+}
+
+// target loads user, contact method replaces field of user when contactID is set
+func (s *Service) target(ctx context.Context, userID string, contactID int64) (*target, error) {
+	recipient, err := s.users.WithID(ctx, userID)
+
+	switch {
+	case err != nil:
+		return nil, err
+	case recipient.ID == "":
+		return nil, errUserNotFound
+	}
+
+	t := &target{recipient: *recipient, value: recipient.PhoneNumber}
+
+	if contactID != 0 {
+		if t.contact, err = s.users.Contact(ctx, userID, contactID); err != nil {
+			return nil, err
+		}
+
+		t.recipient.Use(t.contact)
+		t.value = t.contact.Value
+	}
+
+	if t.value == "" {
+		return nil, errEmptyPhone
+	}
+
+	return t, nil
+}
+
+// code is random decimal number of configured length, leading zeros are kept
+func (s *Service) code() (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(s.cfg.CodeLength)), nil)
+
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", s.cfg.CodeLength, n), nil
+}
+
+// hash binds code to user, so that the same code of other user doesn't match
+func hash(userID, code string) string {
+	sum := sha256.Sum256([]byte(userID + ":" + code))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"context"
+)
+
+// Capable is implemented by plugins which support only part of channels
+type Capable interface {
+	Channels() []string
+}
+
+// HealthChecker is implemented by plugins which can probe provider, e.g. reachability or account balance
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// Channels returns channels supported by plugin, plugins without Capable support all of them
+func Channels(p Plugin) []string {
+	if c, ok := p.(Capable); ok {
+		return c.Channels()
+	}
+
+	return []string{ChannelPhone, ChannelSMS, ChannelSlack}
+}
+
+// Supports reports whether plugin can deliver to channel
+func Supports(p Plugin, channel string) bool {
+	for _, c := range Channels(p) {
+		if c == channel {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Health probes plugin, plugins without HealthChecker are always healthy
+func Health(ctx context.Context, p Plugin) error {
+	if h, ok := p.(HealthChecker); ok {
+		return h.Health(ctx)
+	}
+
+	return nil
+}
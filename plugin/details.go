@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	"context"
+)
+
+type ctxKeyDetails struct{}
+
+// AlertDetails is rendered alert group loaded from Grafana OnCall, if available
+type AlertDetails struct {
+	Title      string
+	Message    string
+	SourceLink string
+}
+
+// WithAlertDetails attaches alert group details to context passed into plugin
+func WithAlertDetails(ctx context.Context, d *AlertDetails) context.Context {
+	if d == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, ctxKeyDetails{}, d)
+}
+
+// AlertDetailsFromContext returns alert group details or nil, if they were not loaded
+func AlertDetailsFromContext(ctx context.Context) *AlertDetails {
+	d, _ := ctx.Value(ctxKeyDetails{}).(*AlertDetails)
+
+	return d
+}
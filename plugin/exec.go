@@ -0,0 +1,402 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+const (
+	defaultExecTimeout      = 30 * time.Second
+	defaultExecRestartDelay = time.Second
+	maxExecLineSize         = 1024 * 1024
+)
+
+var (
+	errEmptyCommand   = errors.New("command is empty")
+	errExecClosed     = errors.New("external plugin is stopped")
+	errExecExited     = errors.New("external plugin process exited")
+	errExecTimeout    = errors.New("external plugin response timeout")
+	errExecNotOk      = errors.New("external plugin failed")
+	errExecNotStarted = errors.New("external plugin process is not running")
+	errExecLongLine   = errors.New("external plugin wrote too long line")
+)
+
+// ExecRequest is written to plugin stdin as single JSON line, notification fields are inlined
+type ExecRequest struct {
+	ID string `json:"id"`
+	*Notification
+}
+
+// ExecResponse is read from plugin stdout as single JSON line with the same ID
+type ExecResponse struct {
+	ID         string `json:"id"`
+	Ok         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	ExternalID string `json:"external_id,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
+
+// Exec runs external executable and exchanges line-delimited JSON with it over stdin/stdout,
+// so that engines can be written in any language without rebuilding the service.
+// Process is restarted when it crashes, stderr lines are written into log
+type Exec struct {
+	logger       zerolog.Logger
+	command      string
+	args         []string
+	env          []string
+	timeout      time.Duration
+	restartDelay time.Duration
+	channels     []string
+
+	mu     sync.Mutex
+	proc   *execProcess
+	closed bool
+	seq    atomic.Uint64
+}
+
+type execProcess struct {
+	cmd     *exec.Cmd
+	stdin   *os.File
+	writeMu sync.Mutex
+	pending sync.Map // request id -> chan *ExecResponse
+	done    chan struct{}
+}
+
+func NewExec(opts Options, l zerolog.Logger) (*Exec, error) {
+	e := &Exec{
+		logger:       l.With().Str("engine", "exec").Logger(),
+		command:      opts.String("command", ""),
+		args:         opts.StringSlice("args"),
+		timeout:      opts.Duration("timeout", defaultExecTimeout),
+		restartDelay: opts.Duration("restart_delay", defaultExecRestartDelay),
+		channels:     opts.StringSlice("channels"),
+	}
+
+	if len(e.channels) == 0 {
+		e.channels = []string{ChannelPhone, ChannelSMS, ChannelSlack}
+	}
+
+	if e.command == "" {
+		return nil, errEmptyCommand
+	}
+
+	e.env = execEnv(opts)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.start(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *Exec) CallPhone(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, e, ChannelPhone, u, alertID, alertText)
+}
+
+func (e *Exec) SendSms(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, e, ChannelSMS, u, alertID, alertText)
+}
+
+func (e *Exec) MessageSlack(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, e, ChannelSlack, u, alertID, alertText)
+}
+
+// Channels returns channels listed in configuration, all of them by default
+func (e *Exec) Channels() []string {
+	return e.channels
+}
+
+// Health reports whether process is running
+func (e *Exec) Health(_ context.Context) error {
+	_, err := e.process()
+	return err
+}
+
+// Close stops process, it's not restarted after that
+func (e *Exec) Close() error {
+	e.mu.Lock()
+	e.closed = true
+	proc := e.proc
+	e.mu.Unlock()
+
+	if proc == nil {
+		return nil
+	}
+
+	_ = proc.stdin.Close()
+
+	select {
+	case <-proc.done:
+	case <-time.After(e.timeout):
+		_ = proc.cmd.Process.Kill()
+	}
+
+	return nil
+}
+
+// Notify writes notification to process stdin and waits for response line with the same id
+func (e *Exec) Notify(ctx context.Context, n *Notification) error {
+	proc, err := e.process()
+	if err != nil {
+		return err
+	}
+
+	req := &ExecRequest{
+		ID:           strconv.FormatUint(e.seq.Add(1), 10),
+		Notification: n,
+	}
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan *ExecResponse, 1)
+	proc.pending.Store(req.ID, ch)
+	defer proc.pending.Delete(req.ID)
+
+	deadline := time.Now().Add(e.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	// Process which doesn't read stdin would block every notification, so write has deadline too
+	proc.writeMu.Lock()
+	_ = proc.stdin.SetWriteDeadline(deadline)
+	_, err = proc.stdin.Write(append(line, '\n'))
+	proc.writeMu.Unlock()
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// Part of line could be written, so stream is broken and process is restarted
+		e.kill(proc, errExecTimeout)
+		return errExecTimeout
+	}
+
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case resp := <-ch:
+		if resp == nil {
+			return errExecExited
+		}
+
+		result := ResultFromContext(ctx)
+		result.ExternalID = resp.ExternalID
+		result.Status = resp.Status
+
+		if resp.Error == ErrNotSupported.Error() {
+			return ErrNotSupported
+		}
+
+		if !resp.Ok {
+			return fmt.Errorf("%w: %s", errExecNotOk, resp.Error)
+		}
+
+		return nil
+	case <-timer.C:
+		return errExecTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Exec) process() (*execProcess, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return nil, errExecClosed
+	}
+
+	if e.proc == nil {
+		return nil, errExecNotStarted
+	}
+
+	return e.proc, nil
+}
+
+// start runs new process, should be called with e.mu locked
+func (e *Exec) start() error {
+	//nolint:gosec // command is taken from service configuration
+	cmd := exec.Command(e.command, e.args...)
+	cmd.Env = e.env
+
+	// Pipe is made here instead of cmd.StdinPipe, so that writes can have deadline
+	stdinRead, stdin, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = stdinRead.Close() }()
+
+	cmd.Stdin = stdinRead
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err = cmd.Start(); err != nil {
+		_ = stdin.Close()
+		return fmt.Errorf("unable to start %s: %w", e.command, err)
+	}
+
+	proc := &execProcess{
+		cmd:   cmd,
+		stdin: stdin,
+		done:  make(chan struct{}),
+	}
+	e.proc = proc
+
+	e.logger.Info().
+		Str("command", e.command).
+		Int("pid", cmd.Process.Pid).
+		Msg("External plugin started")
+
+	go logStderr(e.logger, stderr)
+	go e.supervise(proc, stdout)
+
+	return nil
+}
+
+func (e *Exec) supervise(proc *execProcess, stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxExecLineSize)
+
+	for scanner.Scan() {
+		var resp ExecResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			e.logger.Warn().Str("stdout", scanner.Text()).Msg("External plugin wrote non JSON line")
+			continue
+		}
+
+		if ch, ok := proc.pending.LoadAndDelete(resp.ID); ok {
+			ch.(chan *ExecResponse) <- &resp
+		}
+	}
+
+	// Process which is still running can't be read anymore
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = errExecLongLine
+		}
+
+		e.kill(proc, err)
+	}
+
+	err := proc.cmd.Wait()
+	_ = proc.stdin.Close()
+	close(proc.done)
+
+	proc.pending.Range(func(key, _ any) bool {
+		if ch, ok := proc.pending.LoadAndDelete(key); ok {
+			ch.(chan *ExecResponse) <- nil
+		}
+
+		return true
+	})
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return
+	}
+
+	e.logger.Error().
+		Err(err).
+		Str("command", e.command).
+		Dur("restart_delay", e.restartDelay).
+		Msg("External plugin exited, restarting")
+
+	e.proc = nil
+
+	go e.restart()
+}
+
+func (e *Exec) restart() {
+	for {
+		time.Sleep(e.restartDelay)
+
+		e.mu.Lock()
+		if e.closed {
+			e.mu.Unlock()
+			return
+		}
+
+		err := e.start()
+		e.mu.Unlock()
+
+		if err == nil {
+			return
+		}
+
+		e.logger.Error().Err(err).Msg("Unable to restart external plugin")
+	}
+}
+
+// kill stops broken process, supervise restarts it
+func (e *Exec) kill(proc *execProcess, reason error) {
+	e.logger.Error().
+		Err(reason).
+		Str("command", e.command).
+		Int("pid", proc.cmd.Process.Pid).
+		Msg("External plugin is killed")
+
+	_ = proc.cmd.Process.Kill()
+}
+
+// logStderr writes every stderr line of external plugin into log
+func logStderr(l zerolog.Logger, stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 64*1024), maxExecLineSize)
+
+	for scanner.Scan() {
+		l.Warn().Str("stderr", scanner.Text()).Msg("External plugin output")
+	}
+}
+
+// execEnv is environment of service with variables from env option. Keys of env map are lower-cased by viper,
+// so they are upper-cased back, list of {name, value} keeps name as is
+func execEnv(opts Options) []string {
+	_, list := opts["env"].([]interface{})
+
+	env := os.Environ()
+	for _, p := range opts.Pairs("env") {
+		if !list {
+			p.Name = strings.ToUpper(p.Name)
+		}
+
+		env = append(env, p.Name+"="+p.Value)
+	}
+
+	return env
+}
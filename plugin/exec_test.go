@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+// execTestScript answers every request line according to MODE environment variable
+const execTestScript = `
+while IFS= read -r line; do
+	id=$(printf '%s' "$line" | sed -n 's/^{"id":"\([0-9]*\)".*/\1/p')
+	case "$MODE" in
+	ok) printf '{"id":"%s","ok":true,"external_id":"x-%s","status":"sent"}\n' "$id" "$id" ;;
+	fail) printf '{"id":"%s","ok":false,"error":"gateway is down","status":"rejected"}\n' "$id" ;;
+	unsupported) printf '{"id":"%s","ok":false,"error":"notification method is not supported by plugin"}\n' "$id" ;;
+	long) head -c 2000000 /dev/zero | tr '\0' a; echo ;;
+	stall) exec sleep 100 ;;
+	esac
+done
+`
+
+func newTestExec(t *testing.T, mode string) *Exec {
+	t.Helper()
+
+	e, err := NewExec(NewOptions(map[string]interface{}{
+		"command": "/bin/sh",
+		"args":    []interface{}{"-c", execTestScript},
+		// viper lower-cases keys of map, variable is upper-cased back
+		"env":           map[string]interface{}{"mode": mode},
+		"timeout":       "300ms",
+		"restart_delay": "10ms",
+	}), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewExec: %v", err)
+	}
+	t.Cleanup(func() { _ = e.Close() })
+
+	return e
+}
+
+func (e *Exec) pid() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.proc == nil {
+		return 0
+	}
+
+	return e.proc.cmd.Process.Pid
+}
+
+// waitRestart waits until process with other pid is running
+func waitRestart(t *testing.T, e *Exec, pid int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for e.pid() == 0 || e.pid() == pid {
+		if time.Now().After(deadline) {
+			t.Fatal("process is not restarted")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestExecResponses(t *testing.T) {
+	tests := []struct {
+		mode       string
+		wantErr    error
+		wantStatus string
+		wantID     string
+	}{
+		{mode: "ok", wantStatus: "sent", wantID: "x-1"},
+		{mode: "fail", wantErr: errExecNotOk, wantStatus: "rejected"},
+		{mode: "unsupported", wantErr: ErrNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			e := newTestExec(t, tt.mode)
+			ctx, result := WithResult(context.Background())
+
+			err := e.SendSms(ctx, user.Item{PhoneNumber: "+79990001122"}, "A1", "text")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+
+			if result.Status != tt.wantStatus || result.ExternalID != tt.wantID {
+				t.Errorf("result %+v", result)
+			}
+		})
+	}
+}
+
+func TestExecRestartsProcessWhichDoesNotRead(t *testing.T) {
+	e := newTestExec(t, "stall")
+	pid := e.pid()
+
+	// The first line is read, then process sleeps, and long text fills pipe buffer
+	_ = e.SendSms(context.Background(), user.Item{}, "A1", "text")
+
+	start := time.Now()
+
+	err := e.SendSms(context.Background(), user.Item{}, "A1", strings.Repeat("a", 1024*1024))
+	if !errors.Is(err, errExecTimeout) {
+		t.Fatalf("error %v, want errExecTimeout", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("write is blocked for %s", elapsed)
+	}
+
+	waitRestart(t, e, pid)
+}
+
+func TestExecWriteHonorsContextDeadline(t *testing.T) {
+	e := newTestExec(t, "stall")
+	_ = e.SendSms(context.Background(), user.Item{}, "A1", "text")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := e.SendSms(ctx, user.Item{}, "A1", strings.Repeat("a", 1024*1024)); err == nil {
+		t.Fatal("no error")
+	}
+
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("context deadline is ignored, call took %s", elapsed)
+	}
+}
+
+func TestExecRestartsAfterTooLongLine(t *testing.T) {
+	e := newTestExec(t, "long")
+	pid := e.pid()
+
+	if err := e.SendSms(context.Background(), user.Item{}, "A1", "text"); !errors.Is(err, errExecExited) {
+		t.Errorf("error %v, want errExecExited", err)
+	}
+
+	waitRestart(t, e, pid)
+}
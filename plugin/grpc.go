@@ -0,0 +1,293 @@
+package plugin
+
+//go:generate buf generate ../proto --template ../proto/buf.gen.yaml -o ..
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin/pluginpb"
+)
+
+var (
+	errEmptyGRPCAddr = errors.New("addr is empty")
+	errGRPCNotOk     = errors.New("grpc plugin failed")
+)
+
+// GRPC calls engine which implements Plugin service of proto/plugin/v1/plugin.proto.
+// Engine can be started by the service with command option, then it's restarted when it exits
+// and its stderr is written into log. Connection is plaintext, engine is expected on localhost or unix socket
+type GRPC struct {
+	logger       zerolog.Logger
+	addr         string
+	command      string
+	args         []string
+	env          []string
+	timeout      time.Duration
+	restartDelay time.Duration
+
+	conn   *grpc.ClientConn
+	client pluginpb.PluginClient
+
+	mu       sync.Mutex
+	channels []string
+	cmd      *exec.Cmd
+	closed   bool
+	done     chan struct{}
+}
+
+func NewGRPC(opts Options, l zerolog.Logger) (*GRPC, error) {
+	g := &GRPC{
+		logger:       l.With().Str("engine", "grpc").Logger(),
+		addr:         opts.String("addr", ""),
+		command:      opts.String("command", ""),
+		args:         opts.StringSlice("args"),
+		env:          execEnv(opts),
+		timeout:      opts.Duration("timeout", defaultExecTimeout),
+		restartDelay: opts.Duration("restart_delay", defaultExecRestartDelay),
+		channels:     opts.StringSlice("channels"),
+		done:         make(chan struct{}),
+	}
+
+	if g.addr == "" {
+		return nil, errEmptyGRPCAddr
+	}
+
+	if len(g.channels) == 0 {
+		g.channels = []string{ChannelPhone, ChannelSMS, ChannelSlack}
+	}
+
+	// Connection is established lazily and restored after engine restart
+	conn, err := grpc.NewClient(g.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("addr: %w", err)
+	}
+
+	g.conn = conn
+	g.client = pluginpb.NewPluginClient(conn)
+
+	if g.command == "" {
+		close(g.done)
+		return g, nil
+	}
+
+	g.mu.Lock()
+	err = g.start()
+	g.mu.Unlock()
+
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func (g *GRPC) CallPhone(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, g, ChannelPhone, u, alertID, alertText)
+}
+
+func (g *GRPC) SendSms(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, g, ChannelSMS, u, alertID, alertText)
+}
+
+func (g *GRPC) MessageSlack(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, g, ChannelSlack, u, alertID, alertText)
+}
+
+// Notify calls Notify method of engine, UNIMPLEMENTED status is reported as not supported channel
+func (g *GRPC) Notify(ctx context.Context, n *Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	resp, err := g.client.Notify(ctx, &pluginpb.NotifyRequest{Notification: notificationProto(n)})
+	if status.Code(err) == codes.Unimplemented {
+		return ErrNotSupported
+	}
+
+	if err != nil {
+		return err
+	}
+
+	result := ResultFromContext(ctx)
+	result.ExternalID = resp.GetExternalId()
+	result.Status = resp.GetStatus()
+
+	if !resp.GetOk() {
+		return fmt.Errorf("%w: %s", errGRPCNotOk, resp.GetError())
+	}
+
+	return nil
+}
+
+// Channels returns channels reported by the last health check, configured ones before that
+func (g *GRPC) Channels() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.channels
+}
+
+// Health calls Health method of engine and keeps channels which it reported
+func (g *GRPC) Health(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	resp, err := g.client.Health(ctx, &pluginpb.HealthRequest{})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.GetChannels()) > 0 {
+		g.mu.Lock()
+		g.channels = resp.GetChannels()
+		g.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Close closes connection and stops engine process, it's not restarted after that
+func (g *GRPC) Close() error {
+	g.mu.Lock()
+	g.closed = true
+	cmd := g.cmd
+	g.mu.Unlock()
+
+	err := g.conn.Close()
+
+	if cmd == nil {
+		return err
+	}
+
+	_ = cmd.Process.Signal(os.Interrupt)
+
+	select {
+	case <-g.done:
+	case <-time.After(g.timeout):
+		_ = cmd.Process.Kill()
+	}
+
+	return err
+}
+
+// start runs engine process, should be called with g.mu locked
+func (g *GRPC) start() error {
+	//nolint:gosec // command is taken from service configuration
+	cmd := exec.Command(g.command, g.args...)
+	cmd.Env = g.env
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start %s: %w", g.command, err)
+	}
+
+	g.cmd = cmd
+
+	g.logger.Info().
+		Str("command", g.command).
+		Int("pid", cmd.Process.Pid).
+		Msg("External plugin started")
+
+	go func() {
+		logStderr(g.logger, stderr)
+		g.supervise(cmd)
+	}()
+
+	return nil
+}
+
+// supervise waits until process exits and starts it again
+func (g *GRPC) supervise(cmd *exec.Cmd) {
+	err := cmd.Wait()
+
+	for {
+		g.mu.Lock()
+		if g.closed {
+			g.cmd = nil
+			g.mu.Unlock()
+			close(g.done)
+
+			return
+		}
+		g.mu.Unlock()
+
+		g.logger.Error().
+			Err(err).
+			Str("command", g.command).
+			Dur("restart_delay", g.restartDelay).
+			Msg("External plugin exited, restarting")
+
+		time.Sleep(g.restartDelay)
+
+		g.mu.Lock()
+		if g.closed {
+			g.mu.Unlock()
+			continue
+		}
+
+		err = g.start()
+		g.mu.Unlock()
+
+		if err == nil {
+			return
+		}
+	}
+}
+
+func notificationProto(n *Notification) *pluginpb.Notification {
+	result := &pluginpb.Notification{
+		Version:        int32(n.Version),
+		RequestId:      n.RequestID,
+		NotificationId: n.NotificationID,
+		Attempt:        int32(n.Attempt),
+		Step:           int32(n.Step),
+		Type:           n.Type,
+		Channel:        n.Channel,
+		User: &pluginpb.User{
+			Id:             n.User.ID,
+			Email:          n.User.Email,
+			Username:       n.User.Username,
+			PhoneNumber:    n.User.PhoneNumber,
+			TelegramChatId: n.User.TelegramChatID,
+			MatrixId:       n.User.MatrixID,
+			NotifyEmail:    n.User.NotifyEmail,
+		},
+		Text:         n.Text,
+		Encoding:     n.Encoding,
+		Segments:     int32(n.Segments),
+		Ssml:         n.SSML,
+		AlertId:      n.AlertID,
+		IncidentId:   int64(n.IncidentID),
+		Title:        n.Title,
+		Severity:     n.Severity,
+		AlertChannel: n.AlertChannel,
+		SourceLink:   n.SourceLink,
+	}
+
+	if n.Details != nil {
+		result.Details = &pluginpb.AlertDetails{
+			Title:      n.Details.Title,
+			Message:    n.Details.Message,
+			SourceLink: n.Details.SourceLink,
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+	"github.com/ebogdanov/emu-oncall/plugin/pluginpb"
+)
+
+// fakeEngine is Plugin service which answers by channel of notification
+type fakeEngine struct {
+	pluginpb.UnimplementedPluginServer
+
+	received chan *pluginpb.Notification
+}
+
+func (f *fakeEngine) Notify(ctx context.Context, req *pluginpb.NotifyRequest) (*pluginpb.NotifyResponse, error) {
+	n := req.GetNotification()
+	f.received <- n
+
+	switch n.GetChannel() {
+	case ChannelSMS:
+		return &pluginpb.NotifyResponse{Ok: true, ExternalId: "msg-1", Status: "sent"}, nil
+	case ChannelPhone:
+		return &pluginpb.NotifyResponse{Ok: false, Error: "callee is busy", Status: CallBusy}, nil
+	case ChannelSlack:
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return nil, status.Error(codes.Unimplemented, "channel is not supported")
+}
+
+func (f *fakeEngine) Health(context.Context, *pluginpb.HealthRequest) (*pluginpb.HealthResponse, error) {
+	return &pluginpb.HealthResponse{Channels: []string{ChannelSMS}}, nil
+}
+
+func newTestGRPC(t *testing.T, opts map[string]interface{}) (*GRPC, *fakeEngine) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	engine := &fakeEngine{received: make(chan *pluginpb.Notification, 10)}
+
+	srv := grpc.NewServer()
+	pluginpb.RegisterPluginServer(srv, engine)
+
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+
+	cfg := map[string]interface{}{"addr": ln.Addr().String(), "timeout": "300ms"}
+	for k, v := range opts {
+		cfg[k] = v
+	}
+
+	g, err := NewGRPC(NewOptions(cfg), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewGRPC: %v", err)
+	}
+	t.Cleanup(func() { _ = g.Close() })
+
+	return g, engine
+}
+
+func TestGRPCNotify(t *testing.T) {
+	g, engine := newTestGRPC(t, nil)
+
+	ctx, result := WithResult(context.Background())
+
+	err := g.Notify(ctx, &Notification{
+		Version:    NotificationVersion,
+		Type:       ChannelPhone,
+		Channel:    ChannelSMS,
+		User:       user.Item{ID: "U1", PhoneNumber: "+79990001122"},
+		Text:       "db is down",
+		Encoding:   "gsm7",
+		Segments:   1,
+		AlertID:    "A1",
+		IncidentID: 42,
+		Details:    &AlertDetails{Title: "DB", SourceLink: "https://grafana.local/a/42"},
+	})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if result.ExternalID != "msg-1" || result.Status != "sent" {
+		t.Errorf("result %+v", result)
+	}
+
+	n := <-engine.received
+	if n.GetUser().GetPhoneNumber() != "+79990001122" || n.GetText() != "db is down" || n.GetIncidentId() != 42 ||
+		n.GetEncoding() != "gsm7" || n.GetDetails().GetSourceLink() != "https://grafana.local/a/42" {
+		t.Errorf("notification %v", n)
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	g, _ := newTestGRPC(t, nil)
+
+	tests := []struct {
+		channel    string
+		wantErr    error
+		wantStatus string
+	}{
+		{channel: ChannelPhone, wantErr: errGRPCNotOk, wantStatus: CallBusy},
+		{channel: "matrix", wantErr: ErrNotSupported},
+	}
+
+	for _, tt := range tests {
+		ctx, result := WithResult(context.Background())
+
+		err := g.Notify(ctx, &Notification{Channel: tt.channel})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error %v, want %v", tt.channel, err, tt.wantErr)
+		}
+
+		if result.Status != tt.wantStatus {
+			t.Errorf("%s: status %q, want %q", tt.channel, result.Status, tt.wantStatus)
+		}
+	}
+
+	start := time.Now()
+	if err := g.Notify(context.Background(), &Notification{Channel: ChannelSlack}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("slow engine: error %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout is ignored, call took %s", elapsed)
+	}
+}
+
+func TestGRPCHealthReportsChannels(t *testing.T) {
+	g, _ := newTestGRPC(t, nil)
+
+	if len(g.Channels()) != 3 {
+		t.Errorf("channels before health check %v", g.Channels())
+	}
+
+	if err := g.Health(context.Background()); err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+
+	if channels := g.Channels(); len(channels) != 1 || channels[0] != ChannelSMS {
+		t.Errorf("channels %v", channels)
+	}
+}
+
+func TestGRPCRestartsCommand(t *testing.T) {
+	starts := filepath.Join(t.TempDir(), "starts")
+
+	g, _ := newTestGRPC(t, map[string]interface{}{
+		"command":       "/bin/sh",
+		"args":          []interface{}{"-c", `echo started >> "$STARTS"; echo crashed >&2; exit 1`},
+		"env":           []interface{}{map[string]interface{}{"name": "STARTS", "value": starts}},
+		"restart_delay": "10ms",
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(starts)
+		if strings.Count(string(data), "started") >= 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("command is not restarted")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := g.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	data, _ := os.ReadFile(starts)
+	time.Sleep(50 * time.Millisecond)
+
+	if after, _ := os.ReadFile(starts); len(after) != len(data) {
+		t.Error("command is restarted after Close")
+	}
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+// NotificationVersion is bumped when fields of Notification change meaning or are removed
+const NotificationVersion = 2
+
+// Notification is everything known about single delivery attempt
+type Notification struct {
+	Version   int    `json:"version"`
+	RequestID string `json:"request_id"`
+	// NotificationID is ID of notification in /api/v1/notifications, 0 when it was not stored
+	NotificationID int64 `json:"notification_id,omitempty"`
+	// Attempt is number of delivery attempt (outbox retry, redial), Step is position in fallback chain of this attempt
+	Attempt int `json:"attempt"`
+	Step    int `json:"step"`
+	// Type is notification type requested by OnCall (phone, sms), Channel is method used for this attempt
+	Type    string    `json:"type"`
+	Channel string    `json:"channel"`
+	User    user.Item `json:"user"`
+	Text    string    `json:"text"`
+	// Encoding (gsm7, ucs2) and Segments are set for sms channel, after text was prepared
+	Encoding string `json:"encoding,omitempty"`
+	Segments int    `json:"segments,omitempty"`
+	// SSML is phone call text for TTS engines, set when notify.speech.ssml is enabled
+	SSML string `json:"ssml,omitempty"`
+
+	// Fields below are filled when incident details were loaded from Grafana OnCall
+	AlertID      string        `json:"alert_id"`
+	IncidentID   int           `json:"incident_id,omitempty"`
+	Title        string        `json:"title,omitempty"`
+	Severity     string        `json:"severity,omitempty"`
+	AlertChannel string        `json:"alert_channel,omitempty"`
+	SourceLink   string        `json:"source_link,omitempty"`
+	Details      *AlertDetails `json:"details,omitempty"`
+	// Render is grafana.Render of alert group
+	Render interface{} `json:"-"`
+}
+
+// Notifier is implemented by plugins which accept full Notification instead of positional arguments
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// AsNotifier returns plugin as Notifier, three-method plugins are wrapped with adapter
+func AsNotifier(p Plugin) Notifier {
+	if n, ok := p.(Notifier); ok {
+		return n
+	}
+
+	return &pluginAdapter{p: p}
+}
+
+// pluginAdapter calls method of Plugin by notification channel
+type pluginAdapter struct {
+	p Plugin
+}
+
+func (a *pluginAdapter) Notify(ctx context.Context, n *Notification) error {
+	ctx = WithAlertDetails(ctx, n.Details)
+
+	switch n.Channel {
+	case ChannelPhone:
+		return a.p.CallPhone(ctx, n.User, n.AlertID, n.Text)
+	case ChannelSMS:
+		return a.p.SendSms(ctx, n.User, n.AlertID, n.Text)
+	case ChannelSlack:
+		return a.p.MessageSlack(ctx, n.User, n.AlertID, n.Text)
+	}
+
+	return ErrNotSupported
+}
+
+// notifyLegacy builds Notification for three-method calls of Notifier plugins
+func notifyLegacy(ctx context.Context, n Notifier, channel string, u user.Item, alertID, alertText string) error {
+	return n.Notify(ctx, &Notification{
+		Version: NotificationVersion,
+		Type:    channel,
+		Channel: channel,
+		Attempt: 1,
+		Step:    1,
+		User:    u,
+		AlertID: alertID,
+		Text:    alertText,
+		Details: AlertDetailsFromContext(ctx),
+	})
+}
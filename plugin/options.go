@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// Options is plugin.<name> config subtree, keys are lower-cased by viper
+type Options map[string]interface{}
+
+func NewOptions(raw interface{}) Options {
+	opts := Options{}
+
+	switch items := raw.(type) {
+	case map[string]interface{}:
+		for k, v := range items {
+			opts[strings.ToLower(k)] = v
+		}
+	case map[interface{}]interface{}:
+		for k, v := range items {
+			opts[strings.ToLower(cast.ToString(k))] = v
+		}
+	}
+
+	return opts
+}
+
+func (o Options) Has(key string) bool {
+	_, ok := o[key]
+	return ok
+}
+
+func (o Options) String(key, def string) string {
+	if v, ok := o[key]; ok && v != nil {
+		return cast.ToString(v)
+	}
+
+	return def
+}
+
+func (o Options) Int(key string, def int) int {
+	if v, ok := o[key]; ok && v != nil {
+		return cast.ToInt(v)
+	}
+
+	return def
+}
+
+func (o Options) Bool(key string, def bool) bool {
+	if v, ok := o[key]; ok && v != nil {
+		return cast.ToBool(v)
+	}
+
+	return def
+}
+
+func (o Options) Duration(key string, def time.Duration) time.Duration {
+	if v, ok := o[key]; ok && v != nil {
+		return cast.ToDuration(v)
+	}
+
+	return def
+}
+
+func (o Options) StringSlice(key string) []string {
+	if v, ok := o[key]; ok && v != nil {
+		return cast.ToStringSlice(v)
+	}
+
+	return nil
+}
+
+func (o Options) StringMap(key string) map[string]string {
+	if v, ok := o[key]; ok && v != nil {
+		return cast.ToStringMapString(v)
+	}
+
+	return map[string]string{}
+}
+
+// Pair is name and value of list option, name keeps its case unlike map keys
+type Pair struct {
+	Name  string
+	Value string
+}
+
+// Pairs reads list of {name, value} maps in configured order. Map value is accepted as well,
+// but its keys are already lower-cased by viper
+func (o Options) Pairs(key string) []Pair {
+	var result []Pair
+
+	switch items := o[key].(type) {
+	case []interface{}:
+		for _, item := range items {
+			pair := NewOptions(item)
+			if name := pair.String("name", ""); name != "" {
+				result = append(result, Pair{Name: name, Value: pair.String("value", "")})
+			}
+		}
+	case nil:
+	default:
+		for name, value := range o.StringMap(key) {
+			result = append(result, Pair{Name: name, Value: value})
+		}
+
+		sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	}
+
+	return result
+}
+
+// Sub returns nested subtree, missing or non-map value gives empty Options
+func (o Options) Sub(key string) Options {
+	return NewOptions(o[key])
+}
@@ -2,10 +2,21 @@ package plugin
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ebogdanov/emu-oncall/internal/user"
 )
 
+// Notification channels, same names are used in events log
+const (
+	ChannelPhone = "phone"
+	ChannelSMS   = "sms"
+	ChannelSlack = "slack"
+)
+
+// ErrNotSupported is returned when engine can't deliver notification with requested method
+var ErrNotSupported = errors.New("notification method is not supported by plugin")
+
 type Plugin interface {
 	CallPhone(context.Context, user.Item, string, string) error
 	SendSms(context.Context, user.Item, string, string) error
@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultDriver is used when plugin.driver is not set
+	DefaultDriver = "textoutput"
+
+	// DefaultInstance is name of plugin configured by plugin.driver
+	DefaultInstance = "default"
+)
+
+var (
+	errEmptyDriverName  = errors.New("plugin driver name is empty")
+	errDriverRegistered = errors.New("plugin driver is already registered")
+	errUnknownDriver    = errors.New("unknown plugin driver")
+	errNilPlugin        = errors.New("plugin factory returned nil")
+	errReservedInstance = errors.New("plugin instance name is reserved")
+)
+
+// Factory builds plugin from its plugin.<name> config subtree
+type Factory func(opts Options, l zerolog.Logger) (Plugin, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		"textoutput": func(_ Options, l zerolog.Logger) (Plugin, error) {
+			return NewTextOutput(l), nil
+		},
+		"exec": func(opts Options, l zerolog.Logger) (Plugin, error) {
+			return NewExec(opts, l)
+		},
+		"grpc": func(opts Options, l zerolog.Logger) (Plugin, error) {
+			return NewGRPC(opts, l)
+		},
+		"rest_api": func(opts Options, l zerolog.Logger) (Plugin, error) {
+			return NewRestAPI(opts, l)
+		},
+		"webhook": func(opts Options, l zerolog.Logger) (Plugin, error) {
+			return NewRestAPI(opts, l)
+		},
+		"smpp": func(opts Options, l zerolog.Logger) (Plugin, error) {
+			return NewSMPP(opts, l)
+		},
+		"smtp": func(opts Options, l zerolog.Logger) (Plugin, error) {
+			return NewSMTP(opts, l)
+		},
+		"telegram": func(opts Options, l zerolog.Logger) (Plugin, error) {
+			return NewTelegram(opts, l)
+		},
+		"voip": func(opts Options, l zerolog.Logger) (Plugin, error) {
+			return NewVoip(opts, l)
+		},
+	}
+)
+
+// Register makes plugin available by name for plugin.driver option.
+// Third-party engines should call it before config is applied, e.g. from main
+func Register(name string, f Factory) error {
+	if name == "" {
+		return errEmptyDriverName
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("%w: %s", errDriverRegistered, name)
+	}
+
+	registry[name] = f
+
+	return nil
+}
+
+// Drivers returns sorted list of registered plugin names
+func Drivers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New builds plugin selected by plugin.driver, passing plugin.<driver> subtree into factory.
+// Config can be destination URL instead, either as string or as url key
+func New(cfg interface{}, l zerolog.Logger) (Plugin, error) {
+	if raw, ok := cfg.(string); ok {
+		return NewFromURL(raw, l)
+	}
+
+	opts := NewOptions(cfg)
+
+	if opts.Has("url") {
+		return NewFromURL(opts.String("url", ""), l)
+	}
+
+	driver := opts.String("driver", DefaultDriver)
+	if driver == "" {
+		driver = DefaultDriver
+	}
+
+	return Build(driver, opts.Sub(driver), l)
+}
+
+// NewSet builds default plugin and named instances from plugin.instances,
+// every instance has the same structure as plugin section: driver and <driver> subtree
+func NewSet(cfg interface{}, l zerolog.Logger) (map[string]Plugin, error) {
+	defaultPlugin, err := New(cfg, l)
+	if err != nil {
+		return nil, err
+	}
+
+	set := map[string]Plugin{DefaultInstance: defaultPlugin}
+
+	for name, instanceCfg := range NewOptions(cfg).Sub("instances") {
+		if name == DefaultInstance {
+			return nil, fmt.Errorf("%w: %s", errReservedInstance, name)
+		}
+
+		p, err := New(instanceCfg, l.With().Str("instance", name).Logger())
+		if err != nil {
+			return nil, fmt.Errorf("instance %q: %w", name, err)
+		}
+
+		set[name] = p
+	}
+
+	return set, nil
+}
+
+// Build creates plugin instance using registered factory
+func Build(driver string, opts Options, l zerolog.Logger) (Plugin, error) {
+	registryMu.RLock()
+	factory, ok := registry[driver]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available: %v", errUnknownDriver, driver, Drivers())
+	}
+
+	p, err := factory(opts, l)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %q: invalid configuration: %w", driver, err)
+	}
+
+	if p == nil {
+		return nil, fmt.Errorf("plugin %q: %w", driver, errNilPlugin)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,168 @@
+package plugin
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+var errFactory = errors.New("factory failed")
+
+// testDriver keeps options which it was built with
+type testDriver struct {
+	TextOutput
+
+	opts Options
+}
+
+var registerOnce sync.Once
+
+func registerTestDrivers(t *testing.T) {
+	t.Helper()
+
+	registerOnce.Do(func() {
+		for name, f := range map[string]Factory{
+			"test": func(opts Options, _ zerolog.Logger) (Plugin, error) {
+				return &testDriver{opts: opts}, nil
+			},
+			"test_nil": func(Options, zerolog.Logger) (Plugin, error) {
+				return nil, nil
+			},
+			"test_error": func(Options, zerolog.Logger) (Plugin, error) {
+				return nil, errFactory
+			},
+		} {
+			if err := Register(name, f); err != nil {
+				t.Fatalf("Register %s: %v", name, err)
+			}
+		}
+	})
+}
+
+func TestNewSelectsDriver(t *testing.T) {
+	registerTestDrivers(t)
+
+	p, err := New(nil, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("New without config: %v", err)
+	}
+
+	if _, ok := p.(*TextOutput); !ok {
+		t.Errorf("default driver is %T", p)
+	}
+
+	p, err = New(map[string]interface{}{
+		"driver": "test",
+		"test":   map[string]interface{}{"Token": "secret"},
+		"other":  map[string]interface{}{"token": "other"},
+	}, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	d, ok := p.(*testDriver)
+	if !ok {
+		t.Fatalf("driver is %T", p)
+	}
+
+	if d.opts.String("token", "") != "secret" {
+		t.Errorf("driver options %v", d.opts)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	registerTestDrivers(t)
+
+	tests := []struct {
+		driver string
+		want   error
+	}{
+		{driver: "unknown", want: errUnknownDriver},
+		{driver: "test_nil", want: errNilPlugin},
+		{driver: "test_error", want: errFactory},
+	}
+
+	for _, tt := range tests {
+		if _, err := New(map[string]interface{}{"driver": tt.driver}, zerolog.Nop()); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.driver, err, tt.want)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	registerTestDrivers(t)
+
+	if err := Register("", nil); !errors.Is(err, errEmptyDriverName) {
+		t.Errorf("empty name: %v", err)
+	}
+
+	if err := Register("test", nil); !errors.Is(err, errDriverRegistered) {
+		t.Errorf("registered twice: %v", err)
+	}
+
+	found := false
+	for _, name := range Drivers() {
+		found = found || name == "test"
+	}
+
+	if !found {
+		t.Errorf("drivers %v", Drivers())
+	}
+}
+
+func TestNewSet(t *testing.T) {
+	registerTestDrivers(t)
+
+	set, err := NewSet(map[string]interface{}{
+		"driver": "test",
+		"instances": map[string]interface{}{
+			"backup": map[string]interface{}{"driver": "textoutput"},
+			"other":  map[string]interface{}{"driver": "test", "test": map[string]interface{}{"token": "other"}},
+		},
+	}, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewSet: %v", err)
+	}
+
+	if len(set) != 3 {
+		t.Fatalf("instances %v", set)
+	}
+
+	if _, ok := set[DefaultInstance].(*testDriver); !ok {
+		t.Errorf("default instance is %T", set[DefaultInstance])
+	}
+
+	if _, ok := set["backup"].(*TextOutput); !ok {
+		t.Errorf("backup instance is %T", set["backup"])
+	}
+
+	if d, ok := set["other"].(*testDriver); !ok || d.opts.String("token", "") != "other" {
+		t.Errorf("other instance is %#v", set["other"])
+	}
+
+	tests := []struct {
+		name      string
+		instances map[string]interface{}
+		want      error
+	}{
+		{
+			name:      "reserved name",
+			instances: map[string]interface{}{DefaultInstance: map[string]interface{}{"driver": "test"}},
+			want:      errReservedInstance,
+		},
+		{
+			name:      "unknown driver of instance",
+			instances: map[string]interface{}{"backup": map[string]interface{}{"driver": "unknown"}},
+			want:      errUnknownDriver,
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := NewSet(map[string]interface{}{"driver": "test", "instances": tt.instances}, zerolog.Nop())
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -1,33 +1,387 @@
-// nolint:dupl
 package plugin
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/ebogdanov/emu-oncall/internal/user"
 )
 
+const (
+	contentTypeJSON = "json"
+	contentTypeForm = "form"
+
+	defaultRestAPITimeout = 10 * time.Second
+	maxResponseSize       = 64 * 1024
+)
+
+var (
+	errNoChannels       = errors.New("at least one of phone, sms or slack sections should be configured")
+	errEmptyURL         = errors.New("url is empty")
+	errInvalidMethod    = errors.New("unsupported http method")
+	errInvalidType      = errors.New("content_type should be json or form")
+	errUnexpectedStatus = errors.New("unexpected response status")
+	errFailurePattern   = errors.New("response matches failure_pattern")
+	errNoSuccessPattern = errors.New("response does not match success_pattern")
+)
+
+var (
+	allowedRestAPIMethod = map[string]bool{
+		http.MethodGet:   true,
+		http.MethodPost:  true,
+		http.MethodPut:   true,
+		http.MethodPatch: true,
+	}
+)
+
+// RestAPI sends notifications as HTTP requests to gateways, configured per channel
 type RestAPI struct {
-	logger *zerolog.Logger
+	client    *http.Client
+	logger    zerolog.Logger
+	channels  map[string]*restEndpoint
+	headers   map[string]string
+	healthURL string
 }
 
-func NewRestAPI(l *zerolog.Logger) *RestAPI {
-	return &RestAPI{logger: l}
+type restEndpoint struct {
+	method         string
+	url            *template.Template
+	contentType    string
+	headers        map[string]string
+	body           *template.Template
+	form           []restFormField
+	successCodes   map[int]bool
+	successPattern *regexp.Regexp
+	failurePattern *regexp.Regexp
 }
 
-func (t *RestAPI) CallPhone(_ context.Context, u user.Item, alertID, alertText string) error {
-	t.logger.Debug().Msgf("Phone call to %s with text %s, alert id: %s", u.PhoneNumber, alertText, alertID)
-	return nil
+type restFormField struct {
+	name  string
+	value *template.Template
+}
+
+var restAPIFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func NewRestAPI(opts Options, l zerolog.Logger) (*RestAPI, error) {
+	r := &RestAPI{
+		client:    &http.Client{Timeout: opts.Duration("timeout", defaultRestAPITimeout)},
+		logger:    l.With().Str("engine", "rest_api").Logger(),
+		channels:  make(map[string]*restEndpoint),
+		headers:   opts.StringMap("headers"),
+		healthURL: opts.String("health_url", ""),
+	}
+
+	for _, channel := range []string{ChannelPhone, ChannelSMS, ChannelSlack} {
+		if !opts.Has(channel) {
+			continue
+		}
+
+		endpoint, err := newRestEndpoint(channel, opts.Sub(channel), r.headers)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", channel, err)
+		}
+
+		r.channels[channel] = endpoint
+	}
+
+	if len(r.channels) == 0 {
+		return nil, errNoChannels
+	}
+
+	return r, nil
+}
+
+func newRestEndpoint(channel string, opts Options, commonHeaders map[string]string) (*restEndpoint, error) {
+	var err error
+
+	rawURL := opts.String("url", "")
+	if rawURL == "" {
+		return nil, errEmptyURL
+	}
+
+	e := &restEndpoint{
+		method:       strings.ToUpper(opts.String("method", http.MethodPost)),
+		contentType:  strings.ToLower(opts.String("content_type", contentTypeJSON)),
+		headers:      make(map[string]string),
+		successCodes: make(map[int]bool),
+	}
+
+	if !allowedRestAPIMethod[e.method] {
+		return nil, fmt.Errorf("%w: %s", errInvalidMethod, e.method)
+	}
+
+	if e.contentType != contentTypeJSON && e.contentType != contentTypeForm {
+		return nil, fmt.Errorf("%w: %s", errInvalidType, e.contentType)
+	}
+
+	if e.url, err = template.New(channel + "_url").Funcs(restAPIFuncs).Parse(rawURL); err != nil {
+		return nil, err
+	}
+
+	escapeActions(e.url.Tree.Root)
+
+	if e.body, err = template.New(channel + "_body").Funcs(restAPIFuncs).Parse(opts.String("body", "")); err != nil {
+		return nil, err
+	}
+
+	for _, field := range opts.Pairs("form") {
+		tpl, err := template.New(channel + "_form_" + field.Name).Funcs(restAPIFuncs).Parse(field.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		e.form = append(e.form, restFormField{name: field.Name, value: tpl})
+	}
+
+	for name, value := range commonHeaders {
+		e.headers[name] = value
+	}
+
+	for name, value := range opts.StringMap("headers") {
+		e.headers[name] = value
+	}
+
+	for _, code := range opts.StringSlice("success_codes") {
+		var statusCode int
+		if _, err = fmt.Sscanf(code, "%d", &statusCode); err != nil {
+			return nil, fmt.Errorf("success_codes: %w", err)
+		}
+
+		e.successCodes[statusCode] = true
+	}
+
+	if pattern := opts.String("success_pattern", ""); pattern != "" {
+		if e.successPattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("success_pattern: %w", err)
+		}
+	}
+
+	if pattern := opts.String("failure_pattern", ""); pattern != "" {
+		if e.failurePattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("failure_pattern: %w", err)
+		}
+	}
+
+	return e, nil
+}
+
+func (t *RestAPI) CallPhone(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, t, ChannelPhone, u, alertID, alertText)
+}
+
+func (t *RestAPI) SendSms(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, t, ChannelSMS, u, alertID, alertText)
 }
 
-func (t *RestAPI) SendSms(_ context.Context, u user.Item, alertID, alertText string) error {
-	t.logger.Debug().Msgf("Send SMS to %s with text %s, alert id: %s", u.PhoneNumber, alertText, alertID)
+func (t *RestAPI) MessageSlack(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, t, ChannelSlack, u, alertID, alertText)
+}
+
+// Channels returns channels which have own section in configuration
+func (t *RestAPI) Channels() []string {
+	channels := make([]string, 0, len(t.channels))
+
+	for _, channel := range []string{ChannelPhone, ChannelSMS, ChannelSlack} {
+		if _, ok := t.channels[channel]; ok {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
+
+// Health requests health_url when it's configured, any 2xx response means gateway is reachable
+func (t *RestAPI) Health(ctx context.Context) error {
+	if t.healthURL == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.healthURL, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: %d", errUnexpectedStatus, resp.StatusCode)
+	}
+
 	return nil
 }
 
-func (t *RestAPI) MessageSlack(_ context.Context, u user.Item, alertID, alertText string) error {
-	t.logger.Debug().Msgf("Send slack message to dbUser with id %s with text %s, alert id: %s", u.ID, alertText, alertID)
+// Notify sends request to gateway, templates are executed with Notification as data
+func (t *RestAPI) Notify(ctx context.Context, n *Notification) error {
+	endpoint, ok := t.channels[n.Channel]
+	if !ok {
+		return ErrNotSupported
+	}
+
+	req, err := endpoint.request(ctx, n)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	t.logger.Debug().
+		Str("channel", n.Channel).
+		Str("url", RedactURL(req.URL.String())).
+		Int("http_code", resp.StatusCode).
+		Str("alert_id", n.AlertID).
+		Str("request_id", n.RequestID).
+		Msg("Gateway responded")
+
+	return endpoint.check(resp.StatusCode, body)
+}
+
+func (e *restEndpoint) request(ctx context.Context, payload *Notification) (*http.Request, error) {
+	var (
+		buf         bytes.Buffer
+		body        io.Reader = http.NoBody
+		contentType string
+	)
+
+	if err := e.url.Execute(&buf, payload); err != nil {
+		return nil, err
+	}
+	requestURL := buf.String()
+
+	switch {
+	case e.method == http.MethodGet:
+	case e.contentType == contentTypeForm:
+		values := make([]string, 0, len(e.form))
+		for _, field := range e.form {
+			var value bytes.Buffer
+			if err := field.value.Execute(&value, payload); err != nil {
+				return nil, err
+			}
+			values = append(values, url.QueryEscape(field.name)+"="+url.QueryEscape(value.String()))
+		}
+
+		body = strings.NewReader(strings.Join(values, "&"))
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		var value bytes.Buffer
+		if err := e.body.Execute(&value, payload); err != nil {
+			return nil, err
+		}
+
+		body = &value
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, e.method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "emu-oncall/0.0.1")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	return req, nil
+}
+
+func (e *restEndpoint) check(statusCode int, body []byte) error {
+	validCode := statusCode >= 200 && statusCode < 300
+	if len(e.successCodes) > 0 {
+		validCode = e.successCodes[statusCode]
+	}
+
+	if !validCode {
+		return fmt.Errorf("%w: %d", errUnexpectedStatus, statusCode)
+	}
+
+	if e.failurePattern != nil && e.failurePattern.Match(body) {
+		return errFailurePattern
+	}
+
+	if e.successPattern != nil && !e.successPattern.Match(body) {
+		return errNoSuccessPattern
+	}
+
 	return nil
 }
+
+// escapeActions pipes output of every action in url template through urlquery, so that values can't break
+// query string. Actions which already end with urlquery are kept as is
+func escapeActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, child := range n.Nodes {
+			escapeActions(child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+
+		last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "urlquery" {
+			return
+		}
+
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier("urlquery").SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.RangeNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.WithNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	}
+}
@@ -0,0 +1,199 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+type gatewayRequest struct {
+	method      string
+	rawQuery    string
+	contentType string
+	header      http.Header
+	body        string
+}
+
+// newGateway starts stub gateway which records requests and answers with code and body
+func newGateway(t *testing.T, code int, body string) (*httptest.Server, <-chan gatewayRequest) {
+	t.Helper()
+
+	requests := make(chan gatewayRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		requests <- gatewayRequest{
+			method:      r.Method,
+			rawQuery:    r.URL.RawQuery,
+			contentType: r.Header.Get("Content-Type"),
+			header:      r.Header.Clone(),
+			body:        string(b),
+		}
+
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, requests
+}
+
+func newTestRestAPI(t *testing.T, opts map[string]interface{}) *RestAPI {
+	t.Helper()
+
+	r, err := NewRestAPI(NewOptions(opts), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewRestAPI: %v", err)
+	}
+
+	return r
+}
+
+var restTestUser = user.Item{ID: "U1", Username: "ivan", PhoneNumber: "+79990001122"}
+
+func TestRestAPIJSONBody(t *testing.T) {
+	srv, requests := newGateway(t, http.StatusOK, `{"status": "ok"}`)
+
+	r := newTestRestAPI(t, map[string]interface{}{
+		"headers": map[string]interface{}{"authorization": "Bearer secret"},
+		"sms": map[string]interface{}{
+			"url":             srv.URL + "/send?to={{ .User.PhoneNumber }}&id={{ .AlertID }}",
+			"body":            `{"text": {{ json .Text }}}`,
+			"success_pattern": `"status":\s*"ok"`,
+		},
+	})
+
+	if err := r.SendSms(context.Background(), restTestUser, "A 1&x=2", `say "hi"`); err != nil {
+		t.Fatalf("SendSms: %v", err)
+	}
+
+	req := <-requests
+	if req.method != http.MethodPost || req.contentType != "application/json" {
+		t.Errorf("method %s, content type %s", req.method, req.contentType)
+	}
+
+	if want := "to=%2B79990001122&id=A+1%26x%3D2"; req.rawQuery != want {
+		t.Errorf("query %q, want %q", req.rawQuery, want)
+	}
+
+	if want := `{"text": "say \"hi\""}`; req.body != want {
+		t.Errorf("body %q, want %q", req.body, want)
+	}
+
+	if got := req.header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("authorization header %q", got)
+	}
+}
+
+func TestRestAPIURLQueryIsNotEscapedTwice(t *testing.T) {
+	srv, requests := newGateway(t, http.StatusOK, "")
+
+	r := newTestRestAPI(t, map[string]interface{}{
+		"sms": map[string]interface{}{
+			"url":    srv.URL + "/send?to={{ urlquery .User.PhoneNumber }}",
+			"method": "get",
+		},
+	})
+
+	if err := r.SendSms(context.Background(), restTestUser, "1", "text"); err != nil {
+		t.Fatalf("SendSms: %v", err)
+	}
+
+	if req := <-requests; req.rawQuery != "to=%2B79990001122" || req.method != http.MethodGet {
+		t.Errorf("%s query %q", req.method, req.rawQuery)
+	}
+}
+
+func TestRestAPIFormKeepsFieldCase(t *testing.T) {
+	srv, requests := newGateway(t, http.StatusOK, "")
+
+	r := newTestRestAPI(t, map[string]interface{}{
+		"phone": map[string]interface{}{
+			"url":          srv.URL + "/call",
+			"content_type": "form",
+			"form": []interface{}{
+				map[string]interface{}{"name": "To", "value": "{{ .User.PhoneNumber }}"},
+				map[string]interface{}{"name": "Body", "value": "{{ .Text }}"},
+				map[string]interface{}{"name": "From", "value": "OnCall"},
+			},
+		},
+	})
+
+	if err := r.CallPhone(context.Background(), restTestUser, "1", "db is down"); err != nil {
+		t.Fatalf("CallPhone: %v", err)
+	}
+
+	req := <-requests
+	if want := "To=%2B79990001122&Body=db+is+down&From=OnCall"; req.body != want {
+		t.Errorf("body %q, want %q", req.body, want)
+	}
+
+	if req.contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("content type %q", req.contentType)
+	}
+}
+
+func TestRestAPIResponseMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		body    string
+		opts    map[string]interface{}
+		wantErr error
+	}{
+		{name: "2xx", code: http.StatusAccepted},
+		{name: "5xx", code: http.StatusBadGateway, wantErr: errUnexpectedStatus},
+		{
+			name:    "success code list",
+			code:    http.StatusOK,
+			opts:    map[string]interface{}{"success_codes": []interface{}{202}},
+			wantErr: errUnexpectedStatus,
+		},
+		{
+			name:    "failure pattern",
+			code:    http.StatusOK,
+			body:    `{"error": "no balance"}`,
+			opts:    map[string]interface{}{"failure_pattern": `"error"`},
+			wantErr: errFailurePattern,
+		},
+		{
+			name:    "missing success pattern",
+			code:    http.StatusOK,
+			body:    `{"status": "queued"}`,
+			opts:    map[string]interface{}{"success_pattern": `"status":\s*"ok"`},
+			wantErr: errNoSuccessPattern,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newGateway(t, tt.code, tt.body)
+
+			sms := map[string]interface{}{"url": srv.URL}
+			for k, v := range tt.opts {
+				sms[k] = v
+			}
+
+			r := newTestRestAPI(t, map[string]interface{}{"sms": sms})
+
+			err := r.SendSms(context.Background(), restTestUser, "1", "text")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestAPIChannelNotConfigured(t *testing.T) {
+	r := newTestRestAPI(t, map[string]interface{}{"sms": map[string]interface{}{"url": "http://localhost"}})
+
+	if err := r.MessageSlack(context.Background(), restTestUser, "1", "text"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("error %v, want ErrNotSupported", err)
+	}
+}
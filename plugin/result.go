@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"context"
+)
+
+type ctxKeyResult struct{}
+
+// Result is filled by plugin with details of delivery, which are stored in events log
+type Result struct {
+	// ExternalID is provider message or call identifier, used to match delivery receipts
+	ExternalID string
+	// Status is provider specific delivery state, e.g. submitted, delivered, answered
+	Status string
+}
+
+// Receipt is asynchronous delivery report from provider
+type Receipt struct {
+	ExternalID string
+	Status     string
+	Success    bool
+	Msg        string
+}
+
+// ReceiptReporter is implemented by plugins which receive delivery reports
+type ReceiptReporter interface {
+	OnReceipt(func(Receipt))
+}
+
+// WithResult attaches empty Result to context, plugin fills it during delivery
+func WithResult(ctx context.Context) (context.Context, *Result) {
+	r := &Result{}
+
+	return context.WithValue(ctx, ctxKeyResult{}, r), r
+}
+
+// ResultFromContext returns Result to be filled by plugin, it's never nil
+func ResultFromContext(ctx context.Context) *Result {
+	if r, ok := ctx.Value(ctxKeyResult{}).(*Result); ok {
+		return r
+	}
+
+	return &Result{}
+}
@@ -0,0 +1,444 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/sms"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+const (
+	defaultSMPPEnquireLink = 30 * time.Second
+	defaultSMPPReconnect   = 5 * time.Second
+	defaultSMPPTimeout     = 10 * time.Second
+	smppPartsTTL           = 72 * time.Hour
+
+	smppStatusSubmitted = "submitted"
+	smppStatusDelivered = "delivered"
+	smppStateDelivered  = "DELIVRD"
+	smppStateAccepted   = "ACCEPTD"
+	smppStateEnroute    = "ENROUTE"
+)
+
+var (
+	errEmptyPhone       = errors.New("user has no phone number")
+	errEmptySMPPAddr    = errors.New("addr is empty")
+	errEmptySystemID    = errors.New("system_id is empty")
+	errEmptySource      = errors.New("source_addr is empty")
+	errSMPPNotBound     = errors.New("smpp: not bound to SMSC")
+	errSMPPClosed       = errors.New("smpp: connection closed")
+	errSMPPTimeout      = errors.New("smpp: response timeout")
+	errSMPPCommandState = errors.New("smpp: command failed with status")
+)
+
+// SMPP is SMPP v3.4 transceiver client, which sends SMS directly to SMSC.
+// Connection is kept in background with enquire_link and reconnects after failures.
+// Delivery receipts are reported with OnReceipt callback
+type SMPP struct {
+	logger zerolog.Logger
+
+	addr        string
+	systemID    string
+	password    string
+	systemType  string
+	source      smppAddress
+	destTON     byte
+	destNPI     byte
+	registered  byte
+	enquireLink time.Duration
+	reconnect   time.Duration
+	timeout     time.Duration
+
+	writeMu sync.Mutex
+	conn    net.Conn
+	bound   atomic.Bool
+	seq     atomic.Uint32
+	ref     atomic.Uint32
+	pending sync.Map // sequence -> chan *smppPDU
+	parts   sync.Map // part message_id -> *smppPart
+
+	receiptMu sync.RWMutex
+	receiptFn func(Receipt)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// smppPart links message_id of any part of long message to message_id of the first one
+type smppPart struct {
+	messageID string
+	created   time.Time
+}
+
+func NewSMPP(opts Options, l zerolog.Logger) (*SMPP, error) {
+	s := &SMPP{
+		logger:     l.With().Str("engine", "smpp").Logger(),
+		addr:       opts.String("addr", ""),
+		systemID:   opts.String("system_id", ""),
+		password:   opts.String("password", ""),
+		systemType: opts.String("system_type", ""),
+		source: smppAddress{
+			ton:  byte(opts.Int("source_ton", 5)),
+			npi:  byte(opts.Int("source_npi", 0)),
+			addr: opts.String("source_addr", ""),
+		},
+		destTON:     byte(opts.Int("dest_ton", 1)),
+		destNPI:     byte(opts.Int("dest_npi", 1)),
+		enquireLink: opts.Duration("enquire_link", defaultSMPPEnquireLink),
+		reconnect:   opts.Duration("reconnect", defaultSMPPReconnect),
+		timeout:     opts.Duration("timeout", defaultSMPPTimeout),
+		stop:        make(chan struct{}),
+	}
+
+	if opts.Bool("registered_delivery", true) {
+		s.registered = 1
+	}
+
+	switch {
+	case s.addr == "":
+		return nil, errEmptySMPPAddr
+	case s.systemID == "":
+		return nil, errEmptySystemID
+	case s.source.addr == "":
+		return nil, errEmptySource
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+func (s *SMPP) CallPhone(_ context.Context, _ user.Item, _, _ string) error {
+	return ErrNotSupported
+}
+
+func (s *SMPP) MessageSlack(_ context.Context, _ user.Item, _, _ string) error {
+	return ErrNotSupported
+}
+
+func (s *SMPP) SendSms(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, s, ChannelSMS, u, alertID, alertText)
+}
+
+// Notify submits sms with encoding which was chosen when text was prepared
+func (s *SMPP) Notify(ctx context.Context, n *Notification) error {
+	if n.Channel != ChannelSMS {
+		return ErrNotSupported
+	}
+
+	if n.User.PhoneNumber == "" {
+		return errEmptyPhone
+	}
+
+	if !s.bound.Load() {
+		return errSMPPNotBound
+	}
+
+	// Text of legacy call is not prepared, and GSM-7 can't carry text which was changed after preparation
+	encoding := n.Encoding
+	if encoding != sms.EncodingUCS2 {
+		encoding = sms.Encoding(n.Text)
+	}
+
+	coding, esmClass, parts, err := smppSegments(n.Text, encoding, byte(s.ref.Add(1)))
+	if err != nil {
+		return err
+	}
+
+	dest := smppAddress{
+		ton:  s.destTON,
+		npi:  s.destNPI,
+		addr: strings.TrimPrefix(n.User.PhoneNumber, "+"),
+	}
+
+	var messageID string
+	for i, part := range parts {
+		resp, err := s.request(ctx, smppSubmitSM, submitSMBody(s.source, dest, esmClass, s.registered, coding, part))
+		if err != nil {
+			return fmt.Errorf("part %d/%d: %w", i+1, len(parts), err)
+		}
+
+		partID := (&smppReader{data: resp.body}).cString()
+		if messageID == "" {
+			messageID = partID
+		}
+
+		s.parts.Store(partID, &smppPart{messageID: messageID, created: time.Now()})
+	}
+
+	result := ResultFromContext(ctx)
+	result.ExternalID = messageID
+	result.Status = smppStatusSubmitted
+
+	s.logger.Debug().
+		Str("phone", n.User.PhoneNumber).
+		Str("alert_id", n.AlertID).
+		Str("message_id", messageID).
+		Int("parts", len(parts)).
+		Msg("SMS was submitted to SMSC")
+
+	return nil
+}
+
+// Channels returns sms only, SMSC can't make calls
+func (s *SMPP) Channels() []string {
+	return []string{ChannelSMS}
+}
+
+// Health reports whether session is bound, it's kept alive with enquire_link
+func (s *SMPP) Health(_ context.Context) error {
+	if !s.bound.Load() {
+		return errSMPPNotBound
+	}
+
+	return nil
+}
+
+// OnReceipt registers callback for delivery receipts
+func (s *SMPP) OnReceipt(fn func(Receipt)) {
+	s.receiptMu.Lock()
+	s.receiptFn = fn
+	s.receiptMu.Unlock()
+}
+
+// Close unbinds from SMSC and stops reconnecting
+func (s *SMPP) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+	return nil
+}
+
+func (s *SMPP) run() {
+	for {
+		err := s.session()
+		if err != nil {
+			s.logger.Error().Err(err).Str("addr", s.addr).Msg("SMPP session failed")
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(s.reconnect):
+		}
+	}
+}
+
+func (s *SMPP) session() error {
+	conn, err := net.DialTimeout("tcp", s.addr, s.timeout)
+	if err != nil {
+		return err
+	}
+
+	s.writeMu.Lock()
+	s.conn = conn
+	s.writeMu.Unlock()
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- s.readLoop(conn)
+	}()
+
+	defer func() {
+		s.bound.Store(false)
+		_ = conn.Close()
+		s.failPending()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	_, err = s.request(ctx, smppBindTransceiver, bindTransceiverBody(s.systemID, s.password, s.systemType))
+	cancel()
+
+	if err != nil {
+		return fmt.Errorf("bind_transceiver: %w", err)
+	}
+
+	s.bound.Store(true)
+	s.logger.Info().Str("addr", s.addr).Str("system_id", s.systemID).Msg("Bound to SMSC")
+
+	ticker := time.NewTicker(s.enquireLink)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err = <-readErr:
+			return err
+
+		case <-ticker.C:
+			ctx, cancel = context.WithTimeout(context.Background(), s.timeout)
+			_, err = s.request(ctx, smppEnquireLink, nil)
+			cancel()
+
+			if err != nil {
+				return fmt.Errorf("enquire_link: %w", err)
+			}
+
+			s.cleanupParts()
+
+		case <-s.stop:
+			s.bound.Store(false)
+
+			ctx, cancel = context.WithTimeout(context.Background(), s.timeout)
+			_, _ = s.request(ctx, smppUnbind, nil)
+			cancel()
+
+			return nil
+		}
+	}
+}
+
+func (s *SMPP) readLoop(conn net.Conn) error {
+	for {
+		p, err := readSMPPPDU(conn)
+		if err != nil {
+			return err
+		}
+
+		if p.commandID&smppRespMask != 0 {
+			if ch, ok := s.pending.LoadAndDelete(p.sequence); ok {
+				ch.(chan *smppPDU) <- p
+			}
+
+			continue
+		}
+
+		switch p.commandID {
+		case smppDeliverSM:
+			s.deliver(p)
+			_ = s.write(&smppPDU{commandID: smppDeliverSMResp, sequence: p.sequence, body: []byte{0}})
+		case smppEnquireLink:
+			_ = s.write(&smppPDU{commandID: smppEnquireLinkResp, sequence: p.sequence})
+		case smppUnbind:
+			_ = s.write(&smppPDU{commandID: smppUnbindResp, sequence: p.sequence})
+			return errSMPPClosed
+		default:
+			_ = s.write(&smppPDU{commandID: smppGenericNack, status: smppStatusInvCmd, sequence: p.sequence})
+		}
+	}
+}
+
+func (s *SMPP) deliver(p *smppPDU) {
+	d, err := parseDeliverSM(p.body)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("unable to parse deliver_sm")
+		return
+	}
+
+	if d.esmClass&smppESMClassReceipt == 0 {
+		s.logger.Info().Str("source", d.source).Msg("Incoming SMS is ignored")
+		return
+	}
+
+	id, state, errCode := d.receipt()
+	if part, ok := s.parts.Load(id); ok {
+		id = part.(*smppPart).messageID
+	}
+
+	status := strings.ToLower(state)
+	if state == smppStateDelivered {
+		status = smppStatusDelivered
+	}
+
+	receipt := Receipt{
+		ExternalID: id,
+		Status:     status,
+		Success:    state == smppStateDelivered || state == smppStateAccepted || state == smppStateEnroute,
+		Msg:        fmt.Sprintf("delivery receipt: %s, err: %s", state, errCode),
+	}
+
+	s.logger.Debug().
+		Str("message_id", id).
+		Str("state", state).
+		Str("err", errCode).
+		Msg("Delivery receipt received")
+
+	s.receiptMu.RLock()
+	fn := s.receiptFn
+	s.receiptMu.RUnlock()
+
+	if fn != nil && id != "" {
+		fn(receipt)
+	}
+}
+
+func (s *SMPP) request(ctx context.Context, commandID uint32, body []byte) (*smppPDU, error) {
+	seq := s.nextSequence()
+	ch := make(chan *smppPDU, 1)
+	s.pending.Store(seq, ch)
+
+	if err := s.write(&smppPDU{commandID: commandID, sequence: seq, body: body}); err != nil {
+		s.pending.Delete(seq)
+		return nil, err
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-ch:
+		if resp == nil {
+			return nil, errSMPPClosed
+		}
+
+		if resp.status != smppStatusOK {
+			return nil, fmt.Errorf("%w 0x%08X", errSMPPCommandState, resp.status)
+		}
+
+		return resp, nil
+	case <-timer.C:
+		s.pending.Delete(seq)
+		return nil, errSMPPTimeout
+	case <-ctx.Done():
+		s.pending.Delete(seq)
+		return nil, ctx.Err()
+	}
+}
+
+func (s *SMPP) write(p *smppPDU) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if s.conn == nil {
+		return errSMPPNotBound
+	}
+
+	_ = s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err := s.conn.Write(p.marshal())
+
+	return err
+}
+
+func (s *SMPP) nextSequence() uint32 {
+	// Allowed range is 0x00000001 - 0x7FFFFFFF
+	return s.seq.Add(1)%0x7FFFFFFF + 1
+}
+
+func (s *SMPP) failPending() {
+	s.pending.Range(func(key, _ any) bool {
+		if ch, ok := s.pending.LoadAndDelete(key); ok {
+			ch.(chan *smppPDU) <- nil
+		}
+
+		return true
+	})
+}
+
+func (s *SMPP) cleanupParts() {
+	s.parts.Range(func(key, value any) bool {
+		if time.Since(value.(*smppPart).created) > smppPartsTTL {
+			s.parts.Delete(key)
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,315 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ebogdanov/emu-oncall/internal/sms"
+)
+
+// SMPP v3.4 command identifiers
+const (
+	smppGenericNack     uint32 = 0x80000000
+	smppBindTransceiver uint32 = 0x00000009
+	smppSubmitSM        uint32 = 0x00000004
+	smppDeliverSM       uint32 = 0x00000005
+	smppDeliverSMResp   uint32 = 0x80000005
+	smppUnbind          uint32 = 0x00000006
+	smppUnbindResp      uint32 = 0x80000006
+	smppEnquireLink     uint32 = 0x00000015
+	smppEnquireLinkResp uint32 = 0x80000015
+
+	smppRespMask uint32 = 0x80000000
+)
+
+const (
+	smppHeaderLen    = 16
+	smppMaxPDULen    = 64 * 1024
+	smppVersion      = 0x34
+	smppStatusOK     = 0x00000000
+	smppStatusInvCmd = 0x00000003
+
+	smppCodingDefault = 0x00
+	smppCodingUCS2    = 0x08
+
+	smppESMClassUDHI    = 0x40
+	smppESMClassReceipt = 0x04
+
+	smppTagReceiptedMsgID = 0x001E
+	smppTagMessageState   = 0x0427
+
+	smppMaxParts = 255
+)
+
+var (
+	errSMPPShortPDU    = errors.New("smpp: malformed pdu")
+	errSMPPTooLongPDU  = errors.New("smpp: pdu is too long")
+	errSMPPTooManyPart = errors.New("smpp: message is too long")
+
+	regexpReceipt = regexp.MustCompile(`id:(\S+).*stat:(\S+)(?:\s+err:(\S+))?`)
+
+	// SMPP message_state values from message_state TLV
+	smppMessageStates = map[byte]string{
+		1: "ENROUTE",
+		2: "DELIVRD",
+		3: "EXPIRED",
+		4: "DELETED",
+		5: "UNDELIV",
+		6: "ACCEPTD",
+		7: "UNKNOWN",
+		8: "REJECTD",
+	}
+)
+
+type smppPDU struct {
+	commandID uint32
+	status    uint32
+	sequence  uint32
+	body      []byte
+}
+
+func (p *smppPDU) marshal() []byte {
+	buf := make([]byte, smppHeaderLen, smppHeaderLen+len(p.body))
+
+	binary.BigEndian.PutUint32(buf[0:], uint32(smppHeaderLen+len(p.body)))
+	binary.BigEndian.PutUint32(buf[4:], p.commandID)
+	binary.BigEndian.PutUint32(buf[8:], p.status)
+	binary.BigEndian.PutUint32(buf[12:], p.sequence)
+
+	return append(buf, p.body...)
+}
+
+func readSMPPPDU(r io.Reader) (*smppPDU, error) {
+	header := make([]byte, smppHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:])
+	if length < smppHeaderLen {
+		return nil, errSMPPShortPDU
+	}
+
+	if length > smppMaxPDULen {
+		return nil, errSMPPTooLongPDU
+	}
+
+	p := &smppPDU{
+		commandID: binary.BigEndian.Uint32(header[4:]),
+		status:    binary.BigEndian.Uint32(header[8:]),
+		sequence:  binary.BigEndian.Uint32(header[12:]),
+		body:      make([]byte, length-smppHeaderLen),
+	}
+
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// smppWriter builds PDU body field by field
+type smppWriter struct {
+	bytes.Buffer
+}
+
+func (w *smppWriter) cString(s string) {
+	w.WriteString(s)
+	w.WriteByte(0)
+}
+
+// smppReader reads PDU body field by field, first error is kept
+type smppReader struct {
+	data []byte
+	err  error
+}
+
+func (r *smppReader) cString() string {
+	if r.err != nil {
+		return ""
+	}
+
+	i := bytes.IndexByte(r.data, 0)
+	if i < 0 {
+		r.err = errSMPPShortPDU
+		return ""
+	}
+
+	s := string(r.data[:i])
+	r.data = r.data[i+1:]
+
+	return s
+}
+
+func (r *smppReader) byte() byte {
+	if r.err != nil || len(r.data) < 1 {
+		r.err = errSMPPShortPDU
+		return 0
+	}
+
+	b := r.data[0]
+	r.data = r.data[1:]
+
+	return b
+}
+
+func (r *smppReader) bytes(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = errSMPPShortPDU
+		return nil
+	}
+
+	b := r.data[:n]
+	r.data = r.data[n:]
+
+	return b
+}
+
+// tlvs parses optional parameters left after mandatory fields
+func (r *smppReader) tlvs() map[uint16][]byte {
+	result := make(map[uint16][]byte)
+
+	for r.err == nil && len(r.data) >= 4 {
+		tag := binary.BigEndian.Uint16(r.data[0:])
+		length := int(binary.BigEndian.Uint16(r.data[2:]))
+		r.data = r.data[4:]
+
+		result[tag] = r.bytes(length)
+	}
+
+	return result
+}
+
+type smppAddress struct {
+	ton  byte
+	npi  byte
+	addr string
+}
+
+func bindTransceiverBody(systemID, password, systemType string) []byte {
+	w := &smppWriter{}
+
+	w.cString(systemID)
+	w.cString(password)
+	w.cString(systemType)
+	w.WriteByte(smppVersion)
+	w.WriteByte(0) // addr_ton
+	w.WriteByte(0) // addr_npi
+	w.cString("")  // address_range
+
+	return w.Bytes()
+}
+
+func submitSMBody(src, dst smppAddress, esmClass, registered, coding byte, msg []byte) []byte {
+	w := &smppWriter{}
+
+	w.cString("") // service_type
+	w.WriteByte(src.ton)
+	w.WriteByte(src.npi)
+	w.cString(src.addr)
+	w.WriteByte(dst.ton)
+	w.WriteByte(dst.npi)
+	w.cString(dst.addr)
+	w.WriteByte(esmClass)
+	w.WriteByte(0) // protocol_id
+	w.WriteByte(0) // priority_flag
+	w.cString("")  // schedule_delivery_time
+	w.cString("")  // validity_period
+	w.WriteByte(registered)
+	w.WriteByte(0) // replace_if_present_flag
+	w.WriteByte(coding)
+	w.WriteByte(0) // sm_default_msg_id
+	w.WriteByte(byte(len(msg)))
+	w.Write(msg)
+
+	return w.Bytes()
+}
+
+// smppDelivery is parsed deliver_sm PDU
+type smppDelivery struct {
+	source   string
+	esmClass byte
+	coding   byte
+	message  []byte
+	tlv      map[uint16][]byte
+}
+
+func parseDeliverSM(body []byte) (*smppDelivery, error) {
+	r := &smppReader{data: body}
+	d := &smppDelivery{}
+
+	r.cString() // service_type
+	r.byte()    // source_addr_ton
+	r.byte()    // source_addr_npi
+	d.source = r.cString()
+	r.byte()    // dest_addr_ton
+	r.byte()    // dest_addr_npi
+	r.cString() // destination_addr
+	d.esmClass = r.byte()
+	r.byte()    // protocol_id
+	r.byte()    // priority_flag
+	r.cString() // schedule_delivery_time
+	r.cString() // validity_period
+	r.byte()    // registered_delivery
+	r.byte()    // replace_if_present_flag
+	d.coding = r.byte()
+	r.byte() // sm_default_msg_id
+	d.message = r.bytes(int(r.byte()))
+	d.tlv = r.tlvs()
+
+	return d, r.err
+}
+
+// receipt extracts message id and final state from delivery receipt
+func (d *smppDelivery) receipt() (id, state, errCode string) {
+	if m := regexpReceipt.FindStringSubmatch(string(d.message)); m != nil {
+		id, state, errCode = m[1], m[2], m[3]
+	}
+
+	if v, ok := d.tlv[smppTagReceiptedMsgID]; ok {
+		id = strings.TrimRight(string(v), "\x00")
+	}
+
+	if v, ok := d.tlv[smppTagMessageState]; ok && len(v) == 1 {
+		if name, found := smppMessageStates[v[0]]; found {
+			state = name
+		}
+	}
+
+	return id, state, errCode
+}
+
+// smppSegments encodes text and splits it into parts with concatenation UDH if required.
+// Encoding and segments are decided by internal/sms, so that they match what was counted before sending
+func smppSegments(text, encoding string, ref byte) (coding, esmClass byte, parts [][]byte, err error) {
+	coding = smppCodingDefault
+	if encoding == sms.EncodingUCS2 {
+		coding = smppCodingUCS2
+	}
+
+	chunks := sms.Split(text, encoding)
+	if len(chunks) > smppMaxParts {
+		return 0, 0, nil, fmt.Errorf("%w: %d parts", errSMPPTooManyPart, len(chunks))
+	}
+
+	for i, chunk := range chunks {
+		msg, err := sms.Encode(chunk, encoding)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+
+		if len(chunks) > 1 {
+			esmClass = smppESMClassUDHI
+			msg = append([]byte{0x05, 0x00, 0x03, ref, byte(len(chunks)), byte(i + 1)}, msg...)
+		}
+
+		parts = append(parts, msg)
+	}
+
+	return coding, esmClass, parts, nil
+}
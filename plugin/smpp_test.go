@@ -0,0 +1,341 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/sms"
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+// smscSimulator is in-process SMSC: it binds transceiver, answers submit_sm with message IDs msg1, msg2..
+// and sends delivery receipts on request
+type smscSimulator struct {
+	ln       net.Listener
+	password string
+
+	mu        sync.Mutex
+	conn      net.Conn
+	submitted []*smppDelivery
+	binds     int
+
+	submits chan *smppDelivery
+}
+
+func newSMSCSimulator(t *testing.T, password string) *smscSimulator {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	sim := &smscSimulator{ln: ln, password: password, submits: make(chan *smppDelivery, 100)}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go sim.serve(conn)
+		}
+	}()
+
+	return sim
+}
+
+func (sim *smscSimulator) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	sim.mu.Lock()
+	sim.conn = conn
+	sim.mu.Unlock()
+
+	for {
+		p, err := readSMPPPDU(conn)
+		if err != nil {
+			return
+		}
+
+		resp := &smppPDU{commandID: p.commandID | smppRespMask, sequence: p.sequence}
+
+		switch p.commandID {
+		case smppBindTransceiver:
+			r := &smppReader{data: p.body}
+			r.cString() // system_id
+			if r.cString() != sim.password {
+				resp.status = 0x0000000E // ESME_RINVPASWD
+			}
+
+			sim.mu.Lock()
+			sim.binds++
+			sim.mu.Unlock()
+
+			resp.body = []byte("SMSC\x00")
+		case smppSubmitSM:
+			// submit_sm has the same mandatory fields as deliver_sm
+			d, err := parseDeliverSM(p.body)
+			if err != nil {
+				resp.status = smppStatusInvCmd
+				break
+			}
+
+			sim.mu.Lock()
+			sim.submitted = append(sim.submitted, d)
+			resp.body = []byte(fmt.Sprintf("msg%d\x00", len(sim.submitted)))
+			sim.mu.Unlock()
+
+			sim.submits <- d
+		case smppDeliverSMResp, smppEnquireLinkResp:
+			continue
+		case smppUnbind:
+			_ = sim.write(resp)
+			return
+		}
+
+		if err = sim.write(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (sim *smscSimulator) write(p *smppPDU) error {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	_, err := sim.conn.Write(p.marshal())
+
+	return err
+}
+
+// receipt sends deliver_sm with delivery receipt in short_message text
+func (sim *smscSimulator) receipt(messageID, state string) error {
+	text := fmt.Sprintf("id:%s sub:001 dlvrd:001 submit date:2401010000 done date:2401010001 stat:%s err:000 text:", messageID, state)
+
+	w := &smppWriter{}
+	w.cString("")
+	w.WriteByte(1)
+	w.WriteByte(1)
+	w.cString("79990001122")
+	w.WriteByte(5)
+	w.WriteByte(0)
+	w.cString("OnCall")
+	w.WriteByte(smppESMClassReceipt)
+	w.Write([]byte{0, 0})
+	w.cString("")
+	w.cString("")
+	w.Write([]byte{0, 0, 0, 0})
+	w.WriteByte(byte(len(text)))
+	w.WriteString(text)
+
+	return sim.write(&smppPDU{commandID: smppDeliverSM, sequence: 1, body: w.Bytes()})
+}
+
+func (sim *smscSimulator) disconnect() {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	_ = sim.conn.Close()
+}
+
+func newTestSMPP(t *testing.T, sim *smscSimulator, password string) *SMPP {
+	t.Helper()
+
+	s, err := NewSMPP(NewOptions(map[string]interface{}{
+		"addr":        sim.ln.Addr().String(),
+		"system_id":   "oncall",
+		"password":    password,
+		"source_addr": "OnCall",
+		"reconnect":   "20ms",
+		"timeout":     "1s",
+	}), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewSMPP: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+func waitBound(t *testing.T, s *SMPP) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Health(context.Background()) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("not bound to SMSC")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+var smppTestUser = user.Item{ID: "U1", PhoneNumber: "+79990001122"}
+
+func TestSMPPSubmitEncoding(t *testing.T) {
+	sim := newSMSCSimulator(t, "secret")
+	s := newTestSMPP(t, sim, "secret")
+	waitBound(t, s)
+
+	tests := []struct {
+		name       string
+		text       string
+		encoding   string
+		wantCoding byte
+		wantParts  int
+	}{
+		{name: "gsm with extension table", text: "CPU > 90% [db-1] {prod} @oncall", encoding: sms.EncodingGSM7, wantCoding: smppCodingDefault, wantParts: 1},
+		{name: "national gsm characters", text: "Straße Ø £5 ¿ñ?", encoding: sms.EncodingGSM7, wantCoding: smppCodingDefault, wantParts: 1},
+		{name: "degree sign is not gsm", text: "Temperature 90°", encoding: sms.EncodingUCS2, wantCoding: smppCodingUCS2, wantParts: 1},
+		{name: "cyrillic", text: "База данных недоступна", encoding: sms.EncodingUCS2, wantCoding: smppCodingUCS2, wantParts: 1},
+		{name: "long gsm", text: strings.Repeat("disk full ", 20) + "[end]", encoding: sms.EncodingGSM7, wantCoding: smppCodingDefault, wantParts: 2},
+		{name: "long ucs2", text: strings.Repeat("тревога ", 20), encoding: sms.EncodingUCS2, wantCoding: smppCodingUCS2, wantParts: 3},
+		{name: "legacy call without encoding", text: "Привет", wantCoding: smppCodingUCS2, wantParts: 1},
+		{name: "text does not fit claimed gsm", text: "Привет", encoding: sms.EncodingGSM7, wantCoding: smppCodingUCS2, wantParts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, result := WithResult(context.Background())
+
+			err := s.Notify(ctx, &Notification{Channel: ChannelSMS, User: smppTestUser, AlertID: "A1", Text: tt.text, Encoding: tt.encoding})
+			if err != nil {
+				t.Fatalf("Notify: %v", err)
+			}
+
+			var message []byte
+
+			for i := 0; i < tt.wantParts; i++ {
+				d := <-sim.submits
+				if d.coding != tt.wantCoding {
+					t.Errorf("part %d data_coding 0x%02X, want 0x%02X", i+1, d.coding, tt.wantCoding)
+				}
+
+				msg := d.message
+				if tt.wantParts > 1 {
+					if d.esmClass&smppESMClassUDHI == 0 || len(msg) < 6 || msg[4] != byte(tt.wantParts) || msg[5] != byte(i+1) {
+						t.Fatalf("part %d has no valid UDH: % X", i+1, msg)
+					}
+
+					msg = msg[6:]
+				}
+
+				message = append(message, msg...)
+			}
+
+			want, _ := sms.Encode(tt.text, sms.Encoding(tt.text))
+			if !bytes.Equal(message, want) {
+				t.Errorf("message % X, want % X", message, want)
+			}
+
+			if result.ExternalID == "" || result.Status != smppStatusSubmitted {
+				t.Errorf("result %+v", result)
+			}
+		})
+	}
+}
+
+func TestSMPPReceiptOfLongMessage(t *testing.T) {
+	sim := newSMSCSimulator(t, "secret")
+	s := newTestSMPP(t, sim, "secret")
+
+	receipts := make(chan Receipt, 10)
+	s.OnReceipt(func(r Receipt) { receipts <- r })
+	waitBound(t, s)
+
+	ctx, result := WithResult(context.Background())
+	if err := s.SendSms(ctx, smppTestUser, "A1", strings.Repeat("a", 200)); err != nil {
+		t.Fatalf("SendSms: %v", err)
+	}
+
+	<-sim.submits
+	<-sim.submits
+
+	// SMSC reports every part, both are matched to message ID of the first part
+	tests := []struct {
+		messageID   string
+		state       string
+		wantStatus  string
+		wantSuccess bool
+	}{
+		{messageID: "msg2", state: "DELIVRD", wantStatus: smppStatusDelivered, wantSuccess: true},
+		{messageID: "msg1", state: "UNDELIV", wantStatus: "undeliv"},
+	}
+
+	for _, tt := range tests {
+		if err := sim.receipt(tt.messageID, tt.state); err != nil {
+			t.Fatalf("receipt: %v", err)
+		}
+
+		select {
+		case r := <-receipts:
+			if r.ExternalID != result.ExternalID || r.Status != tt.wantStatus || r.Success != tt.wantSuccess {
+				t.Errorf("receipt %+v, want %s/%s/%v", r, result.ExternalID, tt.wantStatus, tt.wantSuccess)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("receipt of %s is not reported", tt.messageID)
+		}
+	}
+}
+
+func TestSMPPReconnects(t *testing.T) {
+	sim := newSMSCSimulator(t, "secret")
+	s := newTestSMPP(t, sim, "secret")
+	waitBound(t, s)
+
+	sim.disconnect()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sim.mu.Lock()
+		binds := sim.binds
+		sim.mu.Unlock()
+
+		if binds >= 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("session is not restored")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	waitBound(t, s)
+
+	if err := s.SendSms(context.Background(), smppTestUser, "A1", "back online"); err != nil {
+		t.Errorf("SendSms after reconnect: %v", err)
+	}
+}
+
+func TestSMPPErrors(t *testing.T) {
+	sim := newSMSCSimulator(t, "secret")
+
+	s := newTestSMPP(t, sim, "wrong")
+	time.Sleep(50 * time.Millisecond)
+
+	if err := s.SendSms(context.Background(), smppTestUser, "A1", "text"); !errors.Is(err, errSMPPNotBound) {
+		t.Errorf("wrong password: error %v, want errSMPPNotBound", err)
+	}
+
+	if err := s.SendSms(context.Background(), user.Item{}, "A1", "text"); !errors.Is(err, errEmptyPhone) {
+		t.Errorf("no phone: error %v, want errEmptyPhone", err)
+	}
+
+	if err := s.CallPhone(context.Background(), smppTestUser, "A1", "text"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("call: error %v, want ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,465 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+const (
+	smtpTLSNone     = "none"
+	smtpTLSStart    = "starttls"
+	smtpTLSImplicit = "implicit"
+
+	smtpAuthNone  = "none"
+	smtpAuthPlain = "plain"
+	smtpAuthLogin = "login"
+
+	defaultSMTPPort           = 587
+	defaultSMTPTimeout        = 15 * time.Second
+	defaultSMTPHealthInterval = 10 * time.Minute
+
+	defaultSMTPSubject = `{{ if .Details }}{{ .Details.Title }}{{ else }}[{{ .Channel }}] Grafana OnCall alert {{ .AlertID }}{{ end }}`
+	defaultSMTPText    = `{{ .Text }}
+{{ with .Details }}
+{{ .Title }}
+{{ .Message }}
+{{ .SourceLink }}
+{{ end }}`
+	defaultSMTPHTML = `<p>{{ .Text }}</p>
+{{ with .Details }}<h3>{{ .Title }}</h3>
+<pre>{{ .Message }}</pre>
+{{ if .SourceLink }}<p><a href="{{ .SourceLink }}">{{ .SourceLink }}</a></p>{{ end }}{{ end }}`
+)
+
+var (
+	errEmptySMTPHost   = errors.New("host is empty")
+	errEmptySMTPFrom   = errors.New("from is empty")
+	errInvalidSMTPTLS  = errors.New("tls should be none, starttls or implicit")
+	errInvalidSMTPAuth = errors.New("auth should be none, plain or login")
+	errEmptyEmail      = errors.New("user has no email")
+	errSMTPNoStartTLS  = errors.New("server does not support STARTTLS")
+	errSMTPLoginStep   = errors.New("unexpected AUTH LOGIN challenge")
+	errSMTPCleartext   = errors.New("unencrypted connection, credentials are sent only over TLS or to localhost")
+	errSMTPWrongHost   = errors.New("wrong host name")
+)
+
+// SMTP sends notifications by email to user, or to fixed recipients from configuration,
+// each channel has own subject and body templates
+type SMTP struct {
+	logger    zerolog.Logger
+	host      string
+	port      int
+	from      string
+	to        []string
+	username  string
+	password  string
+	tlsMode   string
+	authMode  string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	templates map[string]*smtpTemplates
+
+	// healthInterval is how long successful connection proves that relay works, Health doesn't connect until then
+	healthInterval time.Duration
+	lastOK         atomic.Int64
+}
+
+type smtpTemplates struct {
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+}
+
+func NewSMTP(opts Options, l zerolog.Logger) (*SMTP, error) {
+	s := &SMTP{
+		logger:   l.With().Str("engine", "smtp").Logger(),
+		host:     opts.String("host", ""),
+		port:     opts.Int("port", defaultSMTPPort),
+		from:     opts.String("from", ""),
+		to:       opts.StringSlice("to"),
+		username: opts.String("username", ""),
+		password: opts.String("password", ""),
+		tlsMode:  strings.ToLower(opts.String("tls", smtpTLSStart)),
+		authMode: strings.ToLower(opts.String("auth", smtpAuthPlain)),
+		timeout:  opts.Duration("timeout", defaultSMTPTimeout),
+
+		templates:      make(map[string]*smtpTemplates),
+		healthInterval: opts.Duration("health_interval", defaultSMTPHealthInterval),
+	}
+
+	if s.host == "" {
+		return nil, errEmptySMTPHost
+	}
+
+	if s.from == "" {
+		return nil, errEmptySMTPFrom
+	}
+
+	switch s.tlsMode {
+	case smtpTLSNone, smtpTLSStart, smtpTLSImplicit:
+	default:
+		return nil, fmt.Errorf("%w: %s", errInvalidSMTPTLS, s.tlsMode)
+	}
+
+	if s.username == "" {
+		s.authMode = smtpAuthNone
+	}
+
+	switch s.authMode {
+	case smtpAuthNone, smtpAuthPlain, smtpAuthLogin:
+	default:
+		return nil, fmt.Errorf("%w: %s", errInvalidSMTPAuth, s.authMode)
+	}
+
+	s.tlsConfig = &tls.Config{
+		ServerName: s.host,
+		//nolint:gosec // explicitly requested in configuration, e.g. for relays with self-signed certificates
+		InsecureSkipVerify: opts.Bool("insecure_skip_verify", false),
+	}
+
+	for _, channel := range []string{ChannelPhone, ChannelSMS, ChannelSlack} {
+		tpl, err := newSMTPTemplates(channel, opts.Sub(channel))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", channel, err)
+		}
+
+		s.templates[channel] = tpl
+	}
+
+	return s, nil
+}
+
+func newSMTPTemplates(channel string, opts Options) (*smtpTemplates, error) {
+	var (
+		err error
+		tpl = &smtpTemplates{}
+	)
+
+	if tpl.subject, err = template.New(channel + "_subject").Parse(opts.String("subject", defaultSMTPSubject)); err != nil {
+		return nil, fmt.Errorf("subject: %w", err)
+	}
+
+	if tpl.text, err = template.New(channel + "_text").Parse(opts.String("text", defaultSMTPText)); err != nil {
+		return nil, fmt.Errorf("text: %w", err)
+	}
+
+	if tpl.html, err = htmltemplate.New(channel + "_html").Parse(opts.String("html", defaultSMTPHTML)); err != nil {
+		return nil, fmt.Errorf("html: %w", err)
+	}
+
+	return tpl, nil
+}
+
+func (s *SMTP) CallPhone(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, s, ChannelPhone, u, alertID, alertText)
+}
+
+func (s *SMTP) SendSms(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, s, ChannelSMS, u, alertID, alertText)
+}
+
+func (s *SMTP) MessageSlack(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return notifyLegacy(ctx, s, ChannelSlack, u, alertID, alertText)
+}
+
+// Notify sends email, templates are executed with Notification as data
+func (s *SMTP) Notify(ctx context.Context, n *Notification) error {
+	tpl, ok := s.templates[n.Channel]
+	if !ok {
+		return ErrNotSupported
+	}
+
+	recipients := s.to
+	if len(recipients) == 0 && n.User.NotifyEmail != "" {
+		recipients = []string{n.User.NotifyEmail}
+	}
+
+	if len(recipients) == 0 && n.User.Email != "" {
+		recipients = []string{n.User.Email}
+	}
+
+	if len(recipients) == 0 {
+		return errEmptyEmail
+	}
+
+	msg, err := s.message(tpl, n, recipients)
+	if err != nil {
+		return err
+	}
+
+	if err = s.deliver(ctx, recipients, msg); err != nil {
+		return err
+	}
+
+	s.logger.Debug().
+		Str("channel", n.Channel).
+		Strs("email", recipients).
+		Str("alert_id", n.AlertID).
+		Str("request_id", n.RequestID).
+		Msg("Email was sent")
+
+	return nil
+}
+
+func (s *SMTP) message(tpl *smtpTemplates, payload *Notification, recipients []string) ([]byte, error) {
+	var subject, text, html bytes.Buffer
+
+	if err := tpl.subject.Execute(&subject, payload); err != nil {
+		return nil, err
+	}
+
+	if err := tpl.text.Execute(&text, payload); err != nil {
+		return nil, err
+	}
+
+	if err := tpl.html.Execute(&html, payload); err != nil {
+		return nil, err
+	}
+
+	var (
+		msg  bytes.Buffer
+		body bytes.Buffer
+	)
+
+	mw := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{
+		{"text/plain; charset=UTF-8", text.Bytes()},
+		{"text/html; charset=UTF-8", html.Bytes()},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		if _, err = qw.Write(part.data); err != nil {
+			return nil, err
+		}
+
+		if err = qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	subjectLine := strings.Join(strings.Fields(subject.String()), " ")
+
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subjectLine))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", messageID(), s.host)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// Health connects to relay and authenticates without sending message, it is skipped within health_interval
+// after successful delivery or check
+func (s *SMTP) Health(ctx context.Context) error {
+	if time.Since(time.Unix(0, s.lastOK.Load())) < s.healthInterval {
+		return nil
+	}
+
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = client.Close() }()
+
+	if err = client.Noop(); err != nil {
+		return err
+	}
+
+	return s.quit(client)
+}
+
+func (s *SMTP) deliver(ctx context.Context, recipients []string, msg []byte) error {
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = client.Close() }()
+
+	if err = client.Mail(s.from); err != nil {
+		return err
+	}
+
+	for _, to := range recipients {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return s.quit(client)
+}
+
+// quit ends session, which proves that relay works
+func (s *SMTP) quit(client *smtp.Client) error {
+	if err := client.Quit(); err != nil {
+		return err
+	}
+
+	s.lastOK.Store(time.Now().UnixNano())
+
+	return nil
+}
+
+// dial connects to relay, does STARTTLS and authentication according to configuration
+func (s *SMTP) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	dialer := &net.Dialer{Timeout: s.timeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if s.tlsMode == smtpTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if s.tlsMode == smtpTLSStart {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			_ = client.Close()
+			return nil, errSMTPNoStartTLS
+		}
+
+		if err = client.StartTLS(s.tlsConfig); err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+	}
+
+	if auth := s.auth(); auth != nil {
+		if err = client.Auth(auth); err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+func (s *SMTP) auth() smtp.Auth {
+	switch s.authMode {
+	case smtpAuthPlain:
+		return smtp.PlainAuth("", s.username, s.password, s.host)
+	case smtpAuthLogin:
+		return &loginAuth{username: s.username, password: s.password, host: s.host}
+	}
+
+	return nil
+}
+
+// loginAuth implements AUTH LOGIN, which is not provided by net/smtp
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// Start refuses to send credentials in cleartext the same way as smtp.PlainAuth does
+func (a *loginAuth) Start(server *smtp.ServerInfo) (proto string, toServer []byte, err error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errSMTPCleartext
+	}
+
+	if server.Name != a.host {
+		return "", nil, errSMTPWrongHost
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", errSMTPLoginStep, fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+func messageID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
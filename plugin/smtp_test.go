@@ -0,0 +1,359 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+type smtpEnvelope struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP is in-process relay without TLS, it accepts AUTH PLAIN and LOGIN with single account
+type fakeSMTP struct {
+	addr     *net.TCPAddr
+	username string
+	password string
+	mails    chan smtpEnvelope
+	conns    atomic.Int32
+}
+
+func newFakeSMTP(t *testing.T, username, password string) *fakeSMTP {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	f := &fakeSMTP{
+		addr:     ln.Addr().(*net.TCPAddr),
+		username: username,
+		password: password,
+		mails:    make(chan smtpEnvelope, 10),
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			f.conns.Add(1)
+			go f.serve(textproto.NewConn(conn))
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeSMTP) serve(c *textproto.Conn) {
+	defer func() { _ = c.Close() }()
+
+	var (
+		envelope smtpEnvelope
+		authed   = f.username == ""
+	)
+
+	_ = c.PrintfLine("220 fake ESMTP")
+
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			_ = c.PrintfLine("250-fake\r\n250-AUTH PLAIN LOGIN\r\n250 8BITMIME")
+		case "AUTH":
+			authed = f.auth(c, arg)
+			if authed {
+				_ = c.PrintfLine("235 2.7.0 Authentication successful")
+			} else {
+				_ = c.PrintfLine("535 5.7.8 Authentication credentials invalid")
+			}
+		case "MAIL":
+			if !authed {
+				_ = c.PrintfLine("530 5.7.0 Authentication required")
+				continue
+			}
+
+			// Parameters like BODY=8BITMIME follow the address
+			from, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+			envelope = smtpEnvelope{from: strings.Trim(from, "<>")}
+			_ = c.PrintfLine("250 OK")
+		case "RCPT":
+			envelope.to = append(envelope.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			_ = c.PrintfLine("250 OK")
+		case "DATA":
+			_ = c.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+
+			data, err := io.ReadAll(c.DotReader())
+			if err != nil {
+				return
+			}
+
+			envelope.data = string(data)
+			f.mails <- envelope
+			_ = c.PrintfLine("250 OK: queued")
+		case "NOOP", "RSET":
+			_ = c.PrintfLine("250 OK")
+		case "QUIT":
+			_ = c.PrintfLine("221 Bye")
+			return
+		default:
+			_ = c.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func (f *fakeSMTP) auth(c *textproto.Conn, arg string) bool {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		creds, _ := base64.StdEncoding.DecodeString(initial)
+		parts := strings.Split(string(creds), "\x00")
+
+		return len(parts) == 3 && parts[1] == f.username && parts[2] == f.password
+	case "LOGIN":
+		var answers []string
+
+		for _, challenge := range []string{"Username:", "Password:"} {
+			_ = c.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+
+			line, err := c.ReadLine()
+			if err != nil {
+				return false
+			}
+
+			answer, _ := base64.StdEncoding.DecodeString(line)
+			answers = append(answers, string(answer))
+		}
+
+		return answers[0] == f.username && answers[1] == f.password
+	}
+
+	return false
+}
+
+func newTestSMTP(t *testing.T, relay *fakeSMTP, opts map[string]interface{}) *SMTP {
+	t.Helper()
+
+	cfg := map[string]interface{}{
+		"host": relay.addr.IP.String(),
+		"port": relay.addr.Port,
+		"from": "oncall@example.com",
+		"tls":  "none",
+	}
+	for k, v := range opts {
+		cfg[k] = v
+	}
+
+	s, err := NewSMTP(NewOptions(cfg), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewSMTP: %v", err)
+	}
+
+	return s
+}
+
+func TestSMTPDeliversTextAndHTML(t *testing.T) {
+	for _, auth := range []string{smtpAuthPlain, smtpAuthLogin} {
+		t.Run(auth, func(t *testing.T) {
+			relay := newFakeSMTP(t, "bot", "secret")
+			s := newTestSMTP(t, relay, map[string]interface{}{"username": "bot", "password": "secret", "auth": auth})
+
+			err := s.Notify(context.Background(), &Notification{
+				Channel: ChannelSMS,
+				User:    user.Item{Email: "ivan@example.com"},
+				AlertID: "A1",
+				Text:    "Привет, db is down",
+				Details: &AlertDetails{Title: "DB <down>", Message: "disk full", SourceLink: "https://grafana.local/a/1"},
+			})
+			if err != nil {
+				t.Fatalf("Notify: %v", err)
+			}
+
+			envelope := <-relay.mails
+			if envelope.from != "oncall@example.com" || strings.Join(envelope.to, ",") != "ivan@example.com" {
+				t.Errorf("envelope %s -> %v", envelope.from, envelope.to)
+			}
+
+			parts := readMultipart(t, envelope.data)
+			if subject := parts["subject"]; subject != "DB <down>" {
+				t.Errorf("subject %q", subject)
+			}
+
+			if text := parts["text/plain"]; !strings.Contains(text, "Привет, db is down") || !strings.Contains(text, "disk full") {
+				t.Errorf("text part %q", text)
+			}
+
+			if html := parts["text/html"]; !strings.Contains(html, "<h3>DB &lt;down&gt;</h3>") {
+				t.Errorf("html part %q", html)
+			}
+		})
+	}
+}
+
+func TestSMTPFixedRecipients(t *testing.T) {
+	relay := newFakeSMTP(t, "", "")
+	s := newTestSMTP(t, relay, map[string]interface{}{"to": []interface{}{"ops@example.com", "duty@example.com"}})
+
+	if err := s.CallPhone(context.Background(), user.Item{}, "A1", "call me"); err != nil {
+		t.Fatalf("CallPhone: %v", err)
+	}
+
+	if envelope := <-relay.mails; strings.Join(envelope.to, ",") != "ops@example.com,duty@example.com" {
+		t.Errorf("recipients %v", envelope.to)
+	}
+}
+
+func TestSMTPErrors(t *testing.T) {
+	relay := newFakeSMTP(t, "bot", "secret")
+
+	tests := []struct {
+		name    string
+		opts    map[string]interface{}
+		user    user.Item
+		wantErr error
+	}{
+		{name: "no email", user: user.Item{}, wantErr: errEmptyEmail},
+		{
+			name:    "no STARTTLS",
+			opts:    map[string]interface{}{"tls": "starttls"},
+			user:    user.Item{Email: "ivan@example.com"},
+			wantErr: errSMTPNoStartTLS,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSMTP(t, relay, tt.opts)
+
+			if err := s.SendSms(context.Background(), tt.user, "A1", "text"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	s := newTestSMTP(t, relay, map[string]interface{}{"username": "bot", "password": "wrong", "auth": smtpAuthLogin})
+	if err := s.SendSms(context.Background(), user.Item{Email: "ivan@example.com"}, "A1", "text"); err == nil {
+		t.Error("wrong password is accepted")
+	}
+}
+
+func TestLoginAuthRefusesCleartext(t *testing.T) {
+	a := &loginAuth{username: "bot", password: "secret", host: "smtp.example.com"}
+
+	tests := []struct {
+		server  smtp.ServerInfo
+		wantErr error
+	}{
+		{server: smtp.ServerInfo{Name: "smtp.example.com", TLS: false}, wantErr: errSMTPCleartext},
+		{server: smtp.ServerInfo{Name: "smtp.example.com", TLS: true}},
+		{server: smtp.ServerInfo{Name: "evil.example.com", TLS: true}, wantErr: errSMTPWrongHost},
+		{server: smtp.ServerInfo{Name: "localhost", TLS: false}, wantErr: errSMTPWrongHost},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := a.Start(&tt.server); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s tls=%v: error %v, want %v", tt.server.Name, tt.server.TLS, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSMTPHealthReusesRecentConnection(t *testing.T) {
+	relay := newFakeSMTP(t, "", "")
+	s := newTestSMTP(t, relay, map[string]interface{}{"health_interval": "1h"})
+
+	for i := 0; i < 3; i++ {
+		if err := s.Health(context.Background()); err != nil {
+			t.Fatalf("Health: %v", err)
+		}
+	}
+
+	if conns := relay.conns.Load(); conns != 1 {
+		t.Errorf("%d connections for 3 checks", conns)
+	}
+
+	// Delivery proves that relay works as well
+	s = newTestSMTP(t, relay, map[string]interface{}{"health_interval": "1h"})
+	if err := s.SendSms(context.Background(), user.Item{Email: "ivan@example.com"}, "A1", "text"); err != nil {
+		t.Fatalf("SendSms: %v", err)
+	}
+	<-relay.mails
+
+	if err := s.Health(context.Background()); err != nil || relay.conns.Load() != 2 {
+		t.Errorf("health after delivery: %v, %d connections", err, relay.conns.Load())
+	}
+
+	s.lastOK.Store(time.Now().Add(-2 * time.Hour).UnixNano())
+
+	if err := s.Health(context.Background()); err != nil || relay.conns.Load() != 3 {
+		t.Errorf("health after interval: %v, %d connections", err, relay.conns.Load())
+	}
+}
+
+// readMultipart returns decoded subject and parts of message by content type
+func readMultipart(t *testing.T, data string) map[string]string {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("subject: %v", err)
+	}
+
+	result := map[string]string{"subject": subject}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("content type: %v", err)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("part: %v", err)
+		}
+
+		// multipart.Reader decodes quoted-printable transparently
+		body, _ := io.ReadAll(part)
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		result[mediaType] = string(body)
+	}
+
+	return result
+}
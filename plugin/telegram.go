@@ -0,0 +1,162 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+const (
+	defaultTelegramAPIURL  = "https://api.telegram.org"
+	defaultTelegramTimeout = 10 * time.Second
+	defaultTelegramCall    = "☎️ CALL: "
+)
+
+var (
+	errEmptyBotToken  = errors.New("token is empty")
+	errEmptyChatID    = errors.New("user has no telegram_chat_id")
+	errTelegramFailed = errors.New("telegram api request failed")
+)
+
+// Telegram delivers notifications as Bot API messages to oncall_users.telegram_chat_id,
+// or to chat_id from configuration for users without it.
+// Phone calls are sent as non-silent messages marked with call_prefix
+type Telegram struct {
+	client     *http.Client
+	logger     zerolog.Logger
+	apiURL     string
+	token      string
+	chatID     string
+	callPrefix string
+	silentSMS  bool
+}
+
+type telegramMessage struct {
+	ChatID              string `json:"chat_id"`
+	Text                string `json:"text"`
+	DisableNotification bool   `json:"disable_notification,omitempty"`
+}
+
+type telegramResponse struct {
+	Ok          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func NewTelegram(opts Options, l zerolog.Logger) (*Telegram, error) {
+	t := &Telegram{
+		client:     &http.Client{Timeout: opts.Duration("timeout", defaultTelegramTimeout)},
+		logger:     l.With().Str("engine", "telegram").Logger(),
+		apiURL:     strings.TrimSuffix(opts.String("api_url", defaultTelegramAPIURL), "/"),
+		token:      opts.String("token", ""),
+		chatID:     opts.String("chat_id", ""),
+		callPrefix: opts.String("call_prefix", defaultTelegramCall),
+		silentSMS:  opts.Bool("silent_sms", false),
+	}
+
+	if t.token == "" {
+		return nil, errEmptyBotToken
+	}
+
+	return t, nil
+}
+
+func (t *Telegram) CallPhone(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return t.send(ctx, ChannelPhone, u, alertID, t.callPrefix+alertText, false)
+}
+
+func (t *Telegram) SendSms(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return t.send(ctx, ChannelSMS, u, alertID, alertText, t.silentSMS)
+}
+
+func (t *Telegram) MessageSlack(ctx context.Context, u user.Item, alertID, alertText string) error {
+	return t.send(ctx, ChannelSlack, u, alertID, alertText, false)
+}
+
+func (t *Telegram) send(ctx context.Context, channel string, u user.Item, alertID, text string, silent bool) error {
+	chatID := u.TelegramChatID
+	if chatID == "" {
+		chatID = t.chatID
+	}
+
+	if chatID == "" {
+		return errEmptyChatID
+	}
+
+	body, err := json.Marshal(&telegramMessage{
+		ChatID:              chatID,
+		Text:                text,
+		DisableNotification: silent,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = t.call(ctx, "sendMessage", body); err != nil {
+		return err
+	}
+
+	t.logger.Debug().
+		Str("channel", channel).
+		Str("chat_id", chatID).
+		Str("alert_id", alertID).
+		Msg("Telegram message was sent")
+
+	return nil
+}
+
+// Health calls getMe, which fails when token was revoked or Bot API is not reachable
+func (t *Telegram) Health(ctx context.Context) error {
+	return t.call(ctx, "getMe", []byte("{}"))
+}
+
+func (t *Telegram) call(ctx context.Context, method string, body []byte) error {
+	// Token is part of URL path, so URL is never logged
+	requestURL := fmt.Sprintf("%s/bot%s/%s", t.apiURL, t.token, method)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// url.Error contains bot token, keep only the reason
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%w: %v", errTelegramFailed, urlErr.Err)
+		}
+
+		return err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	var result telegramResponse
+	if err = json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("%w: http code %d", errTelegramFailed, resp.StatusCode)
+	}
+
+	if !result.Ok {
+		return fmt.Errorf("%w: %d %s", errTelegramFailed, result.ErrorCode, result.Description)
+	}
+
+	return nil
+}
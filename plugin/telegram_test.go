@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+type botCall struct {
+	path    string
+	message telegramMessage
+}
+
+// newFakeBotAPI starts Bot API stand-in, it answers with response to every method
+func newFakeBotAPI(t *testing.T, response string) (*Telegram, <-chan botCall) {
+	t.Helper()
+
+	calls := make(chan botCall, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := botCall{path: r.URL.Path}
+		_ = json.NewDecoder(r.Body).Decode(&call.message)
+		calls <- call
+
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+
+	tg, err := NewTelegram(NewOptions(map[string]interface{}{
+		"api_url":     srv.URL + "/",
+		"token":       "123:secret",
+		"chat_id":     "-100500",
+		"call_prefix": "CALL: ",
+		"silent_sms":  true,
+	}), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewTelegram: %v", err)
+	}
+
+	return tg, calls
+}
+
+func TestTelegramMessages(t *testing.T) {
+	tg, calls := newFakeBotAPI(t, `{"ok": true}`)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		send   func(user.Item) error
+		user   user.Item
+		chatID string
+		text   string
+		silent bool
+	}{
+		{
+			name:   "sms to user chat is silent",
+			send:   func(u user.Item) error { return tg.SendSms(ctx, u, "1", "disk full") },
+			user:   user.Item{TelegramChatID: "42"},
+			chatID: "42",
+			text:   "disk full",
+			silent: true,
+		},
+		{
+			name:   "call is prefixed and loud",
+			send:   func(u user.Item) error { return tg.CallPhone(ctx, u, "1", "db is down") },
+			user:   user.Item{TelegramChatID: "42"},
+			chatID: "42",
+			text:   "CALL: db is down",
+		},
+		{
+			name:   "user without chat gets default chat",
+			send:   func(u user.Item) error { return tg.MessageSlack(ctx, u, "1", "hi") },
+			chatID: "-100500",
+			text:   "hi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(tt.user); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+
+			call := <-calls
+			if call.path != "/bot123:secret/sendMessage" {
+				t.Errorf("path %q", call.path)
+			}
+
+			want := telegramMessage{ChatID: tt.chatID, Text: tt.text, DisableNotification: tt.silent}
+			if call.message != want {
+				t.Errorf("message %+v, want %+v", call.message, want)
+			}
+		})
+	}
+}
+
+func TestTelegramAPIError(t *testing.T) {
+	tg, _ := newFakeBotAPI(t, `{"ok": false, "error_code": 403, "description": "Forbidden: bot was blocked by the user"}`)
+
+	err := tg.SendSms(context.Background(), user.Item{TelegramChatID: "42"}, "1", "text")
+	if !errors.Is(err, errTelegramFailed) || !strings.Contains(err.Error(), "blocked") {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestTelegramErrorHidesToken(t *testing.T) {
+	tg, err := NewTelegram(NewOptions(map[string]interface{}{
+		"api_url": "http://127.0.0.1:1",
+		"token":   "123:secret",
+	}), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewTelegram: %v", err)
+	}
+
+	err = tg.Health(context.Background())
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestTelegramNoChat(t *testing.T) {
+	tg, err := NewTelegram(NewOptions(map[string]interface{}{"token": "123:secret"}), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewTelegram: %v", err)
+	}
+
+	if err = tg.SendSms(context.Background(), user.Item{}, "1", "text"); !errors.Is(err, errEmptyChatID) {
+		t.Errorf("error %v, want errEmptyChatID", err)
+	}
+}
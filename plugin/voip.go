@@ -1,33 +1,348 @@
-//nolint:dupl
 package plugin
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/ebogdanov/emu-oncall/internal/user"
 )
 
+// Call outcomes reported by voice plugins in Result.Status
+const (
+	CallAnswered = "answered"
+	CallBusy     = "busy"
+	CallNoAnswer = "no_answer"
+	CallFailed   = "failed"
+)
+
+const (
+	defaultAMIRingTimeout = 30 * time.Second
+	defaultAMITimeout     = 60 * time.Second
+	defaultAMIVariable    = "ALERT_TEXT"
+	defaultAMIChannel     = "PJSIP/{{ .Phone }}"
+)
+
+// AMI OriginateResponse reason codes
+const (
+	amiReasonHangup     = "1"
+	amiReasonRingTimout = "3"
+	amiReasonAnswered   = "4"
+	amiReasonBusy       = "5"
+	amiReasonCongestion = "8"
+)
+
+var (
+	errEmptyAMIAddr    = errors.New("addr is empty")
+	errEmptyAMIContext = errors.New("context is empty")
+	errAMILogin        = errors.New("ami login failed")
+	errAMIOriginate    = errors.New("ami originate failed")
+	errCallBusy        = errors.New("callee is busy")
+	errCallNoAnswer    = errors.New("call was not answered")
+	errCallFailed      = errors.New("call failed")
+)
+
+// Voip originates calls through Asterisk Manager Interface (AMI).
+// Alert text is passed as channel variable, so that dialplan can play it with TTS
 type Voip struct {
-	logger *zerolog.Logger
+	logger zerolog.Logger
+
+	addr        string
+	username    string
+	secret      string
+	channel     *template.Template
+	context     string
+	exten       string
+	priority    int
+	callerID    string
+	variable    string
+	ringTimeout time.Duration
+	timeout     time.Duration
+
+	actionID atomic.Uint64
+}
+
+// VoipPayload is data available inside channel template
+type VoipPayload struct {
+	Phone string
+	User  user.Item
+}
+
+type amiMessage map[string]string
+
+func NewVoip(opts Options, l zerolog.Logger) (*Voip, error) {
+	v := &Voip{
+		logger:      l.With().Str("engine", "voip").Logger(),
+		addr:        opts.String("addr", ""),
+		username:    opts.String("username", ""),
+		secret:      opts.String("secret", ""),
+		context:     opts.String("context", ""),
+		exten:       opts.String("exten", "s"),
+		priority:    opts.Int("priority", 1),
+		callerID:    opts.String("caller_id", ""),
+		variable:    opts.String("variable", defaultAMIVariable),
+		ringTimeout: opts.Duration("ring_timeout", defaultAMIRingTimeout),
+		timeout:     opts.Duration("timeout", defaultAMITimeout),
+	}
+
+	if v.addr == "" {
+		return nil, errEmptyAMIAddr
+	}
+
+	if v.context == "" {
+		return nil, errEmptyAMIContext
+	}
+
+	channel, err := template.New("channel").Parse(opts.String("channel", defaultAMIChannel))
+	if err != nil {
+		return nil, fmt.Errorf("channel: %w", err)
+	}
+	v.channel = channel
+
+	return v, nil
+}
+
+func (v *Voip) CallPhone(ctx context.Context, u user.Item, alertID, alertText string) error {
+	if u.PhoneNumber == "" {
+		return errEmptyPhone
+	}
+
+	var channel bytes.Buffer
+	if err := v.channel.Execute(&channel, &VoipPayload{Phone: strings.TrimPrefix(u.PhoneNumber, "+"), User: u}); err != nil {
+		return err
+	}
+
+	result := ResultFromContext(ctx)
+	result.Status = CallFailed
+
+	uniqueID, reason, err := v.originate(ctx, channel.String(), alertID, alertText)
+	if err != nil {
+		return err
+	}
+
+	result.ExternalID = uniqueID
+	result.Status, err = callOutcome(reason)
+
+	v.logger.Info().
+		Str("phone", u.PhoneNumber).
+		Str("alert_id", alertID).
+		Str("unique_id", uniqueID).
+		Str("reason", reason).
+		Str("status", result.Status).
+		Msg("Call finished")
+
+	return err
+}
+
+func (v *Voip) SendSms(_ context.Context, _ user.Item, _, _ string) error {
+	return ErrNotSupported
+}
+
+func (v *Voip) MessageSlack(_ context.Context, _ user.Item, _, _ string) error {
+	return ErrNotSupported
+}
+
+// Channels returns phone only
+func (v *Voip) Channels() []string {
+	return []string{ChannelPhone}
+}
+
+// Health logs into AMI and logs off, so that wrong credentials are noticed before first call
+func (v *Voip) Health(ctx context.Context) error {
+	conn, _, err := v.login(ctx, "off")
+	if err != nil {
+		return err
+	}
+
+	_ = amiSend(conn, [][2]string{{"Action", "Logoff"}})
+
+	return conn.Close()
 }
 
-func NewVoip(l *zerolog.Logger) *Voip {
-	return &Voip{logger: l}
+// originate places call and waits for OriginateResponse event, which is sent when call is answered or failed
+func (v *Voip) originate(ctx context.Context, channel, alertID, alertText string) (uniqueID, reason string, err error) {
+	conn, r, err := v.login(ctx, "call")
+	if err != nil {
+		return "", "", err
+	}
+
+	defer func() { _ = conn.Close() }()
+
+	defer func() {
+		_ = amiSend(conn, [][2]string{{"Action", "Logoff"}})
+	}()
+
+	originateID := v.nextActionID()
+	fields := [][2]string{
+		{"Action", "Originate"},
+		{"ActionID", originateID},
+		{"Channel", channel},
+		{"Context", v.context},
+		{"Exten", v.exten},
+		{"Priority", strconv.Itoa(v.priority)},
+		{"Timeout", strconv.FormatInt(v.ringTimeout.Milliseconds(), 10)},
+		{"Async", "true"},
+		{"Variable", v.variable + "=" + amiValue(alertText)},
+		{"Variable", "ALERT_ID=" + amiValue(alertID)},
+	}
+
+	if v.callerID != "" {
+		fields = append(fields, [2]string{"CallerID", v.callerID})
+	}
+
+	if err = amiSend(conn, fields); err != nil {
+		return "", "", err
+	}
+
+	for {
+		msg, err := amiRead(r)
+		if err != nil {
+			return "", "", err
+		}
+
+		if msg["ActionID"] != originateID {
+			continue
+		}
+
+		if msg["Response"] != "" && !strings.EqualFold(msg["Response"], "Success") {
+			return "", "", fmt.Errorf("%w: %s", errAMIOriginate, msg["Message"])
+		}
+
+		if strings.EqualFold(msg["Event"], "OriginateResponse") {
+			return msg["Uniqueid"], msg["Reason"], nil
+		}
+	}
 }
 
-func (t *Voip) CallPhone(_ context.Context, u user.Item, alertID, alertText string) error {
-	t.logger.Debug().Msgf("Phone call to %s with text %s, alert id: %s", u.PhoneNumber, alertText, alertID)
-	return nil
+// login connects to AMI and authenticates, events is AMI event mask for the session
+func (v *Voip) login(ctx context.Context, events string) (net.Conn, *textproto.Reader, error) {
+	conn, err := (&net.Dialer{Timeout: v.timeout}).DialContext(ctx, "tcp", v.addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deadline := time.Now().Add(v.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	r := textproto.NewReader(bufio.NewReader(conn))
+
+	// Banner, e.g. "Asterisk Call Manager/5.0.1"
+	if _, err = r.ReadLine(); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	loginID := v.nextActionID()
+	if err = amiSend(conn, [][2]string{
+		{"Action", "Login"},
+		{"ActionID", loginID},
+		{"Username", v.username},
+		{"Secret", v.secret},
+		{"Events", events},
+	}); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	resp, err := amiWaitResponse(r, loginID)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	if !strings.EqualFold(resp["Response"], "Success") {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("%w: %s", errAMILogin, resp["Message"])
+	}
+
+	return conn, r, nil
 }
 
-func (t *Voip) SendSms(_ context.Context, u user.Item, alertID, alertText string) error {
-	t.logger.Debug().Msgf("Send sms to %s with text %s, alert id: %s", u.PhoneNumber, alertText, alertID)
-	return nil
+func (v *Voip) nextActionID() string {
+	return fmt.Sprintf("emu-oncall-%d-%d", time.Now().UnixNano(), v.actionID.Add(1))
+}
+
+func callOutcome(reason string) (string, error) {
+	switch reason {
+	case amiReasonAnswered:
+		return CallAnswered, nil
+	case amiReasonBusy:
+		return CallBusy, errCallBusy
+	case amiReasonRingTimout, amiReasonHangup:
+		return CallNoAnswer, errCallNoAnswer
+	case amiReasonCongestion:
+		return CallFailed, fmt.Errorf("%w: congestion", errCallFailed)
+	}
+
+	return CallFailed, fmt.Errorf("%w: reason %s", errCallFailed, reason)
+}
+
+func amiSend(conn net.Conn, fields [][2]string) error {
+	var buf bytes.Buffer
+
+	for _, f := range fields {
+		buf.WriteString(f[0] + ": " + f[1] + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	_, err := conn.Write(buf.Bytes())
+
+	return err
+}
+
+func amiRead(r *textproto.Reader) (amiMessage, error) {
+	msg := amiMessage{}
+
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if line == "" {
+			if len(msg) == 0 {
+				continue
+			}
+
+			return msg, nil
+		}
+
+		if key, value, found := strings.Cut(line, ":"); found {
+			if _, exists := msg[key]; !exists {
+				msg[key] = strings.TrimSpace(value)
+			}
+		}
+	}
+}
+
+func amiWaitResponse(r *textproto.Reader, actionID string) (amiMessage, error) {
+	for {
+		msg, err := amiRead(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if msg["Response"] != "" && msg["ActionID"] == actionID {
+			return msg, nil
+		}
+	}
 }
 
-func (t *Voip) MessageSlack(_ context.Context, u user.Item, alertID, alertText string) error {
-	t.logger.Debug().Msgf("Send slack message to dbUser with id %s with text %s, alert id: %s", u.ID, alertText, alertID)
-	return nil
+// amiValue keeps value on single line, AMI messages are line based
+func amiValue(s string) string {
+	return strings.Join(strings.Fields(s), " ")
 }
@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ebogdanov/emu-oncall/internal/user"
+)
+
+// fakeAMI is in-process Asterisk Manager Interface. Originate is answered with OriginateResponse with reason,
+// or rejected with error when reason is empty
+type fakeAMI struct {
+	addr      string
+	secret    string
+	reason    string
+	originate chan textproto.MIMEHeader
+}
+
+func newFakeAMI(t *testing.T, secret, reason string) *fakeAMI {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	f := &fakeAMI{addr: ln.Addr().String(), secret: secret, reason: reason, originate: make(chan textproto.MIMEHeader, 10)}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go f.serve(conn)
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeAMI) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	w := textproto.NewWriter(bufio.NewWriter(conn))
+	r := textproto.NewReader(bufio.NewReader(conn))
+
+	_ = w.PrintfLine("Asterisk Call Manager/5.0.1")
+
+	for {
+		action, err := r.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+
+		id := action.Get("ActionID")
+
+		switch action.Get("Action") {
+		case "Login":
+			if action.Get("Secret") != f.secret {
+				_ = w.PrintfLine("Response: Error\r\nActionID: %s\r\nMessage: Authentication failed\r\n", id)
+				return
+			}
+
+			_ = w.PrintfLine("Response: Success\r\nActionID: %s\r\nMessage: Authentication accepted\r\n", id)
+		case "Originate":
+			f.originate <- action
+
+			if f.reason == "" {
+				_ = w.PrintfLine("Response: Error\r\nActionID: %s\r\nMessage: Extension does not exist.\r\n", id)
+				continue
+			}
+
+			_ = w.PrintfLine("Response: Success\r\nActionID: %s\r\nMessage: Originate successfully queued\r\n", id)
+			// Events of other calls are on the same session
+			_ = w.PrintfLine("Event: OriginateResponse\r\nActionID: other\r\nReason: 4\r\nUniqueid: 1700000000.1\r\n")
+			_ = w.PrintfLine("Event: OriginateResponse\r\nActionID: %s\r\nResponse: Success\r\nReason: %s\r\nUniqueid: 1700000000.2\r\n", id, f.reason)
+		case "Logoff":
+			_ = w.PrintfLine("Response: Goodbye\r\nActionID: %s\r\n", id)
+			return
+		}
+	}
+}
+
+func newTestVoip(t *testing.T, ami *fakeAMI, secret string) *Voip {
+	t.Helper()
+
+	v, err := NewVoip(NewOptions(map[string]interface{}{
+		"addr":     ami.addr,
+		"username": "oncall",
+		"secret":   secret,
+		"context":  "alerts",
+		"channel":  "SIP/trunk/{{ .Phone }}",
+		"timeout":  "2s",
+	}), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewVoip: %v", err)
+	}
+
+	return v
+}
+
+func TestVoipCallOutcome(t *testing.T) {
+	tests := []struct {
+		name       string
+		reason     string
+		wantStatus string
+		wantErr    error
+	}{
+		{name: "answered", reason: amiReasonAnswered, wantStatus: CallAnswered},
+		{name: "busy", reason: amiReasonBusy, wantStatus: CallBusy, wantErr: errCallBusy},
+		{name: "no answer", reason: amiReasonRingTimout, wantStatus: CallNoAnswer, wantErr: errCallNoAnswer},
+		{name: "hangup before answer", reason: amiReasonHangup, wantStatus: CallNoAnswer, wantErr: errCallNoAnswer},
+		{name: "congestion", reason: amiReasonCongestion, wantStatus: CallFailed, wantErr: errCallFailed},
+		{name: "originate rejected", wantStatus: CallFailed, wantErr: errAMIOriginate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ami := newFakeAMI(t, "secret", tt.reason)
+			v := newTestVoip(t, ami, "secret")
+
+			ctx, result := WithResult(context.Background())
+
+			err := v.CallPhone(ctx, user.Item{PhoneNumber: "+79990001122"}, "A1", "db is down\nsecond line")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+
+			if result.Status != tt.wantStatus {
+				t.Errorf("status %q, want %q", result.Status, tt.wantStatus)
+			}
+
+			if tt.reason != "" && result.ExternalID != "1700000000.2" {
+				t.Errorf("unique id %q", result.ExternalID)
+			}
+
+			action := <-ami.originate
+			if action.Get("Channel") != "SIP/trunk/79990001122" || action.Get("Context") != "alerts" {
+				t.Errorf("originate %v", action)
+			}
+
+			variables := strings.Join(action.Values("Variable"), ";")
+			if variables != "ALERT_TEXT=db is down second line;ALERT_ID=A1" {
+				t.Errorf("variables %q", variables)
+			}
+		})
+	}
+}
+
+func TestVoipLogin(t *testing.T) {
+	ami := newFakeAMI(t, "secret", amiReasonAnswered)
+
+	if err := newTestVoip(t, ami, "secret").Health(context.Background()); err != nil {
+		t.Errorf("health: %v", err)
+	}
+
+	v := newTestVoip(t, ami, "wrong")
+
+	if err := v.Health(context.Background()); !errors.Is(err, errAMILogin) {
+		t.Errorf("health with wrong secret: %v", err)
+	}
+
+	if err := v.CallPhone(context.Background(), user.Item{PhoneNumber: "+79990001122"}, "A1", "text"); !errors.Is(err, errAMILogin) {
+		t.Errorf("call with wrong secret: %v", err)
+	}
+
+	if err := v.CallPhone(context.Background(), user.Item{}, "A1", "text"); !errors.Is(err, errEmptyPhone) {
+		t.Errorf("call without phone: %v", err)
+	}
+}